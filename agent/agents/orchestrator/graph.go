@@ -23,12 +23,20 @@ func (o *Orchestrator) compileHandleMessageGraph(
 
 	if err := graph.AddLambdaNode("load_or_create_state",
 		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
-			return nodex.LoadOrCreateState(ctx, in, o.store, o.workspaceID, o.customerID, o.channelType)
+			return nodex.LoadOrCreateState(ctx, in, o.store, o.goalMachine, o.workspaceID, o.customerID, o.channelType)
 		}),
 	); err != nil {
 		return nil, fmt.Errorf("add node load_or_create_state: %w", err)
 	}
 
+	if err := graph.AddLambdaNode("check_duplicate",
+		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
+			return nodex.CheckDuplicate(in)
+		}),
+	); err != nil {
+		return nil, fmt.Errorf("add node check_duplicate: %w", err)
+	}
+
 	if err := graph.AddLambdaNode("read_memory",
 		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
 			return nodex.ReadMemory(ctx, in, o.memory)
@@ -37,9 +45,17 @@ func (o *Orchestrator) compileHandleMessageGraph(
 		return nil, fmt.Errorf("add node read_memory: %w", err)
 	}
 
+	if err := graph.AddLambdaNode("retain_goals",
+		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
+			return nodex.RetainGoals(in, o.retentionPolicy)
+		}),
+	); err != nil {
+		return nil, fmt.Errorf("add node retain_goals: %w", err)
+	}
+
 	if err := graph.AddLambdaNode("plan_goal",
 		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
-			return nodex.PlanGoal(ctx, in, o.models.Planner())
+			return nodex.PlanGoal(ctx, in, o.models.Planner(), o.slotSchemas)
 		}),
 	); err != nil {
 		return nil, fmt.Errorf("add node plan_goal: %w", err)
@@ -47,7 +63,11 @@ func (o *Orchestrator) compileHandleMessageGraph(
 
 	if err := graph.AddLambdaNode("apply_plan",
 		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
-			return nodex.ApplyPlan(in)
+			var workspaceID string
+			if in != nil && in.Session != nil {
+				workspaceID = in.Session.WorkspaceID
+			}
+			return nodex.ApplyPlan(in, o.slotSchemas, o.interleavePolicy(workspaceID))
 		}),
 	); err != nil {
 		return nil, fmt.Errorf("add node apply_plan: %w", err)
@@ -63,12 +83,40 @@ func (o *Orchestrator) compileHandleMessageGraph(
 
 	if err := graph.AddLambdaNode("apply_state_updates",
 		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
-			return nodex.ApplyStateUpdates(in)
+			var workspaceID string
+			if in != nil && in.Session != nil {
+				workspaceID = in.Session.WorkspaceID
+			}
+			return nodex.ApplyStateUpdates(in, o.slotSchemas, o.interleavePolicy(workspaceID))
 		}),
 	); err != nil {
 		return nil, fmt.Errorf("add node apply_state_updates: %w", err)
 	}
 
+	if err := graph.AddLambdaNode("bridge_resumed_goal",
+		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
+			return nodex.BridgeResumedGoal(ctx, in, o.models)
+		}),
+	); err != nil {
+		return nil, fmt.Errorf("add node bridge_resumed_goal: %w", err)
+	}
+
+	if err := graph.AddLambdaNode("record_turn",
+		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
+			return nodex.RecordTurn(in, o.maxProcessedMessages)
+		}),
+	); err != nil {
+		return nil, fmt.Errorf("add node record_turn: %w", err)
+	}
+
+	if err := graph.AddLambdaNode("compact_transcript",
+		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
+			return nodex.CompactTranscript(ctx, in, o.models.Summarizer(), o.transcriptPolicy)
+		}),
+	); err != nil {
+		return nil, fmt.Errorf("add node compact_transcript: %w", err)
+	}
+
 	if err := graph.AddLambdaNode("validate_and_save_state",
 		compose.InvokableLambda(func(ctx context.Context, in *nodex.GraphState) (*nodex.GraphState, error) {
 			return nodex.ValidateAndSaveState(ctx, in, o.store)
@@ -96,12 +144,16 @@ func (o *Orchestrator) compileHandleMessageGraph(
 	edges := [][2]string{
 		{compose.START, "validate_request"},
 		{"validate_request", "load_or_create_state"},
-		{"load_or_create_state", "read_memory"},
-		{"read_memory", "plan_goal"},
+		{"load_or_create_state", "check_duplicate"},
+		{"read_memory", "retain_goals"},
+		{"retain_goals", "plan_goal"},
 		{"plan_goal", "apply_plan"},
 		{"apply_plan", "dispatch_specialist"},
 		{"dispatch_specialist", "apply_state_updates"},
-		{"apply_state_updates", "validate_and_save_state"},
+		{"apply_state_updates", "bridge_resumed_goal"},
+		{"bridge_resumed_goal", "record_turn"},
+		{"record_turn", "compact_transcript"},
+		{"compact_transcript", "validate_and_save_state"},
 		{"validate_and_save_state", "write_memory"},
 		{"write_memory", "finalize_reply"},
 		{"finalize_reply", compose.END},
@@ -113,6 +165,19 @@ func (o *Orchestrator) compileHandleMessageGraph(
 		}
 	}
 
+	// A replayed message id skips straight to the cached reply.
+	if err := graph.AddBranch("check_duplicate", compose.NewGraphBranch(
+		func(ctx context.Context, in *nodex.GraphState) (string, error) {
+			if in.Duplicate {
+				return "finalize_reply", nil
+			}
+			return "read_memory", nil
+		},
+		map[string]bool{"read_memory": true, "finalize_reply": true},
+	)); err != nil {
+		return nil, fmt.Errorf("add branch check_duplicate: %w", err)
+	}
+
 	runner, err := graph.Compile(ctx, compose.WithGraphName("orchestrator.handle_message"))
 	if err != nil {
 		return nil, fmt.Errorf("compile orchestrator graph: %w", err)
@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+var (
+	ErrInvalidRewind    = statex.ErrInvalidRewind
+	ErrSnapshotNotFound = statex.ErrSnapshotNotFound
+	// ErrRewindUnsupported means the state store keeps no prior snapshots.
+	ErrRewindUnsupported = errors.New("state store does not keep session snapshots")
+)
+
+// Rewind restores a session's goals, GoalStack and ActiveGoalID to how they
+// were before turn beforeTurn started, e.g. after the planner misrouted that
+// turn. The transcript keeps the undone turns, marked as rewound. Rewind holds
+// the session lock, so it never interleaves with a running turn.
+func (o *Orchestrator) Rewind(ctx context.Context, sessionID string, beforeTurn int) (*statex.SessionState, error) {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return nil, ErrInvalidSession
+	}
+	history, ok := o.store.(statex.SnapshotHistory)
+	if !ok {
+		return nil, ErrRewindUnsupported
+	}
+
+	lease, err := o.acquire(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = lease.Release(context.WithoutCancel(ctx))
+	}()
+	ctx, cancel := withLease(ctx, lease)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		st, err := o.rewindOnce(ctx, history, sessionID, beforeTurn)
+		if err == nil {
+			return st, nil
+		}
+		if cause := context.Cause(ctx); errors.Is(cause, ErrLeaseLost) {
+			return nil, cause
+		}
+		if !errors.Is(err, statex.ErrVersionConflict) || attempt >= o.maxConflictRetries {
+			return nil, err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+	}
+}
+
+func (o *Orchestrator) rewindOnce(
+	ctx context.Context,
+	history statex.SnapshotHistory,
+	sessionID string,
+	beforeTurn int,
+) (*statex.SessionState, error) {
+	st, err := o.store.Load(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := history.Snapshots(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshots: %w", err)
+	}
+	snapshot, err := st.SnapshotBefore(snapshots, beforeTurn)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.RewindTo(snapshot, beforeTurn, o.now()); err != nil {
+		return nil, err
+	}
+	if err := st.Validate(); err != nil {
+		return nil, fmt.Errorf("rewound state is invalid: %w", err)
+	}
+	if err := o.store.Save(ctx, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
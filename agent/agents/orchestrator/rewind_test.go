@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+func TestRewindRestoresGoalsBeforeMisroutedTurn(t *testing.T) {
+	t.Parallel()
+
+	store, err := statex.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("NewMemoryStore() error = %v", err)
+	}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalID: "g_sales", GoalType: "sales.recommend_item", Priority: 50},
+		},
+	}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "งบเท่าไหร่ครับ"}}}
+	support := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "เครื่องมีอาการอะไรครับ"}}}
+	o := newTestOrchestrator(t, store,
+		&fakeRegistry{planner: planner, sales: sales, support: support},
+		&fakeMemory{},
+	)
+
+	ctx := context.Background()
+	if _, err := o.HandleMessage(ctx, Message{SessionID: "session-r", Text: "อยากได้โน้ตบุ๊ก"}); err != nil {
+		t.Fatalf("HandleMessage() turn 1 error = %v", err)
+	}
+	planner.resp.Goal = contractx.GoalPatch{GoalID: "g_support", GoalType: "support.troubleshoot", Priority: 80}
+	if _, err := o.HandleMessage(ctx, Message{SessionID: "session-r", Text: "งบสามหมื่น"}); err != nil {
+		t.Fatalf("HandleMessage() turn 2 error = %v", err)
+	}
+
+	if _, err := o.Rewind(ctx, "session-r", 5); !errors.Is(err, ErrInvalidRewind) {
+		t.Fatalf("Rewind(turn 5) error = %v, want ErrInvalidRewind", err)
+	}
+
+	st, err := o.Rewind(ctx, "session-r", 2)
+	if err != nil {
+		t.Fatalf("Rewind() error = %v", err)
+	}
+	if st.ActiveGoalID != "g_sales" || len(st.GoalStack) != 1 || st.GoalStack[0] != "g_sales" {
+		t.Fatalf("expected g_sales restored, got active=%q stack=%v", st.ActiveGoalID, st.GoalStack)
+	}
+	if _, ok := st.Goals["g_support"]; ok {
+		t.Fatal("expected misrouted g_support goal to be gone")
+	}
+	if st.Turn != 2 || len(st.Transcript) != 4 {
+		t.Fatalf("expected turn counter and transcript kept, got turn=%d entries=%d", st.Turn, len(st.Transcript))
+	}
+	for _, e := range st.Transcript {
+		if e.Rewound != (e.Turn == 2) {
+			t.Fatalf("unexpected rewound mark on %+v", e)
+		}
+	}
+
+	loaded, err := store.Load(ctx, "session-r")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.ActiveGoalID != "g_sales" || loaded.Version != st.Version {
+		t.Fatalf("rewind not persisted: active=%q version=%d", loaded.ActiveGoalID, loaded.Version)
+	}
+}
+
+func TestRewindRequiresSnapshotHistory(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOrchestrator(t, &fakeStore{}, &fakeRegistry{}, &fakeMemory{})
+	if _, err := o.Rewind(context.Background(), "session-r", 1); !errors.Is(err, ErrRewindUnsupported) {
+		t.Fatalf("Rewind() error = %v, want ErrRewindUnsupported", err)
+	}
+}
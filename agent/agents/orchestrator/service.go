@@ -3,31 +3,150 @@ package orchestrator
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/cloudwego/eino/compose"
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
 	nodex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/nodes"
+	slotx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/slot"
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
 var (
-	ErrInvalidMessage = nodex.ErrInvalidMessage
-	ErrInvalidSession = nodex.ErrInvalidSession
-	ErrNoActiveGoal   = nodex.ErrNoActiveGoal
+	ErrInvalidMessage   = nodex.ErrInvalidMessage
+	ErrInvalidSession   = nodex.ErrInvalidSession
+	ErrNoActiveGoal     = nodex.ErrNoActiveGoal
+	ErrIdentityMismatch = nodex.ErrIdentityMismatch
+	ErrVersionConflict  = statex.ErrVersionConflict
+	ErrSessionBusy      = statex.ErrSessionBusy
+	ErrLeaseLost        = statex.ErrLeaseLost
 )
 
+// Message is one inbound customer message with the caller's identity.
+type Message = nodex.GraphInput
+
+// Config holds identity defaults for sessions created by messages that do not
+// carry their own. CustomerID is normally left empty so that anonymous sessions
+// keep memory per session instead of sharing one customer record, and take the
+// customer of the first message that names one.
 type Config struct {
-	WorkspaceID string
-	CustomerID  string
-	ChannelType string
+	WorkspaceID string `envconfig:"WORKSPACE_ID" split_words:"true"`
+	CustomerID  string `envconfig:"CUSTOMER_ID" split_words:"true"`
+	ChannelType string `envconfig:"CHANNEL_TYPE" split_words:"true"`
+
+	// MaxTranscriptEntries bounds the transcript kept in SessionState.
+	MaxTranscriptEntries int `envconfig:"MAX_TRANSCRIPT_ENTRIES" split_words:"true" default:"40"`
+	// SummaryTriggerTokens folds older turns into the conversation summary once
+	// the transcript estimate grows past it.
+	SummaryTriggerTokens int `envconfig:"SUMMARY_TRIGGER_TOKENS" split_words:"true" default:"2000"`
+	// SummaryKeepEntries is how many recent entries stay verbatim after summarizing.
+	SummaryKeepEntries int `envconfig:"SUMMARY_KEEP_ENTRIES" split_words:"true" default:"8"`
+
+	// MaxConflictRetries is how many times a turn is re-run against fresh state
+	// after a concurrent save wins the version check.
+	MaxConflictRetries int `envconfig:"MAX_CONFLICT_RETRIES" split_words:"true" default:"3"`
+
+	// LockWaitTimeout bounds how long a message waits behind earlier turns of
+	// the same session before failing with ErrSessionBusy.
+	LockWaitTimeout time.Duration `envconfig:"LOCK_WAIT_TIMEOUT" split_words:"true" default:"30s"`
+
+	// MaxProcessedMessages is how many recent message ids (with their replies)
+	// each session remembers for deduplicating channel retries.
+	MaxProcessedMessages int `envconfig:"MAX_PROCESSED_MESSAGES" split_words:"true" default:"50"`
+
+	// Goal retention. Unlike the settings above, zero disables a rule.
+	// GoalSuspendAfter suspends the active goal once it has been idle this long;
+	// GoalExpireAfter cancels and archives open goals idle this long. The
+	// ByType maps override them per goal type, e.g.
+	// "sales.recommend_item:2h,support.troubleshoot:30m".
+	GoalSuspendAfter       time.Duration            `envconfig:"GOAL_SUSPEND_AFTER" split_words:"true" default:"30m"`
+	GoalSuspendAfterByType map[string]time.Duration `envconfig:"GOAL_SUSPEND_AFTER_BY_TYPE" split_words:"true"`
+	GoalExpireAfter        time.Duration            `envconfig:"GOAL_EXPIRE_AFTER" split_words:"true" default:"24h"`
+	GoalExpireAfterByType  map[string]time.Duration `envconfig:"GOAL_EXPIRE_AFTER_BY_TYPE" split_words:"true"`
+	// MaxLiveGoals caps the open goals of a session; the longest idle ones
+	// beyond it expire.
+	MaxLiveGoals int `envconfig:"MAX_LIVE_GOALS" split_words:"true" default:"5"`
+	// MaxGoalHistory is how many archived goals each session keeps.
+	MaxGoalHistory int `envconfig:"MAX_GOAL_HISTORY" split_words:"true" default:"20"`
+
+	// InterleavePolicy decides when a new goal may interrupt the active one;
+	// see nodex.ParseInterleavePolicy, e.g.
+	// "priority+no_interrupt=sales.recommend_item+ask".
+	// InterleavePolicyByWorkspace overrides it per workspace, e.g.
+	// "shop-a:aging+max_depth,shop-b:priority+ask".
+	InterleavePolicy            string            `envconfig:"INTERLEAVE_POLICY" split_words:"true" default:"priority"`
+	InterleavePolicyByWorkspace map[string]string `envconfig:"INTERLEAVE_POLICY_BY_WORKSPACE" split_words:"true"`
+}
+
+const (
+	defaultMaxTranscriptEntries = 40
+	defaultSummaryTriggerTokens = 2000
+	defaultSummaryKeepEntries   = 8
+	defaultMaxConflictRetries   = 3
+	defaultLockWaitTimeout      = 30 * time.Second
+	defaultMaxProcessedMessages = 50
+)
+
+// Option customizes an Orchestrator.
+type Option func(*Orchestrator)
+
+// WithLocker replaces the default in-process session locker, e.g. with a
+// Redis lease lock when several instances serve the same sessions.
+func WithLocker(locker statex.Locker) Option {
+	return func(o *Orchestrator) {
+		if locker != nil {
+			o.locker = locker
+		}
+	}
+}
+
+// WithInterleavePolicy sets the interleave policy for sessions of workspaceID,
+// or the default policy when workspaceID is empty.
+func WithInterleavePolicy(workspaceID string, policy nodex.InterleavePolicy) Option {
+	return func(o *Orchestrator) {
+		if policy == nil {
+			return
+		}
+		if workspaceID = strings.TrimSpace(workspaceID); workspaceID == "" {
+			o.interleave = policy
+			return
+		}
+		o.workspaceInterleave[workspaceID] = policy
+	}
+}
+
+// WithSlotSchemas replaces the built-in slot schemas used to validate slots and
+// compute missing slots per goal type.
+func WithSlotSchemas(schemas *slotx.Registry) Option {
+	return func(o *Orchestrator) {
+		if schemas != nil {
+			o.slotSchemas = schemas
+		}
+	}
+}
+
+// WithGoalMachine makes every session check its goal status changes against m,
+// with its guards and hooks, instead of the default machine. m is shared by all
+// sessions, so configure it fully before the orchestrator handles messages.
+func WithGoalMachine(m *statex.GoalMachine) Option {
+	return func(o *Orchestrator) {
+		o.goalMachine = m
+	}
 }
 
 type Orchestrator struct {
 	store  statex.Store
 	models contractx.Registry
 	memory contractx.MemoryStore
+	locker statex.Locker
+
+	slotSchemas *slotx.Registry
+	goalMachine *statex.GoalMachine
+
+	interleave          nodex.InterleavePolicy
+	workspaceInterleave map[string]nodex.InterleavePolicy
 
 	graphRunner compose.Runnable[nodex.GraphInput, nodex.GraphOutput]
 
@@ -35,6 +154,13 @@ type Orchestrator struct {
 	customerID  string
 	channelType string
 
+	transcriptPolicy   nodex.TranscriptPolicy
+	retentionPolicy    nodex.GoalRetentionPolicy
+	maxConflictRetries int
+	lockWaitTimeout    time.Duration
+
+	maxProcessedMessages int
+
 	now func() time.Time
 }
 
@@ -43,6 +169,7 @@ func New(
 	models contractx.Registry,
 	memory contractx.MemoryStore,
 	cfg Config,
+	opts ...Option,
 ) (*Orchestrator, error) {
 	if store == nil {
 		return nil, errors.New("state store is required")
@@ -59,22 +186,82 @@ func New(
 		workspaceID = "default-workspace"
 	}
 	customerID := strings.TrimSpace(cfg.CustomerID)
-	if customerID == "" {
-		customerID = "default-customer"
-	}
 	channelType := strings.TrimSpace(cfg.ChannelType)
 	if channelType == "" {
 		channelType = "chat"
 	}
+	transcriptPolicy := nodex.TranscriptPolicy{
+		MaxEntries:           cfg.MaxTranscriptEntries,
+		SummaryTriggerTokens: cfg.SummaryTriggerTokens,
+		SummaryKeepEntries:   cfg.SummaryKeepEntries,
+	}
+	if transcriptPolicy.MaxEntries <= 0 {
+		transcriptPolicy.MaxEntries = defaultMaxTranscriptEntries
+	}
+	if transcriptPolicy.SummaryTriggerTokens <= 0 {
+		transcriptPolicy.SummaryTriggerTokens = defaultSummaryTriggerTokens
+	}
+	if transcriptPolicy.SummaryKeepEntries <= 0 {
+		transcriptPolicy.SummaryKeepEntries = defaultSummaryKeepEntries
+	}
+	retentionPolicy := nodex.GoalRetentionPolicy{
+		SuspendAfter: nodex.GoalTimeouts{Default: cfg.GoalSuspendAfter, ByType: cfg.GoalSuspendAfterByType},
+		ExpireAfter:  nodex.GoalTimeouts{Default: cfg.GoalExpireAfter, ByType: cfg.GoalExpireAfterByType},
+		MaxLiveGoals: cfg.MaxLiveGoals,
+		MaxHistory:   cfg.MaxGoalHistory,
+	}
+	interleave, err := nodex.ParseInterleavePolicy(cfg.InterleavePolicy)
+	if err != nil {
+		return nil, err
+	}
+	workspaceInterleave := make(map[string]nodex.InterleavePolicy, len(cfg.InterleavePolicyByWorkspace))
+	for ws, spec := range cfg.InterleavePolicyByWorkspace {
+		policy, err := nodex.ParseInterleavePolicy(spec)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %s: %w", ws, err)
+		}
+		workspaceInterleave[strings.TrimSpace(ws)] = policy
+	}
+	maxConflictRetries := cfg.MaxConflictRetries
+	if maxConflictRetries <= 0 {
+		maxConflictRetries = defaultMaxConflictRetries
+	}
+	lockWaitTimeout := cfg.LockWaitTimeout
+	if lockWaitTimeout <= 0 {
+		lockWaitTimeout = defaultLockWaitTimeout
+	}
+	maxProcessedMessages := cfg.MaxProcessedMessages
+	if maxProcessedMessages <= 0 {
+		maxProcessedMessages = defaultMaxProcessedMessages
+	}
 
 	o := &Orchestrator{
 		store:       store,
 		models:      models,
 		memory:      memory,
+		locker:      statex.NewMemoryLocker(),
+		slotSchemas: slotx.DefaultRegistry(),
+
+		interleave:          interleave,
+		workspaceInterleave: workspaceInterleave,
+
 		workspaceID: workspaceID,
 		customerID:  customerID,
 		channelType: channelType,
-		now:         time.Now,
+
+		transcriptPolicy:   transcriptPolicy,
+		retentionPolicy:    retentionPolicy,
+		maxConflictRetries: maxConflictRetries,
+		lockWaitTimeout:    lockWaitTimeout,
+
+		maxProcessedMessages: maxProcessedMessages,
+
+		now: time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
 	}
 
 	graphRunner, err := o.compileHandleMessageGraph(context.Background())
@@ -86,15 +273,78 @@ func New(
 	return o, nil
 }
 
-func (o *Orchestrator) HandleMessage(ctx context.Context, sessionID string, text string) (string, error) {
-	out, err := o.graphRunner.Invoke(ctx, nodex.GraphInput{
-		SessionID: sessionID,
-		Text:      text,
-	})
-	if err != nil {
-		return "", err
+// HandleMessage runs one turn. Turns of the same session run one at a time in
+// arrival order; a message that waits longer than lockWaitTimeout fails with
+// ErrSessionBusy. When the save still loses a version race the whole turn is
+// re-run against freshly loaded state, up to maxConflictRetries times. A turn
+// whose lock is lost while it runs is cancelled with ErrLeaseLost.
+func (o *Orchestrator) HandleMessage(ctx context.Context, msg Message) (string, error) {
+	if sessionID := strings.TrimSpace(msg.SessionID); sessionID != "" {
+		lease, err := o.acquire(ctx, sessionID)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = lease.Release(context.WithoutCancel(ctx))
+		}()
+		var cancel context.CancelFunc
+		ctx, cancel = withLease(ctx, lease)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		out, err := o.graphRunner.Invoke(ctx, msg)
+		if err == nil {
+			return out.Reply, nil
+		}
+		if cause := context.Cause(ctx); errors.Is(cause, ErrLeaseLost) {
+			return "", cause
+		}
+		if !errors.Is(err, statex.ErrVersionConflict) || attempt >= o.maxConflictRetries {
+			return "", err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+	}
+}
+
+// interleavePolicy returns the policy for sessions of workspaceID.
+func (o *Orchestrator) interleavePolicy(workspaceID string) nodex.InterleavePolicy {
+	if policy, ok := o.workspaceInterleave[workspaceID]; ok {
+		return policy
 	}
-	return out.Reply, nil
+	return o.interleave
+}
+
+func (o *Orchestrator) acquire(ctx context.Context, sessionID string) (*statex.Lease, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, o.lockWaitTimeout)
+	defer cancel()
+
+	lease, err := o.locker.Lock(lockCtx, sessionID)
+	if err == nil {
+		return lease, nil
+	}
+	if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: session=%s waited %s", ErrSessionBusy, sessionID, o.lockWaitTimeout)
+	}
+	return nil, err
+}
+
+// withLease returns a copy of ctx that is cancelled with ErrLeaseLost once
+// lease is lost, so the turn stops before it can overwrite a newer one. Its
+// saves carry the lease token, so a save that still races a newer lease is
+// rejected by the store.
+func withLease(ctx context.Context, lease *statex.Lease) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(statex.WithFencingToken(ctx, lease.Token))
+	go func() {
+		select {
+		case <-lease.Lost():
+			cancel(fmt.Errorf("%w: session=%s token=%d", ErrLeaseLost, lease.SessionID, lease.Token))
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
 }
 
 type noopMemoryStore struct{}
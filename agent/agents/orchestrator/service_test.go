@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	slotx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/slot"
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
@@ -18,9 +21,14 @@ type fakeStore struct {
 	loadErr   error
 	saveErr   error
 	saved     []*statex.SessionState
+	loads     int
+
+	// conflicts fails that many saves with ErrVersionConflict before succeeding.
+	conflicts int
 }
 
 func (f *fakeStore) Load(ctx context.Context, sessionID string) (*statex.SessionState, error) {
+	f.loads++
 	if f.loadErr != nil {
 		return nil, f.loadErr
 	}
@@ -34,6 +42,10 @@ func (f *fakeStore) Save(ctx context.Context, st *statex.SessionState) error {
 	if f.saveErr != nil {
 		return f.saveErr
 	}
+	if f.conflicts > 0 {
+		f.conflicts--
+		return fmt.Errorf("%w: session=%s", statex.ErrVersionConflict, st.SessionID)
+	}
 	f.saved = append(f.saved, cloneSessionState(st))
 	return nil
 }
@@ -70,13 +82,15 @@ func (f *fakeMemory) WriteSummary(ctx context.Context, customerID string, update
 }
 
 type fakePlanner struct {
-	resp  contractx.PlannerResponse
-	err   error
-	calls int
+	resp    contractx.PlannerResponse
+	err     error
+	calls   int
+	lastReq contractx.PlannerRequest
 }
 
 func (f *fakePlanner) Plan(ctx context.Context, req contractx.PlannerRequest) (contractx.PlannerResponse, error) {
 	f.calls++
+	f.lastReq = req
 	if f.err != nil {
 		return contractx.PlannerResponse{}, f.err
 	}
@@ -103,10 +117,25 @@ func (f *fakeSpecialist) Run(ctx context.Context, req contractx.SpecialistReques
 	return f.responses[idx], nil
 }
 
+type fakeSummarizer struct {
+	summary  string
+	err      error
+	lastReqs []contractx.SummarizeRequest
+}
+
+func (f *fakeSummarizer) Summarize(ctx context.Context, req contractx.SummarizeRequest) (contractx.SummarizeResponse, error) {
+	f.lastReqs = append(f.lastReqs, req)
+	if f.err != nil {
+		return contractx.SummarizeResponse{}, f.err
+	}
+	return contractx.SummarizeResponse{Summary: f.summary}, nil
+}
+
 type fakeRegistry struct {
-	planner contractx.Planner
-	sales   contractx.Specialist
-	support contractx.Specialist
+	planner    contractx.Planner
+	sales      contractx.Specialist
+	support    contractx.Specialist
+	summarizer contractx.Summarizer
 }
 
 func (f *fakeRegistry) Planner() contractx.Planner {
@@ -121,6 +150,10 @@ func (f *fakeRegistry) Support() contractx.Specialist {
 	return f.support
 }
 
+func (f *fakeRegistry) Summarizer() contractx.Summarizer {
+	return f.summarizer
+}
+
 func TestHandleMessageInvalidInput(t *testing.T) {
 	t.Parallel()
 
@@ -134,12 +167,12 @@ func TestHandleMessageInvalidInput(t *testing.T) {
 		&fakeMemory{},
 	)
 
-	_, err := o.HandleMessage(context.Background(), "   ", "hello")
+	_, err := o.HandleMessage(context.Background(), Message{SessionID: "   ", Text: "hello"})
 	if !errors.Is(err, ErrInvalidSession) {
 		t.Fatalf("expected ErrInvalidSession, got %v", err)
 	}
 
-	_, err = o.HandleMessage(context.Background(), "s1", "    ")
+	_, err = o.HandleMessage(context.Background(), Message{SessionID: "s1", Text: "    "})
 	if !errors.Is(err, ErrInvalidMessage) {
 		t.Fatalf("expected ErrInvalidMessage, got %v", err)
 	}
@@ -180,7 +213,7 @@ func TestHandleMessageNoToolPath(t *testing.T) {
 		memory,
 	)
 
-	reply, err := o.HandleMessage(context.Background(), "session-1", "แนะนำเมาส์เกมมิ่งหน่อย")
+	reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-1", Text: "แนะนำเมาส์เกมมิ่งหน่อย"})
 	if err != nil {
 		t.Fatalf("HandleMessage() error = %v", err)
 	}
@@ -233,7 +266,7 @@ func TestHandleMessageToolPassPath(t *testing.T) {
 		&fakeMemory{},
 	)
 
-	reply, err := o.HandleMessage(context.Background(), "session-2", "หาเมาส์เกมมิ่งงบ 1500")
+	reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-2", Text: "หาเมาส์เกมมิ่งงบ 1500"})
 	if err != nil {
 		t.Fatalf("HandleMessage() error = %v", err)
 	}
@@ -269,7 +302,7 @@ func TestHandleMessageEmptySpecialistMessage(t *testing.T) {
 		&fakeMemory{},
 	)
 
-	_, err := o.HandleMessage(context.Background(), "session-3", "hello")
+	_, err := o.HandleMessage(context.Background(), Message{SessionID: "session-3", Text: "hello"})
 	if !errors.Is(err, contractx.ErrValidation) {
 		t.Fatalf("expected ErrValidation, got %v", err)
 	}
@@ -320,21 +353,25 @@ func TestHandleMessageMarkDoneResumesPreviousGoal(t *testing.T) {
 		},
 	}
 
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "กลับมาที่ปัญหาเครื่องกันต่อไหมครับ"}},
+	}
+
 	o := newTestOrchestrator(t,
 		store,
 		&fakeRegistry{
 			planner: planner,
 			sales:   sales,
-			support: &fakeSpecialist{},
+			support: support,
 		},
 		&fakeMemory{},
 	)
 
-	reply, err := o.HandleMessage(context.Background(), "session-4", "ขอบคุณ")
+	reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-4", Text: "ขอบคุณ"})
 	if err != nil {
 		t.Fatalf("HandleMessage() error = %v", err)
 	}
-	if reply != "จัดการเรียบร้อยแล้ว" {
+	if reply != "จัดการเรียบร้อยแล้ว\n\nกลับมาที่ปัญหาเครื่องกันต่อไหมครับ" {
 		t.Fatalf("unexpected reply: %q", reply)
 	}
 	if len(store.saved) != 1 {
@@ -353,111 +390,1977 @@ func TestHandleMessageMarkDoneResumesPreviousGoal(t *testing.T) {
 	}
 }
 
-func TestHandleMessageSaveErrorPropagates(t *testing.T) {
+func TestHandleMessageAnnouncesResumedGoal(t *testing.T) {
 	t.Parallel()
 
-	saveErr := errors.New("save failed")
-	store := &fakeStore{
-		loadErr: statex.ErrStateNotFound,
-		saveErr: saveErr,
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-resume", "workspace", "customer", "chat", now)
+
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.Status = statex.GoalSuspended
+	laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+	laptop.NextQuestion = "ใช้งานแบบไหนครับ"
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+	screen.Slots = map[string]any{"device_model": "X13", "symptom": "จอกระพริบ"}
+
+	for _, g := range []*statex.Goal{laptop, screen} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+		}
 	}
-	memory := &fakeMemory{}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{laptop.ID, screen.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalID: "g_screen", GoalType: "support.troubleshoot", Priority: 100},
+		},
+	}
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{
+			Message:      "อัปเดตไดรเวอร์จอแล้วอาการหายครับ",
+			StateUpdates: contractx.StateUpdates{MarkDone: true},
+		}},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "เรื่องจอเรียบร้อยแล้ว ไปต่อเรื่องโน้ตบุ๊กงบ 35k กันไหมครับ"}},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: support},
+		&fakeMemory{},
+	)
+
+	reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-resume", Text: "หายแล้วครับ", MessageID: "m1"})
+	if err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	want := "อัปเดตไดรเวอร์จอแล้วอาการหายครับ\n\nเรื่องจอเรียบร้อยแล้ว ไปต่อเรื่องโน้ตบุ๊กงบ 35k กันไหมครับ"
+	if reply != want {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	if sales.calls != 1 {
+		t.Fatalf("expected one sales bridge call, got %d", sales.calls)
+	}
+	req := sales.lastReqs[0]
+	if req.ActiveGoal == nil || req.ActiveGoal.ID != "g_laptop" || req.ActiveGoal.Slots["budget"] != float64(35000) || req.ActiveGoal.NextQuestion != "ใช้งานแบบไหนครับ" {
+		t.Fatalf("expected the bridge to see the laptop goal, got %+v", req.ActiveGoal)
+	}
+	if req.FinishedGoal == nil || req.FinishedGoal.ID != "g_screen" || req.FinishedGoal.Status != statex.GoalDone {
+		t.Fatalf("expected the finished screen goal, got %+v", req.FinishedGoal)
+	}
+
+	saved := store.saved[0]
+	if saved.ActiveGoalID != "g_laptop" || saved.Goals["g_laptop"].Status == statex.GoalSuspended {
+		t.Fatalf("expected g_laptop resumed, got active=%s status=%s", saved.ActiveGoalID, saved.Goals["g_laptop"].Status)
+	}
+	n := len(saved.Transcript)
+	if n < 2 || saved.Transcript[n-2].GoalID != "g_screen" || saved.Transcript[n-1].GoalID != "g_laptop" {
+		t.Fatalf("expected the answer and the bridge attributed to their goals, got %+v", saved.Transcript)
+	}
+	if cached, ok := saved.ProcessedReply("m1"); !ok || cached != want {
+		t.Fatalf("expected the full reply cached, got %q", cached)
+	}
+}
+
+func TestHandleMessageBridgeFallsBackToNextQuestion(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-bridge", "workspace", "customer", "chat", now)
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.Status = statex.GoalSuspended
+	laptop.NextQuestion = "งบประมาณเท่าไหร่ครับ"
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+	screen.Slots = map[string]any{"device_model": "X13", "symptom": "จอกระพริบ"}
+	for _, g := range []*statex.Goal{laptop, screen} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+		}
+	}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{laptop.ID, screen.ID}
 
+	store := &fakeStore{loadState: st}
 	o := newTestOrchestrator(t,
 		store,
 		&fakeRegistry{
-			planner: &fakePlanner{
-				resp: contractx.PlannerResponse{
-					Goal: contractx.GoalPatch{
-						GoalType: "sales.recommend_item",
-						Priority: 50,
-					},
-				},
-			},
-			sales: &fakeSpecialist{
-				responses: []contractx.SpecialistResponse{
-					{Message: "ok"},
-				},
-			},
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{GoalID: "g_screen", GoalType: "support.troubleshoot", Priority: 100},
+			}},
+			sales: &fakeSpecialist{err: contractx.ErrModelInvoke},
+			support: &fakeSpecialist{responses: []contractx.SpecialistResponse{{
+				Message:      "หายแล้วครับ",
+				StateUpdates: contractx.StateUpdates{MarkDone: true},
+			}}},
+		},
+		&fakeMemory{},
+	)
+
+	reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-bridge", Text: "ใช้ได้แล้ว"})
+	if err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if reply != "หายแล้วครับ\n\nงบประมาณเท่าไหร่ครับ" {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if len(store.saved) != 1 || store.saved[0].ActiveGoalID != "g_laptop" {
+		t.Fatalf("expected the turn saved with g_laptop resumed, got %d saves", len(store.saved))
+	}
+}
+
+func TestHandleMessageCancelsGoalAndResumesPrevious(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-cancel", "workspace", "customer", "chat", now)
+
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.Status = statex.GoalSuspended
+	laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+
+	for _, g := range []*statex.Goal{laptop, screen} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+		}
+	}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{laptop.ID, screen.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{CancelGoalIDs: []string{"g_screen"}},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "ได้ครับ กลับมาที่โน้ตบุ๊กกันต่อ"},
+		},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: planner,
+			sales:   sales,
 			support: &fakeSpecialist{},
 		},
-		memory,
+		&fakeMemory{},
 	)
 
-	_, err := o.HandleMessage(context.Background(), "session-5", "hello")
-	if !errors.Is(err, saveErr) {
-		t.Fatalf("expected save error, got %v", err)
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-cancel", Text: "ไม่เป็นไร ลืมเรื่องจอไปเถอะ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
 	}
-	if len(memory.writes) != 0 {
-		t.Fatalf("memory write must not be called on save error, got %d", len(memory.writes))
+	if sales.calls != 1 || sales.lastReqs[0].ActiveGoal.ID != "g_laptop" {
+		t.Fatalf("expected the sales specialist to continue g_laptop, calls=%d", sales.calls)
+	}
+
+	saved := store.saved[0]
+	if saved.Goals["g_screen"].Status != statex.GoalCancelled {
+		t.Fatalf("expected g_screen cancelled, got %s", saved.Goals["g_screen"].Status)
+	}
+	if saved.ActiveGoalID != "g_laptop" || saved.Goals["g_laptop"].Status != statex.GoalActive {
+		t.Fatalf("expected g_laptop resumed, got active=%s status=%s", saved.ActiveGoalID, saved.Goals["g_laptop"].Status)
+	}
+	if len(saved.GoalStack) != 1 || saved.GoalStack[0] != "g_laptop" {
+		t.Fatalf("expected stack [g_laptop], got %v", saved.GoalStack)
 	}
 }
 
-func TestHandleMessageWriteMemoryErrorPropagates(t *testing.T) {
+func TestHandleMessageSkipsCancellingUnknownGoals(t *testing.T) {
 	t.Parallel()
 
-	writeErr := errors.New("write memory failed")
-	memory := &fakeMemory{
-		writeErr: writeErr,
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-cancel-unknown", "workspace", "customer", "chat", now)
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+	if err := st.AddGoal(screen); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{screen.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{CancelGoalIDs: []string{"g_made_up"}},
+	}
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "จอยังดับอยู่ไหมครับ"}},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: &fakeSpecialist{}, support: support},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-cancel-unknown", Text: "ยกเลิกอันนั้น"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if support.calls != 1 || support.lastReqs[0].ActiveGoal.ID != "g_screen" {
+		t.Fatalf("expected the support specialist to continue g_screen, calls=%d", support.calls)
+	}
+	if saved := store.saved[0]; saved.ActiveGoalID != "g_screen" || len(saved.Goals) != 1 {
+		t.Fatalf("expected the session untouched, got active=%s goals=%d", saved.ActiveGoalID, len(saved.Goals))
+	}
+}
+
+func TestHandleMessageSwitchesBackToEarlierGoal(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-switch", "workspace", "customer", "chat", now)
+
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.Status = statex.GoalSuspended
+	laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+	mouse := statex.CreateGoal("g_mouse", "sales.recommend_item", 60, now)
+	mouse.Status = statex.GoalSuspended
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+
+	for _, g := range []*statex.Goal{laptop, mouse, screen} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+		}
+	}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{laptop.ID, mouse.ID, screen.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalID:   "g_laptop",
+				GoalType: "sales.recommend_item",
+				Priority: 50,
+				SwitchTo: true,
+			},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "กลับมาที่โน้ตบุ๊กครับ"},
+		},
 	}
-	store := &fakeStore{loadErr: statex.ErrStateNotFound}
 
 	o := newTestOrchestrator(t,
 		store,
 		&fakeRegistry{
-			planner: &fakePlanner{
-				resp: contractx.PlannerResponse{
-					Goal: contractx.GoalPatch{
-						GoalType: "sales.recommend_item",
-						Priority: 50,
-					},
-				},
+			planner: planner,
+			sales:   sales,
+			support: &fakeSpecialist{},
+		},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-switch", Text: "กลับไปเรื่องแรกที่คุยกันเถอะ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if sales.calls != 1 || sales.lastReqs[0].ActiveGoal.ID != "g_laptop" {
+		t.Fatalf("expected the sales specialist to handle g_laptop, calls=%d", sales.calls)
+	}
+
+	saved := store.saved[0]
+	if saved.ActiveGoalID != "g_laptop" || saved.Goals["g_laptop"].Status != statex.GoalActive {
+		t.Fatalf("expected g_laptop active, got active=%s status=%s", saved.ActiveGoalID, saved.Goals["g_laptop"].Status)
+	}
+	if saved.Goals["g_screen"].Status != statex.GoalSuspended {
+		t.Fatalf("expected g_screen suspended, got %s", saved.Goals["g_screen"].Status)
+	}
+	if got := strings.Join(saved.GoalStack, ","); got != "g_mouse,g_screen,g_laptop" {
+		t.Fatalf("unexpected stack %s", got)
+	}
+}
+
+func TestHandleMessageComputesMissingFromSlotSchema(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalType:   "sales.recommend_item",
+				Priority:   50,
+				SlotsPatch: map[string]any{"category": "mouse"},
+				// The schema, not the planner, decides what is missing.
+				Missing:      []string{"color"},
+				NextQuestion: "ชอบสีอะไรครับ",
 			},
-			sales: &fakeSpecialist{
-				responses: []contractx.SpecialistResponse{
-					{Message: "ok"},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{
+				Message: "งบประมาณประมาณเท่าไหร่ครับ",
+				StateUpdates: contractx.StateUpdates{
+					SetStatus: string(statex.GoalActive),
 				},
 			},
-			support: &fakeSpecialist{},
 		},
-		memory,
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
 	)
 
-	_, err := o.HandleMessage(context.Background(), "session-6", "hello")
-	if !errors.Is(err, writeErr) {
-		t.Fatalf("expected write memory error, got %v", err)
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-schema", Text: "อยากได้เมาส์"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
 	}
-	if len(store.saved) != 1 {
-		t.Fatalf("expected state already saved before memory error, got %d", len(store.saved))
+
+	goal := sales.lastReqs[0].ActiveGoal
+	if strings.Join(goal.Missing, ",") != "budget" || goal.NextQuestion != "งบประมาณประมาณเท่าไหร่ครับ" {
+		t.Fatalf("specialist saw missing=%v next_question=%q", goal.Missing, goal.NextQuestion)
+	}
+	saved := store.saved[0].Goals[goal.ID]
+	if saved.Status != statex.GoalBlocked {
+		t.Fatalf("expected the goal to stay blocked on budget, got %s", saved.Status)
 	}
-}
 
-func newTestOrchestrator(
-	t *testing.T,
-	store statex.Store,
-	registry contractx.Registry,
-	memory contractx.MemoryStore,
-) *Orchestrator {
-	t.Helper()
-	o, err := New(store, registry, memory, Config{})
-	if err != nil {
-		t.Fatalf("New() error = %v", err)
+	// A value the schema rejects is dropped, so the slot is asked for again
+	// instead of failing the turn.
+	planner.resp.Goal.SlotsPatch = map[string]any{"category": "mouse", "budget": "cheap"}
+	sales.responses = append(sales.responses, sales.responses[0])
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-schema-2", Text: "ถูกๆ"}); err != nil {
+		t.Fatalf("HandleMessage() with an invalid slot error = %v", err)
+	}
+	goal = sales.lastReqs[1].ActiveGoal
+	if _, ok := goal.Slots["budget"]; ok || strings.Join(goal.Missing, ",") != "budget" {
+		t.Fatalf("expected the invalid budget to be dropped and asked again, got slots=%v missing=%v", goal.Slots, goal.Missing)
+	}
+	if planner.lastReq.SlotSchemas != slotx.DefaultRegistry().Describe() {
+		t.Fatalf("planner saw slot schemas %q", planner.lastReq.SlotSchemas)
 	}
-	return o
 }
 
-func cloneSessionState(in *statex.SessionState) *statex.SessionState {
-	if in == nil {
-		return nil
+func TestHandleMessageRecordsNormalizedSlotsWithProvenance(t *testing.T) {
+	t.Parallel()
+
+	confidence := 0.8
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalType:   "sales.recommend_item",
+				Priority:   50,
+				SlotsPatch: map[string]any{"category": "laptop", "budget": "สามหมื่นห้า"},
+				SlotSources: map[string]contractx.SlotProvenance{
+					"budget": {Source: statex.SlotSourceUser},
+				},
+			},
+		},
 	}
-	raw, err := json.Marshal(in)
-	if err != nil {
-		panic(err)
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{
+		Message: "มีหลายรุ่นครับ",
+		StateUpdates: contractx.StateUpdates{
+			SlotsPatch: map[string]any{"candidates": []any{"A", "B"}},
+			SlotSources: map[string]contractx.SlotProvenance{
+				"candidates": {Source: statex.SlotSourceTool, Confidence: &confidence},
+			},
+		},
+	}}}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-normalize", Text: "โน้ตบุ๊กงบสามหมื่นห้า"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
 	}
-	var out statex.SessionState
-	if err := json.Unmarshal(raw, &out); err != nil {
-		panic(err)
+
+	goal := store.saved[0].ActiveGoal()
+	if goal.Slots["budget"] != float64(35000) || goal.SlotMeta["budget"].Raw != "สามหมื่นห้า" {
+		t.Fatalf("budget=%v meta=%+v", goal.Slots["budget"], goal.SlotMeta["budget"])
+	}
+	if goal.Status != statex.GoalActive {
+		t.Fatalf("expected the goal active once budget is known, got %s", goal.Status)
+	}
+
+	for name, want := range map[string]statex.SlotSource{
+		"budget":     statex.SlotSourceUser,
+		"category":   statex.SlotSourcePlanner,
+		"candidates": statex.SlotSourceTool,
+	} {
+		meta := goal.SlotMeta[name]
+		if meta.Source != want || meta.Turn != 1 || meta.At.IsZero() {
+			t.Errorf("%s meta = %+v, want source %s in turn 1", name, meta, want)
+		}
+	}
+	if c := goal.SlotMeta["candidates"].Confidence; c == nil || *c != confidence {
+		t.Errorf("candidates confidence = %v, want %v", c, confidence)
+	}
+}
+
+func TestHandleMessageNormalizesAmountsWithoutSchema(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalType:   "sales.compare_products",
+				Priority:   50,
+				SlotsPatch: map[string]any{"budget": "35k", "products": "A กับ B"},
+			},
+		},
+	}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "เทียบให้ครับ"}}}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-generic", Text: "เทียบ A กับ B งบ 35k"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	goal := store.saved[0].ActiveGoal()
+	if goal.Slots["budget"] != float64(35000) || goal.SlotMeta["budget"].Raw != "35k" {
+		t.Fatalf("budget=%v meta=%+v", goal.Slots["budget"], goal.SlotMeta["budget"])
+	}
+	if goal.Slots["products"] != "A กับ B" || goal.SlotMeta["products"].Raw != "" {
+		t.Fatalf("products=%v meta=%+v", goal.Slots["products"], goal.SlotMeta["products"])
+	}
+}
+
+func TestHandleMessageKeepsSlotMetaForRepeatedValues(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalType:   "sales.compare_products",
+				Priority:   50,
+				SlotsPatch: map[string]any{"products": "A กับ B"},
+			},
+		},
+	}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "งบเท่าไหร่ครับ"}, {Message: "เทียบให้ครับ"}}}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-meta", Text: "เทียบ A กับ B"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	store.loadState = store.saved[0]
+	goalID := store.loadState.ActiveGoalID
+
+	planner.resp.Goal.GoalID = goalID
+	planner.resp.Goal.SlotsPatch = map[string]any{"products": "A กับ B", "budget": "35k"}
+	planner.resp.Goal.SlotSources = map[string]contractx.SlotProvenance{
+		"products": {Source: statex.SlotSourceUser},
+	}
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-meta", Text: "งบ 35k"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	goal := store.saved[1].Goals[goalID]
+	if meta := goal.SlotMeta["products"]; meta.Turn != 1 || meta.Source != statex.SlotSourcePlanner {
+		t.Fatalf("a repeated value must keep its meta, got %+v", meta)
+	}
+	if meta := goal.SlotMeta["budget"]; meta.Turn != 2 || meta.Raw != "35k" {
+		t.Fatalf("budget meta = %+v, want turn 2", meta)
+	}
+}
+
+func TestHandleMessageConfirmsCriticalSlotsBeforeActing(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalType:   "sales.recommend_item",
+				Priority:   50,
+				SlotsPatch: map[string]any{"category": "laptop", "budget": "35k"},
+			},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "ขอยืนยันนะครับ งบ 35,000 บาทใช่ไหมครับ"},
+			{Message: "งบ 30,000 บาทใช่ไหมครับ"},
+			{Message: "รุ่นที่แนะนำคือ ..."},
+		},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+	send := func(text string) *statex.Goal {
+		t.Helper()
+		if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-confirm", Text: text}); err != nil {
+			t.Fatalf("HandleMessage(%q) error = %v", text, err)
+		}
+		store.loadErr, store.loadState = nil, store.saved[len(store.saved)-1]
+		return sales.lastReqs[len(sales.lastReqs)-1].ActiveGoal
+	}
+
+	if goal := send("โน้ตบุ๊กงบ 35k"); strings.Join(goal.PendingConfirm, ",") != "budget" {
+		t.Fatalf("expected budget pending confirmation, got %v", goal.PendingConfirm)
+	}
+
+	// A correction replaces the value and asks again.
+	planner.resp.Goal = contractx.GoalPatch{
+		GoalID:        store.loadState.ActiveGoalID,
+		GoalType:      "sales.recommend_item",
+		Priority:      50,
+		SlotsPatch:    map[string]any{"budget": "30,000"},
+		Confirmations: map[string]bool{"budget": false},
+	}
+	if goal := send("ไม่ใช่ 30,000"); goal.Slots["budget"] != float64(30000) || strings.Join(goal.PendingConfirm, ",") != "budget" {
+		t.Fatalf("expected corrected budget pending again, got budget=%v pending=%v", goal.Slots["budget"], goal.PendingConfirm)
+	}
+
+	planner.resp.Goal = contractx.GoalPatch{
+		GoalID:        store.loadState.ActiveGoalID,
+		GoalType:      "sales.recommend_item",
+		Priority:      50,
+		Confirmations: map[string]bool{"budget": true},
+	}
+	if goal := send("ใช่ครับ"); goal.IsConfirming() || goal.Slots["budget"] != float64(30000) {
+		t.Fatalf("expected confirmed budget, got budget=%v pending=%v", goal.Slots["budget"], goal.PendingConfirm)
+	}
+}
+
+func TestHandleMessageRejectedConfirmationAsksAgain(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-reject", "workspace", "customer", "chat", now)
+	goal := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	goal.Slots = map[string]any{"category": "laptop", "budget": 35000}
+	goal.PendingConfirm = []string{"budget"}
+	if err := st.AddGoal(goal); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = goal.ID
+	st.GoalStack = []string{goal.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalID:        "g_laptop",
+				GoalType:      "sales.recommend_item",
+				Priority:      50,
+				Confirmations: map[string]bool{"budget": false},
+			},
+		},
+	}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "งบประมาณประมาณเท่าไหร่ครับ"}}}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-reject", Text: "ไม่ใช่ครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	saved := store.saved[0].Goals["g_laptop"]
+	if saved.Status != statex.GoalBlocked || strings.Join(saved.Missing, ",") != "budget" || saved.IsConfirming() {
+		t.Fatalf("expected budget asked again, got status=%s missing=%v pending=%v", saved.Status, saved.Missing, saved.PendingConfirm)
+	}
+}
+
+func TestHandleMessageMarkDoneWaitsForPendingConfirmation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		updates contractx.StateUpdates
+		wantErr bool
+	}{
+		{
+			name:    "unconfirmed",
+			updates: contractx.StateUpdates{MarkDone: true},
+			wantErr: true,
+		},
+		{
+			name:    "confirmed in the same update",
+			updates: contractx.StateUpdates{MarkDone: true, Confirmations: map[string]bool{"budget": true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+			st := statex.NewSessionState("session-confirm-done", "workspace", "customer", "chat", now)
+			goal := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+			goal.Slots = map[string]any{"category": "laptop", "budget": 35000}
+			goal.PendingConfirm = []string{"budget"}
+			if err := st.AddGoal(goal); err != nil {
+				t.Fatalf("AddGoal() error = %v", err)
+			}
+			st.ActiveGoalID = goal.ID
+			st.GoalStack = []string{goal.ID}
+
+			store := &fakeStore{loadState: st}
+			planner := &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{GoalID: "g_laptop", GoalType: "sales.recommend_item", Priority: 50},
+			}}
+			sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{
+				Message:      "สั่งซื้อเรียบร้อยครับ",
+				StateUpdates: tt.updates,
+			}}}
+			o := newTestOrchestrator(t,
+				store,
+				&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+				&fakeMemory{},
+			)
+
+			_, err := o.HandleMessage(context.Background(), Message{SessionID: "session-confirm-done", Text: "เอาเลย"})
+			if tt.wantErr {
+				if !errors.Is(err, statex.ErrInvalidTransition) {
+					t.Fatalf("HandleMessage() error = %v, want ErrInvalidTransition", err)
+				}
+				if len(store.saved) != 0 {
+					t.Fatalf("expected nothing saved, got %d saves", len(store.saved))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HandleMessage() error = %v", err)
+			}
+			if saved := store.saved[0].Goals["g_laptop"]; saved.Status != statex.GoalDone || saved.IsConfirming() {
+				t.Fatalf("expected confirmed goal done, got status=%s pending=%v", saved.Status, saved.PendingConfirm)
+			}
+		})
+	}
+}
+
+func TestHandleMessageRejectsPatchOfGoalClosedByTheSamePlan(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-closed", "workspace", "customer", "chat", now)
+	goal := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(goal); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = goal.ID
+	st.GoalStack = []string{goal.ID}
+
+	store := &fakeStore{loadState: st}
+	sales := &fakeSpecialist{}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				CancelGoalIDs: []string{"g_laptop"},
+				Goal:          contractx.GoalPatch{GoalID: "g_laptop", GoalType: "sales.recommend_item", Priority: 50},
+			}},
+			sales:   sales,
+			support: &fakeSpecialist{},
+		},
+		&fakeMemory{},
+	)
+
+	_, err := o.HandleMessage(context.Background(), Message{SessionID: "session-closed", Text: "hello"})
+	if !errors.Is(err, contractx.ErrValidation) || !strings.Contains(err.Error(), "g_laptop is cancelled") {
+		t.Fatalf("HandleMessage() error = %v, want ErrValidation for the cancelled goal", err)
+	}
+	if sales.calls != 0 || len(store.saved) != 0 {
+		t.Fatalf("expected the turn to stop, got %d specialist calls and %d saves", sales.calls, len(store.saved))
+	}
+}
+
+func TestHandleMessageStartsDependentGoalOncePrerequisiteIsDone(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalID: "g_warranty", GoalType: "support.warranty_inquiry", Priority: 100},
+			DependentGoals: []contractx.GoalPatch{{
+				GoalID:     "g_replacement",
+				GoalType:   "sales.recommend_item",
+				Priority:   50,
+				SlotsPatch: map[string]any{"category": "laptop"},
+			}},
+		},
+	}
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{
+			Message:      "ประกันหมดแล้วครับ",
+			StateUpdates: contractx.StateUpdates{SetStatus: string(statex.GoalDone)},
+		}},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "มาดูโน้ตบุ๊กเครื่องใหม่กันครับ งบประมาณเท่าไหร่ครับ"}},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: support},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{
+		SessionID: "session-deps",
+		Text:      "เช็คประกันให้หน่อย ถ้าหมดแล้วช่วยแนะนำโน้ตบุ๊กเครื่องใหม่",
+	}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if support.calls != 1 || sales.calls != 1 {
+		t.Fatalf("expected one support answer and one sales bridge, support=%d sales=%d", support.calls, sales.calls)
+	}
+	if finished := sales.lastReqs[0].FinishedGoal; finished == nil || finished.ID != "g_warranty" {
+		t.Fatalf("expected the sales bridge to follow g_warranty, got %+v", finished)
+	}
+
+	saved := store.saved[0]
+	if saved.Goals["g_warranty"].Status != statex.GoalDone {
+		t.Fatalf("expected g_warranty done, got %s", saved.Goals["g_warranty"].Status)
+	}
+	replacement := saved.Goals["g_replacement"]
+	if saved.ActiveGoalID != "g_replacement" || replacement.Status != statex.GoalBlocked {
+		t.Fatalf("expected g_replacement started and asking for its budget, got active=%s status=%s", saved.ActiveGoalID, replacement.Status)
+	}
+	if len(replacement.DependsOn) != 1 || replacement.DependsOn[0] != "g_warranty" {
+		t.Fatalf("expected g_replacement to depend on g_warranty, got %v", replacement.DependsOn)
+	}
+}
+
+func TestHandleMessageWorkspacePolicyAsksBeforeSwitching(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-ask", "shop-a", "customer", "chat", now)
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+	if err := st.AddGoal(laptop); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = laptop.ID
+	st.GoalStack = []string{laptop.ID}
+
+	store := &fakeStore{loadState: st}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "รุ่นนี้น่าสนใจครับ ต้องการให้ดูเรื่องจอก่อนไหมครับ"}},
+	}
+	support := &fakeSpecialist{}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{
+					GoalID:     "g_screen",
+					GoalType:   "support.troubleshoot",
+					Priority:   100,
+					SlotsPatch: map[string]any{"device_model": "ThinkPad X1", "symptom": "จอกระพริบ"},
+				},
+			}},
+			sales:   sales,
+			support: support,
+		},
+		&fakeMemory{},
+		Config{InterleavePolicyByWorkspace: map[string]string{"shop-a": "priority+ask"}},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-ask", Text: "จอกระพริบด้วยครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if sales.calls != 1 || support.calls != 0 {
+		t.Fatalf("expected the sales specialist to keep the turn, sales=%d support=%d", sales.calls, support.calls)
+	}
+	if offer := sales.lastReqs[0].OfferSwitch; offer == nil || offer.ID != "g_screen" {
+		t.Fatalf("expected g_screen offered, got %+v", offer)
+	}
+
+	saved := store.saved[0]
+	if saved.ActiveGoalID != "g_laptop" || saved.Goals["g_screen"].Status != statex.GoalSuspended {
+		t.Fatalf("expected g_laptop kept and g_screen parked, got active=%s screen=%s", saved.ActiveGoalID, saved.Goals["g_screen"].Status)
+	}
+
+	if _, err := New(store, &fakeRegistry{}, nil, Config{InterleavePolicy: "priority+sometimes"}); err == nil {
+		t.Fatal("expected New() to reject an unknown interleave strategy")
+	}
+	for _, spec := range []string{"priority+no_interrupt", "priority+no_interrupt=|", "priority+ask=1"} {
+		if _, err := New(store, &fakeRegistry{}, nil, Config{InterleavePolicy: spec}); err == nil {
+			t.Fatalf("expected New() to reject interleave policy %q", spec)
+		}
+	}
+	if _, err := New(store, &fakeRegistry{}, nil, Config{InterleavePolicy: "aging+no_interrupt=sales.recommend_item|support.troubleshoot+ask"}); err != nil {
+		t.Fatalf("New() with no_interrupt types error = %v", err)
+	}
+}
+
+func TestHandleMessageNoInterruptPolicyQueuesNewGoal(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-no-interrupt", "shop-a", "customer", "chat", now)
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+	if err := st.AddGoal(laptop); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = laptop.ID
+	st.GoalStack = []string{laptop.ID}
+
+	store := &fakeStore{loadState: st}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "สรุปรุ่นให้ก่อนนะครับ แล้วค่อยดูเรื่องจอ"}},
+	}
+	support := &fakeSpecialist{}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{
+					GoalID:     "g_screen",
+					GoalType:   "support.troubleshoot",
+					Priority:   100,
+					SlotsPatch: map[string]any{"device_model": "ThinkPad X1", "symptom": "จอกระพริบ"},
+				},
+			}},
+			sales:   sales,
+			support: support,
+		},
+		&fakeMemory{},
+		Config{InterleavePolicy: "priority+no_interrupt=sales.recommend_item"},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-no-interrupt", Text: "จอกระพริบด้วยครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if sales.calls != 1 || support.calls != 0 {
+		t.Fatalf("expected the sales specialist to keep the turn, sales=%d support=%d", sales.calls, support.calls)
+	}
+	saved := store.saved[0]
+	if got := strings.Join(saved.GoalStack, ","); saved.ActiveGoalID != "g_laptop" || got != "g_screen,g_laptop" {
+		t.Fatalf("expected g_screen queued beneath g_laptop, got active=%s stack=%s", saved.ActiveGoalID, got)
+	}
+}
+
+func TestHandleMessageAgingPolicyResumesLongSuspendedGoal(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name       string
+		after      time.Duration
+		wantActive string
+	}{
+		{name: "recently suspended", after: 20 * time.Minute, wantActive: "g_screen"},
+		{name: "suspended long ago", after: time.Hour, wantActive: "g_laptop"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			suspended := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+			st := statex.NewSessionState("session-aging", "workspace", "customer", "chat", suspended)
+			laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, suspended)
+			laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+			screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, suspended)
+			for _, g := range []*statex.Goal{laptop, screen} {
+				if err := st.AddGoal(g); err != nil {
+					t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+				}
+			}
+			if err := st.SetActiveGoal(laptop.ID); err != nil {
+				t.Fatalf("SetActiveGoal() error = %v", err)
+			}
+			if err := st.SuspendAndActivate(screen.ID, suspended); err != nil {
+				t.Fatalf("SuspendAndActivate() error = %v", err)
+			}
+
+			store := &fakeStore{loadState: st}
+			sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "กลับมาที่โน้ตบุ๊กกันต่อครับ"}}}
+			support := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "ลองรีสตาร์ตเครื่องดูครับ"}}}
+			o, err := New(store,
+				&fakeRegistry{
+					planner: &fakePlanner{resp: contractx.PlannerResponse{
+						Goal: contractx.GoalPatch{
+							GoalID:     "g_screen",
+							GoalType:   "support.troubleshoot",
+							Priority:   100,
+							SlotsPatch: map[string]any{"device_model": "ThinkPad X1", "symptom": "จอกระพริบ"},
+						},
+						// Touching the laptop goal must not reset how long it has waited.
+						OtherGoals: []contractx.GoalPatch{{
+							GoalID:     "g_laptop",
+							GoalType:   "sales.recommend_item",
+							SlotsPatch: map[string]any{"budget": 40000},
+						}},
+					}},
+					sales:   sales,
+					support: support,
+				},
+				&fakeMemory{},
+				Config{InterleavePolicy: "aging"},
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			o.now = func() time.Time { return suspended.Add(tc.after) }
+
+			if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-aging", Text: "จอกระพริบ งบขยับเป็น 40k ครับ"}); err != nil {
+				t.Fatalf("HandleMessage() error = %v", err)
+			}
+			saved := store.saved[0]
+			if saved.ActiveGoalID != tc.wantActive {
+				t.Fatalf("expected %s active, got %s (stack %v)", tc.wantActive, saved.ActiveGoalID, saved.GoalStack)
+			}
+			if tc.wantActive == "g_laptop" && (sales.calls != 1 || support.calls != 0) {
+				t.Fatalf("expected the sales specialist to take the turn, sales=%d support=%d", sales.calls, support.calls)
+			}
+			if tc.wantActive == "g_screen" && saved.Goals["g_laptop"].SuspendedAt != suspended {
+				t.Fatalf("expected g_laptop to keep suspended_at %v, got %v", suspended, saved.Goals["g_laptop"].SuspendedAt)
+			}
+		})
+	}
+}
+
+func TestHandleMessageAgingPolicyResumesLongestWaitingGoalAfterDone(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-aging-done", "workspace", "customer", "chat", now)
+	mouse := statex.CreateGoal("g_mouse", "sales.recommend_item", 50, now.Add(-time.Hour))
+	mouse.Status = statex.GoalSuspended
+	mouse.SuspendedAt = now.Add(-time.Hour)
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now.Add(-5*time.Minute))
+	laptop.Status = statex.GoalSuspended
+	laptop.SuspendedAt = now.Add(-5 * time.Minute)
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 200, now)
+	screen.Slots = map[string]any{"device_model": "X13", "symptom": "จอกระพริบ"}
+	for _, g := range []*statex.Goal{mouse, laptop, screen} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+		}
+	}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{mouse.ID, laptop.ID, screen.ID}
+
+	store := &fakeStore{loadState: st}
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{
+			Message:      "อัปเดตไดรเวอร์จอแล้วอาการหายครับ",
+			StateUpdates: contractx.StateUpdates{MarkDone: true},
+		}},
+	}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "กลับมาที่เมาส์กันต่อครับ"}}}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{GoalID: "g_screen", GoalType: "support.troubleshoot", Priority: 200},
+			}},
+			sales:   sales,
+			support: support,
+		},
+		&fakeMemory{},
+		Config{InterleavePolicy: "aging"},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	o.now = func() time.Time { return now }
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-aging-done", Text: "หายแล้วครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	saved := store.saved[0]
+	if saved.ActiveGoalID != "g_mouse" || saved.Goals["g_laptop"].Status != statex.GoalSuspended {
+		t.Fatalf("expected g_mouse resumed ahead of g_laptop, got active=%s stack=%v", saved.ActiveGoalID, saved.GoalStack)
+	}
+	if req := sales.lastReqs[0]; req.ActiveGoal == nil || req.ActiveGoal.ID != "g_mouse" {
+		t.Fatalf("expected the bridge to announce g_mouse, got %+v", req.ActiveGoal)
+	}
+}
+
+func TestHandleMessageMaxDepthPolicyQueuesGoalOnFullStack(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-max-depth", "workspace", "customer", "chat", now)
+	var stack []string
+	for _, id := range []string{"g_mouse", "g_bag", "g_laptop"} {
+		g := statex.CreateGoal(id, "sales.recommend_item", 50, now)
+		g.Status = statex.GoalSuspended
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", id, err)
+		}
+		stack = append(stack, id)
+	}
+	st.Goals["g_laptop"].Status = statex.GoalActive
+	st.Goals["g_laptop"].Slots = map[string]any{"category": "laptop", "budget": 35000}
+	st.ActiveGoalID = "g_laptop"
+	st.GoalStack = stack
+
+	store := &fakeStore{loadState: st}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "ขอจบเรื่องโน้ตบุ๊กก่อนนะครับ"}}}
+	support := &fakeSpecialist{}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{
+					GoalID:     "g_screen",
+					GoalType:   "support.troubleshoot",
+					Priority:   100,
+					SlotsPatch: map[string]any{"device_model": "ThinkPad X1", "symptom": "จอกระพริบ"},
+				},
+			}},
+			sales:   sales,
+			support: support,
+		},
+		&fakeMemory{},
+		Config{InterleavePolicy: "priority+max_depth"},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-max-depth", Text: "จอกระพริบด้วยครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if sales.calls != 1 || support.calls != 0 {
+		t.Fatalf("expected the sales specialist to keep the turn, sales=%d support=%d", sales.calls, support.calls)
+	}
+	saved := store.saved[0]
+	if got := strings.Join(saved.GoalStack, ","); saved.ActiveGoalID != "g_laptop" || got != "g_mouse,g_bag,g_screen,g_laptop" {
+		t.Fatalf("expected g_screen queued beneath g_laptop, got active=%s stack=%s", saved.ActiveGoalID, got)
+	}
+}
+
+func TestHandleMessageUsesConfiguredGoalMachine(t *testing.T) {
+	t.Parallel()
+
+	var transitions []statex.Transition
+	machine := statex.NewGoalMachine()
+	machine.AfterTransition(func(s *statex.SessionState, tr statex.Transition) error {
+		transitions = append(transitions, tr)
+		return nil
+	})
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	sales := &fakeSpecialist{responses: []contractx.SpecialistResponse{{
+		Message:      "A คุ้มกว่าครับ",
+		StateUpdates: contractx.StateUpdates{SetStatus: string(statex.GoalDone)},
+	}}}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{GoalID: "g_compare", GoalType: "sales.compare_products", Priority: 50},
+			}},
+			sales:   sales,
+			support: &fakeSpecialist{},
+		},
+		&fakeMemory{},
+		Config{},
+		WithGoalMachine(machine),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-machine", Text: "A กับ B อันไหนดี"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if len(transitions) == 0 || transitions[len(transitions)-1].To != statex.GoalDone {
+		t.Fatalf("expected the hook to see the goal finish, got %+v", transitions)
+	}
+}
+
+func TestHandleMessageExpiresIdleGoalsAndArchivesClosedOnes(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-retain", "workspace", "customer", "chat", now.Add(-48*time.Hour))
+
+	mouse := statex.CreateGoal("g_mouse", "sales.recommend_item", 50, now.Add(-48*time.Hour))
+	mouse.Status = statex.GoalSuspended
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now.Add(-time.Hour))
+	screen.Status = statex.GoalDone
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now.Add(-2*time.Hour))
+	laptop.Slots = map[string]any{"category": "laptop", "budget": 35000}
+
+	for _, g := range []*statex.Goal{mouse, screen, laptop} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatalf("AddGoal(%s) error = %v", g.ID, err)
+		}
+	}
+	st.ActiveGoalID = laptop.ID
+	st.GoalStack = []string{mouse.ID, laptop.ID}
+
+	store := &fakeStore{loadState: st}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "กลับมาที่โน้ตบุ๊กงบ 35,000 กันต่อครับ"}},
+	}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{resp: contractx.PlannerResponse{
+				Goal: contractx.GoalPatch{GoalID: "g_laptop", GoalType: "sales.recommend_item", Priority: 50},
+			}},
+			sales:   sales,
+			support: &fakeSpecialist{},
+		},
+		&fakeMemory{},
+		Config{GoalSuspendAfter: 30 * time.Minute, GoalExpireAfter: 24 * time.Hour},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	o.now = func() time.Time { return now }
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-retain", Text: "ต่อเรื่องโน้ตบุ๊กครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	saved := store.saved[0]
+	if len(saved.Goals) != 1 || saved.ActiveGoalID != "g_laptop" || saved.Goals["g_laptop"].Status != statex.GoalActive {
+		t.Fatalf("expected only g_laptop left and active, got active=%s goals=%v", saved.ActiveGoalID, saved.Goals)
+	}
+	if len(saved.GoalStack) != 1 || saved.GoalStack[0] != "g_laptop" {
+		t.Fatalf("expected stack [g_laptop], got %v", saved.GoalStack)
+	}
+	if len(saved.GoalHistory) != 2 {
+		t.Fatalf("expected two archived goals, got %+v", saved.GoalHistory)
+	}
+	if h := saved.GoalHistory[0]; h.ID != "g_mouse" || h.Status != statex.GoalCancelled || !h.Expired {
+		t.Fatalf("expected g_mouse expired first, got %+v", h)
+	}
+	if h := saved.GoalHistory[1]; h.ID != "g_screen" || h.Status != statex.GoalDone || h.Expired {
+		t.Fatalf("expected g_screen archived as done, got %+v", h)
+	}
+}
+
+func TestHandleMessageSaveErrorPropagates(t *testing.T) {
+	t.Parallel()
+
+	saveErr := errors.New("save failed")
+	store := &fakeStore{
+		loadErr: statex.ErrStateNotFound,
+		saveErr: saveErr,
+	}
+	memory := &fakeMemory{}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{
+						GoalType: "sales.recommend_item",
+						Priority: 50,
+					},
+				},
+			},
+			sales: &fakeSpecialist{
+				responses: []contractx.SpecialistResponse{
+					{Message: "ok"},
+				},
+			},
+			support: &fakeSpecialist{},
+		},
+		memory,
+	)
+
+	_, err := o.HandleMessage(context.Background(), Message{SessionID: "session-5", Text: "hello"})
+	if !errors.Is(err, saveErr) {
+		t.Fatalf("expected save error, got %v", err)
+	}
+	if len(memory.writes) != 0 {
+		t.Fatalf("memory write must not be called on save error, got %d", len(memory.writes))
+	}
+}
+
+func TestHandleMessageRetriesTurnOnVersionConflict(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound, conflicts: 1}
+	memory := &fakeMemory{}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "first attempt"},
+			{Message: "second attempt"},
+		},
+	}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+				},
+			},
+			sales:   sales,
+			support: &fakeSpecialist{},
+		},
+		memory,
+	)
+
+	reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-12", Text: "hello"})
+	if err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if reply != "second attempt" {
+		t.Fatalf("reply = %q, want reply from the retried turn", reply)
+	}
+	if store.loads != 2 || len(store.saved) != 1 {
+		t.Fatalf("loads=%d saves=%d, want 2 loads and 1 save", store.loads, len(store.saved))
+	}
+	if len(memory.writes) != 1 {
+		t.Fatalf("memory writes = %d, want 1", len(memory.writes))
+	}
+}
+
+func TestHandleMessageReturnsConflictAfterRetries(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound, conflicts: 10}
+	sales := &fakeSpecialist{}
+	for i := 0; i < 10; i++ {
+		sales.responses = append(sales.responses, contractx.SpecialistResponse{Message: "ok"})
+	}
+	o, err := New(store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+				},
+			},
+			sales:   sales,
+			support: &fakeSpecialist{},
+		},
+		&fakeMemory{},
+		Config{MaxConflictRetries: 2},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = o.HandleMessage(context.Background(), Message{SessionID: "session-13", Text: "hello"})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	if store.loads != 3 {
+		t.Fatalf("loads = %d, want 3 (1 try + 2 retries)", store.loads)
+	}
+}
+
+func TestHandleMessageReturnsSessionBusyWhenLockWaitExpires(t *testing.T) {
+	t.Parallel()
+
+	locker := statex.NewMemoryLocker()
+	held, err := locker.Lock(context.Background(), "session-14")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer held.Release(context.Background())
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	o, err := New(store,
+		&fakeRegistry{planner: &fakePlanner{}, sales: &fakeSpecialist{}, support: &fakeSpecialist{}},
+		&fakeMemory{},
+		Config{LockWaitTimeout: 20 * time.Millisecond},
+		WithLocker(locker),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = o.HandleMessage(context.Background(), Message{SessionID: "session-14", Text: "hello"})
+	if !errors.Is(err, ErrSessionBusy) {
+		t.Fatalf("expected ErrSessionBusy, got %v", err)
+	}
+	if store.loads != 0 {
+		t.Fatalf("expected no state load while the session is busy, got %d", store.loads)
+	}
+}
+
+// blockingPlanner waits until the turn is cancelled.
+type blockingPlanner struct{}
+
+func (blockingPlanner) Plan(ctx context.Context, req contractx.PlannerRequest) (contractx.PlannerResponse, error) {
+	<-ctx.Done()
+	return contractx.PlannerResponse{}, ctx.Err()
+}
+
+func TestHandleMessageStopsTurnWhenLeaseIsLost(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var cmd []any
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			t.Errorf("decode command: %v", err)
+			return
+		}
+		if script, _ := cmd[1].(string); strings.Contains(script, "INCR") {
+			fmt.Fprint(w, `{"result":1}`)
+			return
+		}
+		// Refreshes find the lock taken over.
+		fmt.Fprint(w, `{"result":0}`)
+	}))
+	t.Cleanup(server.Close)
+
+	redis, err := statex.NewUpstashRedisStore(statex.UpstashRedisConfig{URL: server.URL, Token: "token"}, statex.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewUpstashRedisStore() error = %v", err)
+	}
+	locker, err := statex.NewUpstashRedisLocker(redis, statex.LockConfig{TTL: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewUpstashRedisLocker() error = %v", err)
+	}
+
+	o, err := New(&fakeStore{loadErr: statex.ErrStateNotFound},
+		&fakeRegistry{planner: blockingPlanner{}, sales: &fakeSpecialist{}, support: &fakeSpecialist{}},
+		&fakeMemory{},
+		Config{},
+		WithLocker(locker),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := o.HandleMessage(ctx, Message{SessionID: "session-lost", Text: "hello"}); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("expected ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestHandleMessageReplaysCachedReplyForRepeatedMessageID(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	memory := &fakeMemory{}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "แนะนำรุ่น A ครับ"}},
+	}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		memory,
+	)
+
+	msg := Message{SessionID: "session-15", Text: "แนะนำเมาส์หน่อย", MessageID: "line-msg-1"}
+	first, err := o.HandleMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	store.loadErr = nil
+	store.loadState = store.saved[0]
+	second, err := o.HandleMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("HandleMessage() retry error = %v", err)
+	}
+
+	if second != first {
+		t.Fatalf("retry reply = %q, want cached %q", second, first)
+	}
+	if planner.calls != 1 || sales.calls != 1 {
+		t.Fatalf("expected graph to run once, planner=%d sales=%d", planner.calls, sales.calls)
+	}
+	if len(store.saved) != 1 || len(memory.writes) != 1 {
+		t.Fatalf("expected no extra save or memory write, saves=%d writes=%d", len(store.saved), len(memory.writes))
+	}
+}
+
+func TestHandleMessageWriteMemoryErrorPropagates(t *testing.T) {
+	t.Parallel()
+
+	writeErr := errors.New("write memory failed")
+	memory := &fakeMemory{
+		writeErr: writeErr,
+	}
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{
+						GoalType: "sales.recommend_item",
+						Priority: 50,
+					},
+				},
+			},
+			sales: &fakeSpecialist{
+				responses: []contractx.SpecialistResponse{
+					{Message: "ok"},
+				},
+			},
+			support: &fakeSpecialist{},
+		},
+		memory,
+	)
+
+	_, err := o.HandleMessage(context.Background(), Message{SessionID: "session-6", Text: "hello"})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("expected write memory error, got %v", err)
+	}
+	if len(store.saved) != 1 {
+		t.Fatalf("expected state already saved before memory error, got %d", len(store.saved))
+	}
+}
+
+func TestHandleMessageUsesMessageIdentityForNewSession(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	memory := &fakeMemory{}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+				},
+			},
+			sales:   &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "ok"}}},
+			support: &fakeSpecialist{},
+		},
+		memory,
+	)
+
+	_, err := o.HandleMessage(context.Background(), Message{
+		SessionID:   "session-7",
+		Text:        "hello",
+		WorkspaceID: "shop-a",
+		CustomerID:  "cust-42",
+		ChannelType: "line",
+	})
+	if err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	saved := store.saved[0]
+	if saved.WorkspaceID != "shop-a" || saved.CustomerID != "cust-42" || saved.ChannelType != "line" {
+		t.Fatalf("unexpected identity: %s/%s/%s", saved.WorkspaceID, saved.CustomerID, saved.ChannelType)
+	}
+	if memory.writes[0].customerID != "cust-42" {
+		t.Fatalf("expected memory write for cust-42, got %q", memory.writes[0].customerID)
+	}
+}
+
+func TestHandleMessageAnonymousSessionScopesCustomerToSession(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	memory := &fakeMemory{}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+				},
+			},
+			sales:   &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "ok"}}},
+			support: &fakeSpecialist{},
+		},
+		memory,
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-8", Text: "hello"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	saved := store.saved[0]
+	if saved.CustomerID != "" {
+		t.Fatalf("expected no customer stored for an anonymous session, got %q", saved.CustomerID)
+	}
+	if memory.writes[0].customerID != "session-8" {
+		t.Fatalf("expected memory scoped to session, got %q", memory.writes[0].customerID)
+	}
+	if saved.WorkspaceID != "default-workspace" || saved.ChannelType != "chat" {
+		t.Fatalf("unexpected defaults: %s/%s", saved.WorkspaceID, saved.ChannelType)
+	}
+}
+
+func TestHandleMessageFillsCustomerOfAnonymousSessionOnce(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	memory := &fakeMemory{}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{
+			planner: &fakePlanner{
+				resp: contractx.PlannerResponse{
+					Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+				},
+			},
+			sales:   &fakeSpecialist{responses: []contractx.SpecialistResponse{{Message: "ok"}, {Message: "ok"}}},
+			support: &fakeSpecialist{},
+		},
+		memory,
+	)
+
+	ctx := context.Background()
+	if _, err := o.HandleMessage(ctx, Message{SessionID: "session-anon", Text: "hello"}); err != nil {
+		t.Fatalf("HandleMessage() anonymous error = %v", err)
+	}
+	store.loadErr = nil
+	store.loadState = store.saved[0]
+	if _, err := o.HandleMessage(ctx, Message{SessionID: "session-anon", Text: "ขอดูโน้ตบุ๊ก", CustomerID: "cust-42"}); err != nil {
+		t.Fatalf("HandleMessage() with customer error = %v", err)
+	}
+	if got := store.saved[1].CustomerID; got != "cust-42" {
+		t.Fatalf("CustomerID = %q, want cust-42", got)
+	}
+	if got := memory.writes[1].customerID; got != "cust-42" {
+		t.Fatalf("memory write for %q, want cust-42", got)
+	}
+
+	store.loadState = store.saved[1]
+	_, err := o.HandleMessage(ctx, Message{SessionID: "session-anon", Text: "hello", CustomerID: "cust-43"})
+	if !errors.Is(err, ErrIdentityMismatch) {
+		t.Fatalf("expected ErrIdentityMismatch once the customer is set, got %v", err)
+	}
+}
+
+func TestHandleMessageRejectsIdentityMismatch(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := &fakeStore{loadState: statex.NewSessionState("session-9", "shop-a", "cust-1", "line", now)}
+	planner := &fakePlanner{}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: &fakeSpecialist{}, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+
+	_, err := o.HandleMessage(context.Background(), Message{
+		SessionID:  "session-9",
+		Text:       "hello",
+		CustomerID: "cust-2",
+	})
+	if !errors.Is(err, ErrIdentityMismatch) {
+		t.Fatalf("expected ErrIdentityMismatch, got %v", err)
+	}
+	if planner.calls != 0 {
+		t.Fatalf("planner must not run on identity mismatch, got %d calls", planner.calls)
+	}
+	if len(store.saved) != 0 {
+		t.Fatalf("expected no save, got %d", len(store.saved))
+	}
+}
+
+func TestHandleMessageRecordsTranscriptAndPassesItToSpecialist(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "แนะนำรุ่น A ครับ"},
+			{Message: "รุ่น A มีของครับ"},
+		},
+	}
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-10", Text: "แนะนำโน้ตบุ๊กงบ 35k"}); err != nil {
+		t.Fatalf("HandleMessage() turn 1 error = %v", err)
+	}
+
+	first := store.saved[0]
+	if first.Turn != 1 || len(first.Transcript) != 2 {
+		t.Fatalf("unexpected transcript after turn 1: turn=%d entries=%d", first.Turn, len(first.Transcript))
+	}
+	if first.Transcript[0].Role != statex.TranscriptRoleUser || first.Transcript[1].Role != statex.TranscriptRoleAssistant {
+		t.Fatalf("unexpected roles: %+v", first.Transcript)
+	}
+	if first.Transcript[0].GoalID == "" || first.Transcript[0].GoalID != first.ActiveGoalID {
+		t.Fatalf("expected turn attributed to active goal %q, got %q", first.ActiveGoalID, first.Transcript[0].GoalID)
+	}
+
+	store.loadErr = nil
+	store.loadState = first
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-10", Text: "รุ่นที่แนะนำมีของไหม"}); err != nil {
+		t.Fatalf("HandleMessage() turn 2 error = %v", err)
+	}
+
+	secondReq := sales.lastReqs[1]
+	if len(secondReq.Transcript) != 2 || secondReq.Transcript[1].Text != "แนะนำรุ่น A ครับ" {
+		t.Fatalf("expected prior turn passed to specialist, got %+v", secondReq.Transcript)
+	}
+	second := store.saved[1]
+	if second.Turn != 2 || len(second.Transcript) != 4 {
+		t.Fatalf("unexpected transcript after turn 2: turn=%d entries=%d", second.Turn, len(second.Transcript))
+	}
+}
+
+func TestHandleMessageSummarizesOlderTurns(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "แนะนำรุ่น A ครับ"},
+			{Message: "รุ่น A ราคา 32,900 บาทครับ"},
+			{Message: "มีสีดำกับเงินครับ"},
+		},
+	}
+	summarizer := &fakeSummarizer{summary: "ลูกค้าหาโน้ตบุ๊กงบ 35k ได้รับคำแนะนำรุ่น A"}
+	o, err := New(store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}, summarizer: summarizer},
+		&fakeMemory{},
+		Config{MaxTranscriptEntries: 4, SummaryTriggerTokens: 1_000_000, SummaryKeepEntries: 2},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	texts := []string{"แนะนำโน้ตบุ๊กงบ 35k", "รุ่น A ราคาเท่าไร", "มีสีอะไรบ้าง"}
+	for i, text := range texts {
+		if i > 0 {
+			store.loadErr = nil
+			store.loadState = store.saved[len(store.saved)-1]
+		}
+		if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-11", Text: text}); err != nil {
+			t.Fatalf("HandleMessage() turn %d error = %v", i+1, err)
+		}
+	}
+
+	if len(summarizer.lastReqs) != 1 {
+		t.Fatalf("summarizer calls = %d, want 1", len(summarizer.lastReqs))
+	}
+	folded := summarizer.lastReqs[0].Entries
+	if len(folded) != 4 || folded[0].Turn != 1 || folded[3].Turn != 2 {
+		t.Fatalf("unexpected entries summarized: %+v", folded)
+	}
+
+	last := store.saved[len(store.saved)-1]
+	if last.ConversationSummary != summarizer.summary {
+		t.Fatalf("ConversationSummary = %q, want %q", last.ConversationSummary, summarizer.summary)
+	}
+	if len(last.Transcript) != 2 || last.Transcript[0].Turn != 3 {
+		t.Fatalf("unexpected transcript kept: %+v", last.Transcript)
+	}
+
+	store.loadState = last
+	sales.responses = append(sales.responses, contractx.SpecialistResponse{Message: "ได้ครับ"})
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-11", Text: "เอาสีดำครับ"}); err != nil {
+		t.Fatalf("HandleMessage() turn 4 error = %v", err)
+	}
+	if got := sales.lastReqs[3].ConversationSummary; got != summarizer.summary {
+		t.Fatalf("specialist ConversationSummary = %q, want %q", got, summarizer.summary)
+	}
+}
+
+func TestHandleMessageKeepsTurnWhenSummarizerFails(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "แนะนำรุ่น A ครับ"},
+			{Message: "รุ่น A ราคา 32,900 บาทครับ"},
+			{Message: "มีสีดำกับเงินครับ"},
+		},
+	}
+	summarizer := &fakeSummarizer{err: contractx.ErrModelInvoke}
+	o, err := New(store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}, summarizer: summarizer},
+		&fakeMemory{},
+		Config{MaxTranscriptEntries: 100, SummaryTriggerTokens: 1, SummaryKeepEntries: 2},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i, text := range []string{"แนะนำโน้ตบุ๊กงบ 35k", "รุ่น A ราคาเท่าไร", "มีสีอะไรบ้าง"} {
+		if i > 0 {
+			store.loadErr = nil
+			store.loadState = store.saved[len(store.saved)-1]
+		}
+		reply, err := o.HandleMessage(context.Background(), Message{SessionID: "session-summary-down", Text: text})
+		if err != nil {
+			t.Fatalf("HandleMessage() turn %d error = %v", i+1, err)
+		}
+		if reply != sales.responses[i].Message {
+			t.Fatalf("turn %d reply = %q", i+1, reply)
+		}
+	}
+
+	if len(summarizer.lastReqs) != 2 {
+		t.Fatalf("summarizer calls = %d, want 2", len(summarizer.lastReqs))
+	}
+	last := store.saved[len(store.saved)-1]
+	if last.ConversationSummary != "" || len(last.Transcript) != 6 || last.Transcript[0].Turn != 1 {
+		t.Fatalf("expected the transcript kept whole, got summary=%q transcript=%+v", last.ConversationSummary, last.Transcript)
+	}
+}
+
+func TestHandleMessageFailsTurnWhenOverflowCannotBeSummarized(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{loadErr: statex.ErrStateNotFound}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalType: "sales.recommend_item", Priority: 50},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "แนะนำรุ่น A ครับ"},
+			{Message: "รุ่น A ราคา 32,900 บาทครับ"},
+			{Message: "มีสีดำกับเงินครับ"},
+			{Message: "มีสีดำกับเงินครับ"},
+		},
+	}
+	summarizer := &fakeSummarizer{err: contractx.ErrModelInvoke}
+	o, err := New(store,
+		&fakeRegistry{planner: planner, sales: sales, support: &fakeSpecialist{}, summarizer: summarizer},
+		&fakeMemory{},
+		Config{MaxTranscriptEntries: 4, SummaryTriggerTokens: 1_000_000, SummaryKeepEntries: 2},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i, text := range []string{"แนะนำโน้ตบุ๊กงบ 35k", "รุ่น A ราคาเท่าไร"} {
+		if i > 0 {
+			store.loadErr = nil
+			store.loadState = store.saved[len(store.saved)-1]
+		}
+		if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-summary-cap", Text: text}); err != nil {
+			t.Fatalf("HandleMessage() turn %d error = %v", i+1, err)
+		}
+	}
+
+	store.loadState = store.saved[len(store.saved)-1]
+	_, err = o.HandleMessage(context.Background(), Message{SessionID: "session-summary-cap", Text: "มีสีอะไรบ้าง"})
+	if !errors.Is(err, contractx.ErrModelInvoke) {
+		t.Fatalf("HandleMessage() error = %v, want ErrModelInvoke", err)
+	}
+	if len(store.saved) != 2 {
+		t.Fatalf("saves = %d, want the over-cap turn not saved", len(store.saved))
+	}
+
+	summarizer.err = nil
+	summarizer.summary = "ลูกค้าหาโน้ตบุ๊กงบ 35k ได้รับคำแนะนำรุ่น A"
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-summary-cap", Text: "มีสีอะไรบ้าง"}); err != nil {
+		t.Fatalf("HandleMessage() retry error = %v", err)
+	}
+	folded := summarizer.lastReqs[len(summarizer.lastReqs)-1].Entries
+	if len(folded) != 4 || folded[0].Turn != 1 || folded[3].Turn != 2 {
+		t.Fatalf("unexpected entries summarized: %+v", folded)
+	}
+	last := store.saved[len(store.saved)-1]
+	if last.ConversationSummary != summarizer.summary || len(last.Transcript) != 2 || last.Transcript[0].Turn != 3 {
+		t.Fatalf("unexpected state after retry: summary=%q transcript=%+v", last.ConversationSummary, last.Transcript)
+	}
+}
+
+func newTestOrchestrator(
+	t *testing.T,
+	store statex.Store,
+	registry contractx.Registry,
+	memory contractx.MemoryStore,
+) *Orchestrator {
+	t.Helper()
+	o, err := New(store, registry, memory, Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return o
+}
+
+func cloneSessionState(in *statex.SessionState) *statex.SessionState {
+	if in == nil {
+		return nil
+	}
+	raw, err := json.Marshal(in)
+	if err != nil {
+		panic(err)
+	}
+	var out statex.SessionState
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(err)
 	}
 	out.EnsureGoalsMap()
 	return &out
 }
+
+func TestHandleMessageQueuesOtherGoalsFromTheSameMessage(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-multi", "workspace", "customer", "chat", now)
+	laptop := statex.CreateGoal("g_laptop", "sales.compare_products", 50, now)
+	laptop.Slots = map[string]any{"category": "laptop"}
+	if err := st.AddGoal(laptop); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = laptop.ID
+	st.GoalStack = []string{laptop.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{
+				GoalType:   "sales.recommend_item",
+				Priority:   50,
+				SlotsPatch: map[string]any{"category": "keyboard"},
+			},
+			OtherGoals: []contractx.GoalPatch{{
+				GoalType:   "support.troubleshoot",
+				Priority:   100,
+				SlotsPatch: map[string]any{"device_model": "MX Master", "symptom": "double-click"},
+			}},
+		},
+	}
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{
+			{Message: "ลองเป่าฝุ่นที่ปุ่มคลิกดูครับ เดี๋ยวจะหาคีย์บอร์ดราคาประหยัดให้ต่อนะครับ"},
+			{Message: "ดีใจที่หายแล้วครับ", StateUpdates: contractx.StateUpdates{MarkDone: true}},
+		},
+	}
+	sales := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "มาดูคีย์บอร์ดกันต่อครับ งบประมาณเท่าไหร่ครับ"}},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: sales, support: support},
+		&fakeMemory{},
+	)
+
+	if _, err := o.HandleMessage(context.Background(), Message{
+		SessionID: "session-multi",
+		Text:      "เมาส์ดับเบิลคลิกเอง แล้วมีคีย์บอร์ดถูกกว่านี้ไหม",
+	}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	saved := store.saved[0]
+	if len(saved.GoalStack) != 3 || saved.GoalStack[0] != "g_laptop" {
+		t.Fatalf("expected laptop, keyboard and mouse goals on the stack, got %v", saved.GoalStack)
+	}
+	keyboard, mouse := saved.Goals[saved.GoalStack[1]], saved.Goals[saved.GoalStack[2]]
+	if keyboard.Slots["category"] != "keyboard" || keyboard.Status != statex.GoalSuspended {
+		t.Fatalf("expected the keyboard goal queued beneath the active goal, got %+v", keyboard)
+	}
+	if mouse.Type != "support.troubleshoot" || saved.ActiveGoalID != mouse.ID {
+		t.Fatalf("expected the higher-priority mouse goal active, got active=%s", saved.ActiveGoalID)
+	}
+	if support.calls != 1 || sales.calls != 0 {
+		t.Fatalf("expected only the support specialist to answer, support=%d sales=%d", support.calls, sales.calls)
+	}
+	if queued := support.lastReqs[0].QueuedGoals; len(queued) != 1 || queued[0].ID != keyboard.ID {
+		t.Fatalf("expected the keyboard goal acknowledged as queued, got %+v", queued)
+	}
+
+	// Once the mouse is fixed, the keyboard comes next, before the laptop.
+	store.loadState = saved
+	planner.resp = contractx.PlannerResponse{
+		Goal: contractx.GoalPatch{GoalID: mouse.ID, GoalType: "support.troubleshoot", Priority: 100},
+	}
+	if _, err := o.HandleMessage(context.Background(), Message{SessionID: "session-multi", Text: "หายแล้วครับ"}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+	if active := store.saved[1].ActiveGoalID; active != keyboard.ID {
+		t.Fatalf("expected the keyboard goal resumed, got %s", active)
+	}
+	if sales.calls != 1 || sales.lastReqs[0].ActiveGoal.ID != keyboard.ID {
+		t.Fatalf("expected the sales bridge back to the keyboard goal, got calls=%d", sales.calls)
+	}
+}
+
+func TestHandleMessageQueuesGoalsThatMayNotInterrupt(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := statex.NewSessionState("session-stay", "workspace", "customer", "chat", now)
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+	screen.Slots = map[string]any{"device_model": "X13", "symptom": "จอกระพริบ"}
+	if err := st.AddGoal(screen); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	st.ActiveGoalID = screen.ID
+	st.GoalStack = []string{screen.ID}
+
+	store := &fakeStore{loadState: st}
+	planner := &fakePlanner{
+		resp: contractx.PlannerResponse{
+			Goal: contractx.GoalPatch{GoalType: "support.warranty_inquiry", Priority: 100},
+			OtherGoals: []contractx.GoalPatch{{
+				GoalType:   "sales.recommend_item",
+				Priority:   50,
+				SlotsPatch: map[string]any{"category": "keyboard"},
+			}},
+		},
+	}
+	support := &fakeSpecialist{
+		responses: []contractx.SpecialistResponse{{Message: "ลองอัปเดตไดรเวอร์จอครับ เรื่องประกันกับคีย์บอร์ดเดี๋ยวดูต่อให้นะครับ"}},
+	}
+
+	o := newTestOrchestrator(t,
+		store,
+		&fakeRegistry{planner: planner, sales: &fakeSpecialist{}, support: support},
+		&fakeMemory{},
+	)
+	if _, err := o.HandleMessage(context.Background(), Message{
+		SessionID: "session-stay",
+		Text:      "เช็คประกันให้ด้วย แล้วก็อยากได้คีย์บอร์ด",
+	}); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	saved := store.saved[0]
+	if saved.ActiveGoalID != "g_screen" || len(saved.GoalStack) != 3 || saved.GoalStack[2] != "g_screen" {
+		t.Fatalf("expected g_screen to stay on top, got active=%s stack=%v", saved.ActiveGoalID, saved.GoalStack)
+	}
+	keyboard, warranty := saved.Goals[saved.GoalStack[0]], saved.Goals[saved.GoalStack[1]]
+	if warranty.Type != "support.warranty_inquiry" || warranty.Status != statex.GoalSuspended {
+		t.Fatalf("expected the warranty goal queued right beneath g_screen, got %+v", warranty)
+	}
+	if keyboard.Type != "sales.recommend_item" || keyboard.Status != statex.GoalSuspended {
+		t.Fatalf("expected the keyboard goal queued beneath it, got %+v", keyboard)
+	}
+	queued := support.lastReqs[0].QueuedGoals
+	if len(queued) != 2 || queued[0].ID != warranty.ID || queued[1].ID != keyboard.ID {
+		t.Fatalf("expected both goals acknowledged as queued, got %+v", queued)
+	}
+}
@@ -14,23 +14,37 @@ import (
 
 type plannerImpl struct {
 	runner compose.Runnable[map[string]any, plannerLLMOutput]
+	budget transcriptBudget
 }
 
 type plannerLLMOutput struct {
-	GoalID       string         `json:"goal_id,omitempty"`
-	GoalType     string         `json:"goal_type"`
-	Priority     int            `json:"priority"`
-	SlotsPatch   map[string]any `json:"slots_patch,omitempty"`
-	Missing      []string       `json:"missing,omitempty"`
-	NextQuestion string         `json:"next_question,omitempty"`
+	GoalID        string                              `json:"goal_id,omitempty"`
+	GoalType      string                              `json:"goal_type"`
+	Priority      int                                 `json:"priority"`
+	SlotsPatch    map[string]any                      `json:"slots_patch,omitempty"`
+	Missing       []string                            `json:"missing,omitempty"`
+	NextQuestion  string                              `json:"next_question,omitempty"`
+	SlotSources   map[string]contractx.SlotProvenance `json:"slot_sources,omitempty"`
+	Confirmations map[string]bool                     `json:"confirmations,omitempty"`
+	SwitchTo      bool                                `json:"switch_to,omitempty"`
+	DependsOn     []string                            `json:"depends_on,omitempty"`
+	CancelGoalIDs []string                            `json:"cancel_goal_ids,omitempty"`
+
+	DependentGoals []contractx.GoalPatch `json:"dependent_goals,omitempty"`
+	OtherGoals     []contractx.GoalPatch `json:"other_goals,omitempty"`
 }
 
-func newPlanner(ctx context.Context, chatModel einomodel.BaseChatModel, systemPrompt string) (*plannerImpl, error) {
+func newPlanner(
+	ctx context.Context,
+	chatModel einomodel.BaseChatModel,
+	systemPrompt string,
+	budget transcriptBudget,
+) (*plannerImpl, error) {
 	runner, err := compilePlannerGraph(ctx, chatModel, systemPrompt)
 	if err != nil {
 		return nil, fmt.Errorf("%w: compile planner graph: %v", contractx.ErrModelInvoke, err)
 	}
-	return &plannerImpl{runner: runner}, nil
+	return &plannerImpl{runner: runner, budget: budget}, nil
 }
 
 func (p *plannerImpl) Plan(ctx context.Context, req contractx.PlannerRequest) (contractx.PlannerResponse, error) {
@@ -41,7 +55,8 @@ func (p *plannerImpl) Plan(ctx context.Context, req contractx.PlannerRequest) (c
 	payload := map[string]any{
 		"user_message":   req.UserMessage,
 		"memory_summary": req.MemorySummary,
-		"session":        summarizeSession(req.Session),
+		"session":        summarizeSession(req.Session, p.budget),
+		"slot_schemas":   req.SlotSchemas,
 	}
 	inputBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -57,13 +72,24 @@ func (p *plannerImpl) Plan(ctx context.Context, req contractx.PlannerRequest) (c
 
 	resp := contractx.PlannerResponse{
 		Goal: contractx.GoalPatch{
-			GoalID:       strings.TrimSpace(out.GoalID),
-			GoalType:     strings.TrimSpace(out.GoalType),
-			Priority:     out.Priority,
-			SlotsPatch:   out.SlotsPatch,
-			Missing:      out.Missing,
-			NextQuestion: strings.TrimSpace(out.NextQuestion),
+			GoalID:        strings.TrimSpace(out.GoalID),
+			GoalType:      strings.TrimSpace(out.GoalType),
+			Priority:      out.Priority,
+			SlotsPatch:    out.SlotsPatch,
+			Missing:       out.Missing,
+			NextQuestion:  strings.TrimSpace(out.NextQuestion),
+			SlotSources:   out.SlotSources,
+			Confirmations: out.Confirmations,
+			SwitchTo:      out.SwitchTo,
+			DependsOn:     trimGoalIDs(out.DependsOn),
 		},
+		CancelGoalIDs: trimGoalIDs(out.CancelGoalIDs),
+	}
+	for _, dep := range out.DependentGoals {
+		resp.DependentGoals = append(resp.DependentGoals, trimGoalPatch(dep))
+	}
+	for _, other := range out.OtherGoals {
+		resp.OtherGoals = append(resp.OtherGoals, trimGoalPatch(other))
 	}
 
 	if err := validatePlannerResponse(resp); err != nil {
@@ -75,9 +101,16 @@ func (p *plannerImpl) Plan(ctx context.Context, req contractx.PlannerRequest) (c
 
 func validatePlannerResponse(resp contractx.PlannerResponse) error {
 	goalType := strings.TrimSpace(resp.Goal.GoalType)
+	if goalType == "" && resp.Goal.GoalID == "" && len(resp.CancelGoalIDs) > 0 && len(resp.OtherGoals) == 0 {
+		// Cancellation only; the orchestrator continues with the resumed goal.
+		return nil
+	}
 	if !isSupportedGoalType(goalType) {
 		return fmt.Errorf("%w: unsupported goal_type=%q", contractx.ErrSchemaViolation, goalType)
 	}
+	if resp.Goal.SwitchTo && resp.Goal.GoalID == "" {
+		return fmt.Errorf("%w: switch_to requires goal_id", contractx.ErrSchemaViolation)
+	}
 	if resp.Goal.Priority <= 0 {
 		return fmt.Errorf("%w: priority must be > 0", contractx.ErrSchemaViolation)
 	}
@@ -90,10 +123,29 @@ func validatePlannerResponse(resp contractx.PlannerResponse) error {
 	if len(resp.Goal.Missing) == 0 {
 		resp.Goal.NextQuestion = ""
 	}
+	for _, dep := range resp.DependentGoals {
+		if !isSupportedGoalType(dep.GoalType) {
+			return fmt.Errorf("%w: unsupported dependent goal_type=%q", contractx.ErrSchemaViolation, dep.GoalType)
+		}
+		if dep.SwitchTo {
+			return fmt.Errorf("%w: dependent goal cannot switch_to", contractx.ErrSchemaViolation)
+		}
+	}
+	for _, other := range resp.OtherGoals {
+		if !isSupportedGoalType(other.GoalType) {
+			return fmt.Errorf("%w: unsupported other goal_type=%q", contractx.ErrSchemaViolation, other.GoalType)
+		}
+		if other.SwitchTo {
+			return fmt.Errorf("%w: other goal cannot switch_to", contractx.ErrSchemaViolation)
+		}
+		if len(other.Missing) > 0 && other.NextQuestion == "" {
+			return fmt.Errorf("%w: blocked other goal must include next_question", contractx.ErrSchemaViolation)
+		}
+	}
 	return nil
 }
 
-func summarizeSession(st *statex.SessionState) map[string]any {
+func summarizeSession(st *statex.SessionState, budget transcriptBudget) map[string]any {
 	if st == nil {
 		return map[string]any{}
 	}
@@ -104,21 +156,48 @@ func summarizeSession(st *statex.SessionState) map[string]any {
 			continue
 		}
 		goals = append(goals, map[string]any{
-			"id":            id,
-			"type":          g.Type,
-			"status":        g.Status,
-			"priority":      g.Priority,
-			"slots":         g.Slots,
-			"missing":       g.Missing,
-			"next_question": g.NextQuestion,
+			"id":              id,
+			"type":            g.Type,
+			"status":          g.Status,
+			"priority":        g.Priority,
+			"slots":           g.Slots,
+			"slot_meta":       g.SlotMeta,
+			"missing":         g.Missing,
+			"next_question":   g.NextQuestion,
+			"pending_confirm": g.PendingConfirm,
+			"depends_on":      g.DependsOn,
 		})
 	}
 
 	return map[string]any{
-		"active_goal_id": st.ActiveGoalID,
-		"goal_stack":     st.GoalStack,
-		"goals":          goals,
+		"active_goal_id":       st.ActiveGoalID,
+		"goal_stack":           st.GoalStack,
+		"goals":                goals,
+		"goal_history":         st.GoalHistory,
+		"conversation_summary": st.ConversationSummary,
+		"transcript":           summarizeTranscript(st.Transcript, budget),
+	}
+}
+
+func trimGoalPatch(p contractx.GoalPatch) contractx.GoalPatch {
+	p.GoalID = strings.TrimSpace(p.GoalID)
+	p.GoalType = strings.TrimSpace(p.GoalType)
+	p.NextQuestion = strings.TrimSpace(p.NextQuestion)
+	p.DependsOn = trimGoalIDs(p.DependsOn)
+	return p
+}
+
+func trimGoalIDs(ids []string) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			out = append(out, id)
+		}
+	}
+	if len(out) == 0 {
+		return nil
 	}
+	return out
 }
 
 func isSupportedGoalType(goalType string) bool {
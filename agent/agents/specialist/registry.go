@@ -10,9 +10,10 @@ import (
 )
 
 type registryImpl struct {
-	planner contractx.Planner
-	sales   contractx.Specialist
-	support contractx.Specialist
+	planner    contractx.Planner
+	sales      contractx.Specialist
+	support    contractx.Specialist
+	summarizer contractx.Summarizer
 }
 
 func (r *registryImpl) Planner() contractx.Planner {
@@ -27,12 +28,20 @@ func (r *registryImpl) Support() contractx.Specialist {
 	return r.support
 }
 
+func (r *registryImpl) Summarizer() contractx.Summarizer {
+	return r.summarizer
+}
+
 func NewRegistry(ctx context.Context, cfg llmx.Config) (contractx.Registry, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
 	prompts := promptx.LoadPromptSet()
+	budget := transcriptBudget{
+		maxEntries: cfg.TranscriptMaxEntries,
+		maxTokens:  cfg.TranscriptMaxTokens,
+	}
 
 	orchestratorModelCfg := cfg.OpenRouterFor(contractx.AgentTypePlanner)
 	orchestratorModel, err := orchestratorModelCfg.New(ctx)
@@ -49,24 +58,35 @@ func NewRegistry(ctx context.Context, cfg llmx.Config) (contractx.Registry, erro
 	if err != nil {
 		return nil, fmt.Errorf("%w: create support model: %v", contractx.ErrModelInvoke, err)
 	}
+	summarizerModelCfg := cfg.OpenRouterFor(contractx.AgentTypeSummarizer)
+	summarizerModel, err := summarizerModelCfg.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: create summarizer model: %v", contractx.ErrModelInvoke, err)
+	}
 
-	planner, err := newPlanner(ctx, orchestratorModel, prompts.Planner)
+	planner, err := newPlanner(ctx, orchestratorModel, prompts.Planner, budget)
 	if err != nil {
 		return nil, err
 	}
 
-	sales, err := newSpecialist(ctx, contractx.AgentTypeSales, salesModel, prompts.Sales)
+	sales, err := newSpecialist(ctx, contractx.AgentTypeSales, salesModel, prompts.Sales, budget)
 	if err != nil {
 		return nil, err
 	}
-	support, err := newSpecialist(ctx, contractx.AgentTypeSupport, supportModel, prompts.Support)
+	support, err := newSpecialist(ctx, contractx.AgentTypeSupport, supportModel, prompts.Support, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	summarizer, err := newSummarizer(ctx, summarizerModel, prompts.Summarizer)
 	if err != nil {
 		return nil, err
 	}
 
 	return &registryImpl{
-		planner: planner,
-		sales:   sales,
-		support: support,
+		planner:    planner,
+		sales:      sales,
+		support:    support,
+		summarizer: summarizer,
 	}, nil
 }
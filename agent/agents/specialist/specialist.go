@@ -35,6 +35,7 @@ func newMessageFutureTrace() (einoagent.AgentOption, func() []contractx.ToolResu
 type specialistImpl struct {
 	agentType         contractx.AgentType
 	systemPrompt      string
+	budget            transcriptBudget
 	structuredRunner  compose.Runnable[map[string]any, specialistLLMOutput]
 	reactAgent        reactGenerator
 	reactTraceFactory reactTraceFactory
@@ -49,27 +50,36 @@ type specialistMode string
 
 const (
 	specialistModeAsk      specialistMode = "ask"
+	specialistModeConfirm  specialistMode = "confirm"
 	specialistModeAct      specialistMode = "act"
 	specialistModeFinalize specialistMode = "finalize"
+	specialistModeResume   specialistMode = "resume"
 )
 
 type specialistGoalSummary struct {
-	ID           string            `json:"id,omitempty"`
-	Type         string            `json:"type,omitempty"`
-	Status       statex.GoalStatus `json:"status,omitempty"`
-	Priority     int               `json:"priority,omitempty"`
-	Slots        map[string]any    `json:"slots,omitempty"`
-	Missing      []string          `json:"missing,omitempty"`
-	NextQuestion string            `json:"next_question,omitempty"`
+	ID             string                     `json:"id,omitempty"`
+	Type           string                     `json:"type,omitempty"`
+	Status         statex.GoalStatus          `json:"status,omitempty"`
+	Priority       int                        `json:"priority,omitempty"`
+	Slots          map[string]any             `json:"slots,omitempty"`
+	SlotMeta       map[string]statex.SlotMeta `json:"slot_meta,omitempty"`
+	Missing        []string                   `json:"missing,omitempty"`
+	NextQuestion   string                     `json:"next_question,omitempty"`
+	PendingConfirm []string                   `json:"pending_confirm,omitempty"`
 }
 
 type specialistPayload struct {
-	Mode          specialistMode         `json:"mode"`
-	UserMessage   string                 `json:"user_message"`
-	MemorySummary string                 `json:"memory_summary"`
-	ActiveGoal    specialistGoalSummary  `json:"active_goal"`
-	ToolResults   []contractx.ToolResult `json:"tool_results,omitempty"`
-	ActMessage    string                 `json:"act_message,omitempty"`
+	Mode                specialistMode          `json:"mode"`
+	UserMessage         string                  `json:"user_message"`
+	MemorySummary       string                  `json:"memory_summary"`
+	ConversationSummary string                  `json:"conversation_summary,omitempty"`
+	Transcript          []transcriptLine        `json:"transcript,omitempty"`
+	ActiveGoal          specialistGoalSummary   `json:"active_goal"`
+	OfferSwitch         *specialistGoalSummary  `json:"offer_switch,omitempty"`
+	FinishedGoal        *specialistGoalSummary  `json:"finished_goal,omitempty"`
+	QueuedGoals         []specialistGoalSummary `json:"queued_goals,omitempty"`
+	ToolResults         []contractx.ToolResult  `json:"tool_results,omitempty"`
+	ActMessage          string                  `json:"act_message,omitempty"`
 }
 
 type reactPhaseResult struct {
@@ -82,6 +92,7 @@ func newSpecialist(
 	agentType contractx.AgentType,
 	chatModel einomodel.ToolCallingChatModel,
 	systemPrompt string,
+	budget transcriptBudget,
 ) (*specialistImpl, error) {
 	structuredRunner, err := compileSpecialistStructuredGraph(ctx, chatModel, systemPrompt)
 	if err != nil {
@@ -119,6 +130,7 @@ func newSpecialist(
 	spec := &specialistImpl{
 		agentType:         agentType,
 		systemPrompt:      systemPrompt,
+		budget:            budget,
 		structuredRunner:  structuredRunner,
 		reactAgent:        reactAgent,
 		reactTraceFactory: newMessageFutureTrace,
@@ -135,13 +147,25 @@ func (s *specialistImpl) Run(ctx context.Context, req contractx.SpecialistReques
 		return contractx.SpecialistResponse{}, fmt.Errorf("%w: active goal type is required", contractx.ErrValidation)
 	}
 
+	if req.FinishedGoal != nil {
+		// The customer's message was already answered for FinishedGoal.
+		return s.runStructured(ctx, req, specialistModeResume, "")
+	}
+
 	isBlocked := req.ActiveGoal.IsBlocked() || len(req.ActiveGoal.Missing) > 0
-	if isBlocked {
-		return s.runStructured(ctx, req, true, "")
+	if !req.ActiveGoal.IsCancelled() {
+		switch {
+		case isBlocked:
+			return s.runStructured(ctx, req, specialistModeAsk, "")
+		case req.ActiveGoal.IsConfirming():
+			// Captured high-impact slots are read back before acting on them.
+			return s.runStructured(ctx, req, specialistModeConfirm, "")
+		}
 	}
 
-	if len(req.ToolResults) > 0 {
-		return s.runStructured(ctx, req, false, "")
+	// A cancelled goal only needs an acknowledgement, never tools.
+	if len(req.ToolResults) > 0 || req.ActiveGoal.IsCancelled() {
+		return s.runStructured(ctx, req, specialistModeFinalize, "")
 	}
 
 	reactOut, err := s.runReAct(ctx, req)
@@ -153,7 +177,7 @@ func (s *specialistImpl) Run(ctx context.Context, req contractx.SpecialistReques
 	if resp, ok := tryParseSpecialistJSONResponse(reactOut.ActMessage); ok {
 		return resp, nil
 	}
-	return s.runStructured(ctx, req, false, reactOut.ActMessage)
+	return s.runStructured(ctx, req, specialistModeFinalize, reactOut.ActMessage)
 }
 
 func tryParseSpecialistJSONResponse(raw string) (contractx.SpecialistResponse, bool) {
@@ -221,20 +245,20 @@ func parseSpecialistLLMOutput(raw string) (specialistLLMOutput, bool) {
 func (s *specialistImpl) runStructured(
 	ctx context.Context,
 	req contractx.SpecialistRequest,
-	isBlocked bool,
+	mode specialistMode,
 	actMessage string,
 ) (contractx.SpecialistResponse, error) {
-	mode := specialistModeFinalize
-	if isBlocked {
-		mode = specialistModeAsk
-	}
-
 	payload := specialistPayload{
-		Mode:          mode,
-		UserMessage:   req.UserMessage,
-		MemorySummary: req.MemorySummary,
-		ActiveGoal:    summarizeGoal(req.ActiveGoal),
-		ToolResults:   req.ToolResults,
+		Mode:                mode,
+		UserMessage:         req.UserMessage,
+		MemorySummary:       req.MemorySummary,
+		ConversationSummary: req.ConversationSummary,
+		Transcript:          summarizeTranscript(req.Transcript, s.budget),
+		ActiveGoal:          summarizeGoal(req.ActiveGoal),
+		OfferSwitch:         summarizeOffer(req.OfferSwitch),
+		FinishedGoal:        summarizeFinished(req.FinishedGoal),
+		QueuedGoals:         summarizeQueued(req.QueuedGoals),
+		ToolResults:         req.ToolResults,
 	}
 	if mode == specialistModeFinalize && len(req.ToolResults) == 0 {
 		if trimmed := strings.TrimSpace(actMessage); trimmed != "" {
@@ -278,10 +302,14 @@ func (s *specialistImpl) runReAct(
 	req contractx.SpecialistRequest,
 ) (reactPhaseResult, error) {
 	payload := specialistPayload{
-		Mode:          specialistModeAct,
-		UserMessage:   req.UserMessage,
-		MemorySummary: req.MemorySummary,
-		ActiveGoal:    summarizeGoal(req.ActiveGoal),
+		Mode:                specialistModeAct,
+		UserMessage:         req.UserMessage,
+		MemorySummary:       req.MemorySummary,
+		ConversationSummary: req.ConversationSummary,
+		Transcript:          summarizeTranscript(req.Transcript, s.budget),
+		ActiveGoal:          summarizeGoal(req.ActiveGoal),
+		OfferSwitch:         summarizeOffer(req.OfferSwitch),
+		QueuedGoals:         summarizeQueued(req.QueuedGoals),
 	}
 	input, err := json.Marshal(payload)
 	if err != nil {
@@ -422,17 +450,48 @@ func parseToolResultMessage(msg *schema.Message) (contractx.ToolResult, bool) {
 	return result, true
 }
 
+// summarizeOffer describes a goal the reply should offer to switch to.
+func summarizeOffer(g *statex.Goal) *specialistGoalSummary {
+	if g == nil {
+		return nil
+	}
+	return &specialistGoalSummary{ID: g.ID, Type: g.Type, Slots: g.Slots}
+}
+
+// summarizeQueued describes the goals from the same message that wait for the
+// active goal.
+func summarizeQueued(goals []*statex.Goal) []specialistGoalSummary {
+	var out []specialistGoalSummary
+	for _, g := range goals {
+		if g != nil {
+			out = append(out, specialistGoalSummary{ID: g.ID, Type: g.Type, Slots: g.Slots})
+		}
+	}
+	return out
+}
+
+// summarizeFinished describes the goal that closed just before the active goal
+// was resumed.
+func summarizeFinished(g *statex.Goal) *specialistGoalSummary {
+	if g == nil {
+		return nil
+	}
+	return &specialistGoalSummary{ID: g.ID, Type: g.Type, Status: g.Status, Slots: g.Slots}
+}
+
 func summarizeGoal(g *statex.Goal) specialistGoalSummary {
 	if g == nil {
 		return specialistGoalSummary{}
 	}
 	return specialistGoalSummary{
-		ID:           g.ID,
-		Type:         g.Type,
-		Status:       g.Status,
-		Priority:     g.Priority,
-		Slots:        g.Slots,
-		Missing:      g.Missing,
-		NextQuestion: g.NextQuestion,
+		ID:             g.ID,
+		Type:           g.Type,
+		Status:         g.Status,
+		Priority:       g.Priority,
+		Slots:          g.Slots,
+		SlotMeta:       g.SlotMeta,
+		Missing:        g.Missing,
+		PendingConfirm: g.PendingConfirm,
+		NextQuestion:   g.NextQuestion,
 	}
 }
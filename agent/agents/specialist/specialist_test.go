@@ -144,8 +144,7 @@ func TestSpecialistRunBlockedUsesStructuredAsk(t *testing.T) {
 		reactAgent:       reactGen,
 	}
 
-	goal := statex.CreateGoal("g1", "sales.recommend_item", 50, time.Now())
-	goal.SetMissing([]string{"budget"}, "budget เท่าไหร่ครับ")
+	goal := blockedGoal(t, "budget เท่าไหร่ครับ")
 
 	resp, err := spec.Run(context.Background(), contractx.SpecialistRequest{
 		UserMessage:   "ช่วยแนะนำเมาส์",
@@ -166,6 +165,108 @@ func TestSpecialistRunBlockedUsesStructuredAsk(t *testing.T) {
 	}
 }
 
+func TestSpecialistRunConfirmingUsesStructuredConfirm(t *testing.T) {
+	t.Parallel()
+
+	structured := &fakeStructuredRunner{
+		invoke: func(ctx context.Context, in map[string]any) (specialistLLMOutput, error) {
+			payload := mustDecodePayload(t, in)
+			if payload["mode"] != "confirm" {
+				t.Fatalf("expected mode=confirm, got %v", payload["mode"])
+			}
+			goal := payload["active_goal"].(map[string]any)
+			if pending := goal["pending_confirm"].([]any); len(pending) != 1 || pending[0] != "budget" {
+				t.Fatalf("expected pending_confirm=[budget], got %v", goal["pending_confirm"])
+			}
+			return specialistLLMOutput{Message: "ขอยืนยันนะครับ งบ 35,000 บาทใช่ไหมครับ"}, nil
+		},
+	}
+	reactGen := &fakeReactGenerator{
+		generate: func(ctx context.Context, in []*schema.Message) (*schema.Message, error) {
+			return nil, errors.New("react should not be called before confirmation")
+		},
+	}
+
+	spec := &specialistImpl{
+		agentType:        contractx.AgentTypeSales,
+		systemPrompt:     "sales-prompt",
+		structuredRunner: structured,
+		reactAgent:       reactGen,
+	}
+
+	goal := statex.CreateGoal("g1", "sales.recommend_item", 50, time.Now())
+	goal.SetSlot("budget", 35000)
+	goal.PendingConfirm = []string{"budget"}
+
+	resp, err := spec.Run(context.Background(), contractx.SpecialistRequest{
+		UserMessage: "งบ 35k ครับ",
+		ActiveGoal:  goal,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(resp.Message, "ยืนยัน") {
+		t.Fatalf("unexpected message: %q", resp.Message)
+	}
+	if reactGen.calls != 0 || structured.Calls() != 1 {
+		t.Fatalf("expected one structured call and no react, got structured=%d react=%d", structured.Calls(), reactGen.calls)
+	}
+}
+
+func TestSpecialistRunResumeBridgesBackToActiveGoal(t *testing.T) {
+	t.Parallel()
+
+	structured := &fakeStructuredRunner{
+		invoke: func(ctx context.Context, in map[string]any) (specialistLLMOutput, error) {
+			payload := mustDecodePayload(t, in)
+			if payload["mode"] != "resume" {
+				t.Fatalf("expected mode=resume, got %v", payload["mode"])
+			}
+			if goal := payload["active_goal"].(map[string]any); goal["next_question"] != "ใช้งานแบบไหนครับ" {
+				t.Fatalf("expected active_goal.next_question, got %v", goal["next_question"])
+			}
+			if finished := payload["finished_goal"].(map[string]any); finished["id"] != "g_screen" || finished["status"] != "done" {
+				t.Fatalf("unexpected finished_goal: %v", finished)
+			}
+			return specialistLLMOutput{Message: "เรื่องจอเรียบร้อยแล้ว ไปต่อเรื่องโน้ตบุ๊กกันไหมครับ"}, nil
+		},
+	}
+	reactGen := &fakeReactGenerator{
+		generate: func(ctx context.Context, in []*schema.Message) (*schema.Message, error) {
+			return nil, errors.New("react should not be called for a bridge")
+		},
+	}
+
+	spec := &specialistImpl{
+		agentType:        contractx.AgentTypeSales,
+		systemPrompt:     "sales-prompt",
+		structuredRunner: structured,
+		reactAgent:       reactGen,
+	}
+
+	now := time.Now()
+	laptop := statex.CreateGoal("g_laptop", "sales.recommend_item", 50, now)
+	laptop.SetSlot("budget", 35000)
+	laptop.NextQuestion = "ใช้งานแบบไหนครับ"
+	screen := statex.CreateGoal("g_screen", "support.troubleshoot", 100, now)
+	screen.Status = statex.GoalDone
+
+	resp, err := spec.Run(context.Background(), contractx.SpecialistRequest{
+		UserMessage:  "หายแล้วครับ",
+		ActiveGoal:   laptop,
+		FinishedGoal: screen,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(resp.Message, "โน้ตบุ๊ก") {
+		t.Fatalf("unexpected message: %q", resp.Message)
+	}
+	if reactGen.calls != 0 || structured.Calls() != 1 {
+		t.Fatalf("expected one structured call and no react, got structured=%d react=%d", structured.Calls(), reactGen.calls)
+	}
+}
+
 func TestSpecialistRunActiveToolThenFinalize(t *testing.T) {
 	t.Parallel()
 
@@ -413,8 +514,7 @@ func TestSpecialistRunStructuredMissingRequiresNextQuestion(t *testing.T) {
 		reactAgent:       &fakeReactGenerator{},
 	}
 
-	goal := statex.CreateGoal("g1", "sales.recommend_item", 50, time.Now())
-	goal.SetMissing([]string{"budget"}, "budget เท่าไหร่ครับ")
+	goal := blockedGoal(t, "budget เท่าไหร่ครับ")
 
 	_, err := spec.Run(context.Background(), contractx.SpecialistRequest{
 		UserMessage: "ช่วยแนะนำของ",
@@ -526,6 +626,49 @@ func TestSpecialistRunConcurrentToolResultsIsolation(t *testing.T) {
 	}
 }
 
+func TestSpecialistRunPayloadIncludesBudgetedTranscript(t *testing.T) {
+	t.Parallel()
+
+	structured := &fakeStructuredRunner{
+		invoke: func(ctx context.Context, in map[string]any) (specialistLLMOutput, error) {
+			payload := mustDecodePayload(t, in)
+			transcript, ok := payload["transcript"].([]any)
+			if !ok || len(transcript) != 2 {
+				t.Fatalf("expected two transcript lines, got %#v", payload["transcript"])
+			}
+			last, _ := transcript[1].(map[string]any)
+			if last["text"] != "รุ่น A ครับ" || last["role"] != "assistant" {
+				t.Fatalf("unexpected last transcript line: %#v", last)
+			}
+			return specialistLLMOutput{Message: "งบเท่าไหร่ครับ"}, nil
+		},
+	}
+
+	spec := &specialistImpl{
+		agentType:        contractx.AgentTypeSales,
+		systemPrompt:     "sales-prompt",
+		budget:           transcriptBudget{maxEntries: 2},
+		structuredRunner: structured,
+		reactAgent:       &fakeReactGenerator{},
+	}
+
+	goal := blockedGoal(t, "งบเท่าไหร่ครับ")
+
+	_, err := spec.Run(context.Background(), contractx.SpecialistRequest{
+		UserMessage: "อันนั้นมีสีดำไหม",
+		Transcript: []statex.TranscriptEntry{
+			{Turn: 1, Role: statex.TranscriptRoleUser, Text: "แนะนำเมาส์"},
+			{Turn: 1, Role: statex.TranscriptRoleAssistant, Text: "งบเท่าไหร่ครับ"},
+			{Turn: 2, Role: statex.TranscriptRoleUser, Text: "ตัวไหนดี"},
+			{Turn: 2, Role: statex.TranscriptRoleAssistant, Text: "รุ่น A ครับ"},
+		},
+		ActiveGoal: goal,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
 func TestExtractToolResultsFromMessagesParsesInOrder(t *testing.T) {
 	t.Parallel()
 
@@ -631,3 +774,19 @@ func mustDecodePayload(t *testing.T, in map[string]any) map[string]any {
 	}
 	return payload
 }
+
+// blockedGoal returns a sales goal blocked on its budget, set up through a
+// session so the goal machine moves it to blocked.
+func blockedGoal(t *testing.T, question string) *statex.Goal {
+	t.Helper()
+	now := time.Now()
+	st := statex.NewSessionState("s1", "w", "c", "chat", now)
+	goal := statex.CreateGoal("g1", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(goal); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	if err := st.SetGoalMissing(goal.ID, []string{"budget"}, question, now); err != nil {
+		t.Fatalf("SetGoalMissing() error = %v", err)
+	}
+	return goal
+}
@@ -0,0 +1,56 @@
+package specialist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+)
+
+type summarizerImpl struct {
+	runner compose.Runnable[map[string]any, summarizerLLMOutput]
+}
+
+type summarizerLLMOutput struct {
+	Summary string `json:"summary"`
+}
+
+func newSummarizer(ctx context.Context, chatModel einomodel.BaseChatModel, systemPrompt string) (*summarizerImpl, error) {
+	runner, err := compileStructuredLLMGraph[summarizerLLMOutput](ctx, chatModel, systemPrompt, "summarizer.model_graph")
+	if err != nil {
+		return nil, fmt.Errorf("%w: compile summarizer graph: %v", contractx.ErrModelInvoke, err)
+	}
+	return &summarizerImpl{runner: runner}, nil
+}
+
+func (s *summarizerImpl) Summarize(ctx context.Context, req contractx.SummarizeRequest) (contractx.SummarizeResponse, error) {
+	if len(req.Entries) == 0 {
+		return contractx.SummarizeResponse{Summary: req.PreviousSummary}, nil
+	}
+
+	payload := map[string]any{
+		"previous_summary": req.PreviousSummary,
+		"entries":          summarizeTranscript(req.Entries, transcriptBudget{}),
+	}
+	inputBytes, err := json.Marshal(payload)
+	if err != nil {
+		return contractx.SummarizeResponse{}, fmt.Errorf("%w: marshal summarizer payload: %v", contractx.ErrValidation, err)
+	}
+
+	out, err := s.runner.Invoke(ctx, map[string]any{
+		"input": string(inputBytes),
+	})
+	if err != nil {
+		return contractx.SummarizeResponse{}, fmt.Errorf("%w: summarizer invoke: %v", contractx.ErrModelInvoke, err)
+	}
+
+	summary := strings.TrimSpace(out.Summary)
+	if summary == "" {
+		return contractx.SummarizeResponse{}, fmt.Errorf("%w: summary is empty", contractx.ErrSchemaViolation)
+	}
+	return contractx.SummarizeResponse{Summary: summary}, nil
+}
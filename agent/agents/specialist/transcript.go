@@ -0,0 +1,38 @@
+package specialist
+
+import (
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+// transcriptBudget bounds how much conversation history goes into a prompt.
+// Zero values mean unlimited.
+type transcriptBudget struct {
+	maxEntries int
+	maxTokens  int
+}
+
+type transcriptLine struct {
+	Turn    int                   `json:"turn"`
+	Role    statex.TranscriptRole `json:"role"`
+	Text    string                `json:"text"`
+	GoalID  string                `json:"goal_id,omitempty"`
+	Rewound bool                  `json:"rewound,omitempty"`
+}
+
+func summarizeTranscript(entries []statex.TranscriptEntry, budget transcriptBudget) []transcriptLine {
+	recent := statex.TrimTranscript(entries, budget.maxEntries, budget.maxTokens)
+	if len(recent) == 0 {
+		return nil
+	}
+	lines := make([]transcriptLine, 0, len(recent))
+	for _, e := range recent {
+		lines = append(lines, transcriptLine{
+			Turn:    e.Turn,
+			Role:    e.Role,
+			Text:    e.Text,
+			GoalID:  e.GoalID,
+			Rewound: e.Rewound,
+		})
+	}
+	return lines
+}
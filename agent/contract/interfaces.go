@@ -10,10 +10,16 @@ type Specialist interface {
 	Run(ctx context.Context, req SpecialistRequest) (SpecialistResponse, error)
 }
 
+// Summarizer compresses older transcript entries into a running conversation summary.
+type Summarizer interface {
+	Summarize(ctx context.Context, req SummarizeRequest) (SummarizeResponse, error)
+}
+
 type Registry interface {
 	Planner() Planner
 	Sales() Specialist
 	Support() Specialist
+	Summarizer() Summarizer
 }
 
 type MemoryStore interface {
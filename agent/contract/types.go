@@ -9,9 +9,10 @@ import (
 type AgentType string
 
 const (
-	AgentTypePlanner AgentType = "planner"
-	AgentTypeSales   AgentType = "sales"
-	AgentTypeSupport AgentType = "support"
+	AgentTypePlanner    AgentType = "planner"
+	AgentTypeSales      AgentType = "sales"
+	AgentTypeSupport    AgentType = "support"
+	AgentTypeSummarizer AgentType = "summarizer"
 )
 
 type PlannerRequest struct {
@@ -19,10 +20,24 @@ type PlannerRequest struct {
 	MemorySummary string               `json:"memory_summary"`
 	Session       *statex.SessionState `json:"session"`
 	Now           time.Time            `json:"now"`
+	// SlotSchemas describes the goal types with a fixed slot schema, one per
+	// line, as rendered by the orchestrator's slot registry.
+	SlotSchemas string `json:"slot_schemas,omitempty"`
 }
 
 type PlannerResponse struct {
 	Goal GoalPatch `json:"goal"`
+	// CancelGoalIDs are existing goals the customer dropped. Goal may be left
+	// empty when the message only cancels.
+	CancelGoalIDs []string `json:"cancel_goal_ids,omitempty"`
+	// DependentGoals are goals to create or update that wait for Goal: each one
+	// depends on Goal in addition to its own DependsOn.
+	DependentGoals []GoalPatch `json:"dependent_goals,omitempty"`
+	// OtherGoals are further, independent requests in the same message, e.g.
+	// "my mouse double-clicks, and do you have a cheaper keyboard?". The
+	// highest-priority goal of Goal and OtherGoals is worked on first and the
+	// others are queued beneath it by priority.
+	OtherGoals []GoalPatch `json:"other_goals,omitempty"`
 }
 
 type GoalPatch struct {
@@ -32,13 +47,36 @@ type GoalPatch struct {
 	SlotsPatch   map[string]any `json:"slots_patch,omitempty"`
 	Missing      []string       `json:"missing,omitempty"`
 	NextQuestion string         `json:"next_question,omitempty"`
+	// SlotSources says where the values in SlotsPatch came from; slots without
+	// an entry are recorded as planner inferences.
+	SlotSources map[string]SlotProvenance `json:"slot_sources,omitempty"`
+	// Confirmations answers a goal's pending confirmations: true keeps the slot
+	// value, false discards it so it is asked for again.
+	Confirmations map[string]bool `json:"confirmations,omitempty"`
+	// SwitchTo asks to make the existing goal GoalID the active goal again,
+	// wherever it sits on the stack and regardless of priority.
+	SwitchTo bool `json:"switch_to,omitempty"`
+	// DependsOn adds existing goals that must be done before this goal can
+	// become active.
+	DependsOn []string `json:"depends_on,omitempty"`
 }
 
 type SpecialistRequest struct {
-	UserMessage   string       `json:"user_message"`
-	MemorySummary string       `json:"memory_summary"`
-	ActiveGoal    *statex.Goal `json:"active_goal"`
-	ToolResults   []ToolResult `json:"tool_results,omitempty"`
+	UserMessage         string                   `json:"user_message"`
+	MemorySummary       string                   `json:"memory_summary"`
+	ConversationSummary string                   `json:"conversation_summary,omitempty"`
+	Transcript          []statex.TranscriptEntry `json:"transcript,omitempty"` // prior turns, oldest first
+	ActiveGoal          *statex.Goal             `json:"active_goal"`
+	ToolResults         []ToolResult             `json:"tool_results,omitempty"`
+	// OfferSwitch is another goal the customer raised; the reply should ask
+	// whether to handle it first.
+	OfferSwitch *statex.Goal `json:"offer_switch,omitempty"`
+	// FinishedGoal is set when ActiveGoal was resumed because FinishedGoal
+	// just closed; the reply only bridges back to ActiveGoal.
+	FinishedGoal *statex.Goal `json:"finished_goal,omitempty"`
+	// QueuedGoals are other requests from the same message that are handled
+	// after ActiveGoal; the reply acknowledges them.
+	QueuedGoals []*statex.Goal `json:"queued_goals,omitempty"`
 }
 
 type SpecialistResponse struct {
@@ -48,12 +86,32 @@ type SpecialistResponse struct {
 }
 
 type StateUpdates struct {
-	SlotsPatch   map[string]any `json:"slots_patch,omitempty"`
-	SetStatus    string         `json:"set_status,omitempty"`
-	Missing      []string       `json:"missing,omitempty"`
-	NextQuestion string         `json:"next_question,omitempty"`
-	MemoryUpdate string         `json:"memory_update,omitempty"`
-	MarkDone     bool           `json:"mark_done,omitempty"`
+	SlotsPatch map[string]any `json:"slots_patch,omitempty"`
+	// SlotSources says where the values in SlotsPatch came from; slots without
+	// an entry are recorded as set by the specialist.
+	SlotSources map[string]SlotProvenance `json:"slot_sources,omitempty"`
+	// Confirmations answers the goal's pending confirmations, as in GoalPatch.
+	Confirmations map[string]bool `json:"confirmations,omitempty"`
+	SetStatus     string          `json:"set_status,omitempty"`
+	Missing       []string        `json:"missing,omitempty"`
+	NextQuestion  string          `json:"next_question,omitempty"`
+	MemoryUpdate  string          `json:"memory_update,omitempty"`
+	MarkDone      bool            `json:"mark_done,omitempty"`
+}
+
+// SlotProvenance is the origin a model reports for one slot value.
+type SlotProvenance struct {
+	Source     statex.SlotSource `json:"source"`
+	Confidence *float64          `json:"confidence,omitempty"`
+}
+
+type SummarizeRequest struct {
+	PreviousSummary string                   `json:"previous_summary"`
+	Entries         []statex.TranscriptEntry `json:"entries"` // entries to fold into the summary, oldest first
+}
+
+type SummarizeResponse struct {
+	Summary string `json:"summary"`
 }
 
 type ToolRequest struct {
@@ -22,9 +22,15 @@ type Config struct {
 	OrchestratorModel       string  `envconfig:"ORCHESTRATOR_MODEL" split_words:"true"`
 	SalesModel              string  `envconfig:"SALES_MODEL" split_words:"true"`
 	SupportModel            string  `envconfig:"SUPPORT_MODEL" split_words:"true"`
+	SummarizerModel         string  `envconfig:"SUMMARIZER_MODEL" split_words:"true"`
 	OrchestratorTemperature float32 `envconfig:"ORCHESTRATOR_TEMPERATURE" split_words:"true" default:"-1"`
 	SalesTemperature        float32 `envconfig:"SALES_TEMPERATURE" split_words:"true" default:"-1"`
 	SupportTemperature      float32 `envconfig:"SUPPORT_TEMPERATURE" split_words:"true" default:"-1"`
+	SummarizerTemperature   float32 `envconfig:"SUMMARIZER_TEMPERATURE" split_words:"true" default:"-1"`
+
+	// Transcript budget for planner and specialist prompts (<= 0 means unlimited).
+	TranscriptMaxEntries int `envconfig:"TRANSCRIPT_MAX_ENTRIES" split_words:"true" default:"12"`
+	TranscriptMaxTokens  int `envconfig:"TRANSCRIPT_MAX_TOKENS" split_words:"true" default:"1500"`
 }
 
 func (c Config) Validate() error {
@@ -63,6 +69,13 @@ func (c Config) OpenRouterFor(agentType contractx.AgentType) openrouterx.Config
 		if c.SupportTemperature >= 0 {
 			temp = c.SupportTemperature
 		}
+	case contractx.AgentTypeSummarizer:
+		if v := strings.TrimSpace(c.SummarizerModel); v != "" {
+			modelName = v
+		}
+		if c.SummarizerTemperature >= 0 {
+			temp = c.SummarizerTemperature
+		}
 	}
 
 	maxCompletionToken := c.MaxCompletionToken
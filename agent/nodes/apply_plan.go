@@ -1,87 +1,449 @@
 package orchestratornode
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/rs/zerolog/log"
+
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	slotx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/slot"
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
-func ApplyPlan(in *GraphState) (*GraphState, error) {
+// ApplyPlan merges the planner's goal patches into the session. For goal types
+// with a slot schema, slot values the schema rejects are dropped and
+// Missing/NextQuestion are computed from the schema instead of taken from the
+// planner. Goals that wait for a goal they depend on are never activated; their
+// prerequisite runs first. Whether a goal interrupts the active one is up to
+// policy (PriorityPolicy if nil); a goal that may not interrupt is queued
+// beneath the active goal. When the message raised several goals, the
+// highest-priority one is handled that way and the others are queued beneath
+// the active goal too. A policy that resumes suspended goals on its own (see
+// ResumingPolicy) may then replace an active goal the plan left in place.
+func ApplyPlan(in *GraphState, schemas *slotx.Registry, policy InterleavePolicy) (*GraphState, error) {
 	if in == nil || in.Session == nil {
 		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
 	}
+	if policy == nil {
+		policy = PriorityPolicy{}
+	}
 
-	activeGoal, err := applyPlan(in.Session, in.PlanResp, in.Now)
+	out, err := applyPlan(in.Session, in.PlanResp, schemas, policy, in.Now)
 	if err != nil {
 		return nil, err
 	}
-	if activeGoal == nil {
+	if out.active == nil {
 		return nil, ErrNoActiveGoal
 	}
 
-	in.ActiveGoal = activeGoal
+	in.ActiveGoal = out.active
+	in.OfferSwitch = out.offer
+	in.QueuedGoals = out.queued
 	return in, nil
 }
 
+// planOutcome is what applyPlan decided for the turn.
+type planOutcome struct {
+	// active is the goal to work on this turn.
+	active *statex.Goal
+	// offer is the goal the policy asks the customer about before switching.
+	offer *statex.Goal
+	// queued are the plan's goals left for after active, highest priority first.
+	queued []*statex.Goal
+}
+
+// plannedGoal is a goal the plan created or updated.
+type plannedGoal struct {
+	goal     *statex.Goal
+	created  bool
+	switchTo bool
+}
+
 func applyPlan(
 	st *statex.SessionState,
 	plan contractx.PlannerResponse,
+	schemas *slotx.Registry,
+	policy InterleavePolicy,
 	now time.Time,
-) (*statex.Goal, error) {
+) (planOutcome, error) {
 	if st == nil {
-		return nil, fmt.Errorf("%w: session state is nil", contractx.ErrValidation)
+		return planOutcome{}, fmt.Errorf("%w: session state is nil", contractx.ErrValidation)
+	}
+
+	cancelled, err := cancelGoals(st, plan.CancelGoalIDs, now)
+	if err != nil {
+		return planOutcome{}, err
+	}
+	if len(plan.CancelGoalIDs) > 0 && strings.TrimSpace(plan.Goal.GoalType) == "" && strings.TrimSpace(plan.Goal.GoalID) == "" {
+		// Cancellation only: continue with the resumed (or untouched) goal, or
+		// let the cancelled goal's specialist acknowledge when nothing is left.
+		if active := st.ActiveGoal(); active != nil {
+			return planOutcome{active: active}, nil
+		}
+		if cancelled != nil {
+			return planOutcome{active: cancelled}, nil
+		}
 	}
 
 	goalType := strings.TrimSpace(plan.Goal.GoalType)
 	if !strings.HasPrefix(goalType, "sales.") && !strings.HasPrefix(goalType, "support.") {
-		return nil, fmt.Errorf("%w: unsupported goal type=%q", contractx.ErrValidation, goalType)
+		return planOutcome{}, fmt.Errorf("%w: unsupported goal type=%q", contractx.ErrValidation, goalType)
 	}
 
-	targetGoal, created, err := findOrCreateGoal(st, plan.Goal, now)
+	targetGoal, created, err := findOrCreateGoal(st, plan.Goal, policy, now)
 	if err != nil {
-		return nil, err
+		return planOutcome{}, err
+	}
+	if err := mergeGoalPatch(st, targetGoal, plan.Goal, schemas, policy, now); err != nil {
+		return planOutcome{}, err
+	}
+	if err := addDependencies(st, targetGoal, plan.Goal.DependsOn, now); err != nil {
+		return planOutcome{}, err
 	}
 
-	if plan.Goal.Priority > 0 {
-		targetGoal.Priority = plan.Goal.Priority
-	} else if targetGoal.Priority <= 0 {
-		targetGoal.Priority = defaultPriorityForGoalType(goalType)
+	planned := []plannedGoal{{goal: targetGoal, created: created, switchTo: plan.Goal.SwitchTo}}
+	for _, patch := range plan.OtherGoals {
+		g, created, err := upsertGoal(st, patch, schemas, policy, now)
+		if err != nil {
+			return planOutcome{}, err
+		}
+		if err := addDependencies(st, g, patch.DependsOn, now); err != nil {
+			return planOutcome{}, err
+		}
+		planned = append(planned, plannedGoal{goal: g, created: created})
 	}
-	targetGoal.Type = goalType
+	lead, rest := orderPlannedGoals(planned)
+
+	// SetActiveGoal stamps its events with the session's UpdatedAt.
+	st.Touch(now)
 
-	for k, v := range plan.Goal.SlotsPatch {
-		targetGoal.SetSlot(k, v)
+	var out planOutcome
+	current := st.ActiveGoal()
+	switch {
+	case st.IsWaiting(lead.goal):
+		if err := deferGoal(st, lead.goal, now); err != nil {
+			return planOutcome{}, err
+		}
+	case lead.switchTo && !lead.created:
+		if err := st.SwitchToGoal(lead.goal.ID, now); err != nil {
+			return planOutcome{}, invalidTransition(err)
+		}
+	case current == nil && lead.created:
+		if err := st.SuspendAndActivate(lead.goal.ID, now); err != nil {
+			return planOutcome{}, err
+		}
+	case current == nil:
+		// Nothing is active, e.g. after retention suspended an idle goal.
+		if err := st.SwitchToGoal(lead.goal.ID, now); err != nil {
+			return planOutcome{}, invalidTransition(err)
+		}
+	case current.ID != lead.goal.ID:
+		switch policy.Decide(st, current, lead.goal, now) {
+		case InterleaveSwitch:
+			if err := st.SuspendAndActivate(lead.goal.ID, now); err != nil {
+				return planOutcome{}, err
+			}
+		case InterleaveStay:
+			// Handled after the current goal, like the message's other goals.
+			rest = append([]plannedGoal{lead}, rest...)
+		case InterleaveAsk:
+			// Parked until the customer agrees and the planner switches to it.
+			if lead.goal.Status == statex.GoalActive {
+				if err := st.SetGoalStatus(lead.goal.ID, statex.GoalSuspended, now); err != nil {
+					return planOutcome{}, invalidTransition(err)
+				}
+			}
+			out.offer = lead.goal
+		}
+	}
+
+	for _, patch := range plan.DependentGoals {
+		if err := addDependentGoal(st, targetGoal, patch, schemas, policy, now); err != nil {
+			return planOutcome{}, err
+		}
 	}
-	targetGoal.SetMissing(plan.Goal.Missing, plan.Goal.NextQuestion)
-	targetGoal.UpdatedAt = now.UTC()
 
+	if out.queued, err = queueGoals(st, rest, now); err != nil {
+		return planOutcome{}, err
+	}
+	if current != nil && st.ActiveGoalID == current.ID && out.offer == nil && !lead.switchTo {
+		if out.offer, err = resumeSuspendedGoal(st, policy, now); err != nil {
+			return planOutcome{}, err
+		}
+	}
+	out.active = st.ActiveGoal()
+	return out, nil
+}
+
+// resumeSuspendedGoal lets a ResumingPolicy bring a suspended goal back in
+// place of the active goal, subject to the policy's Decide. It returns the goal
+// when the policy asks the customer first instead.
+func resumeSuspendedGoal(st *statex.SessionState, policy InterleavePolicy, now time.Time) (*statex.Goal, error) {
 	current := st.ActiveGoal()
-	if created {
-		if shouldInterleave(current, targetGoal) {
-			if err := st.SuspendAndActivate(targetGoal.ID, now); err != nil {
+	if current == nil || current.IsClosed() {
+		return nil, nil
+	}
+	candidate := resumeCandidate(policy, st, current, now)
+	if candidate == nil {
+		return nil, nil
+	}
+	switch policy.Decide(st, current, candidate, now) {
+	case InterleaveSwitch:
+		if err := st.SwitchToGoal(candidate.ID, now); err != nil {
+			return nil, invalidTransition(err)
+		}
+	case InterleaveAsk:
+		return candidate, nil
+	}
+	return nil, nil
+}
+
+// orderPlannedGoals returns the goal to handle first, the one the planner
+// switches to or else the highest-priority one, and the others by descending
+// priority. Ties keep the planner's order, and a goal listed twice counts once.
+func orderPlannedGoals(planned []plannedGoal) (plannedGoal, []plannedGoal) {
+	var goals []plannedGoal
+	for _, p := range planned {
+		if !slices.ContainsFunc(goals, func(q plannedGoal) bool { return q.goal.ID == p.goal.ID }) {
+			goals = append(goals, p)
+		}
+	}
+	slices.SortStableFunc(goals, func(a, b plannedGoal) int {
+		if a.switchTo != b.switchTo {
+			if a.switchTo {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(b.goal.Priority, a.goal.Priority)
+	})
+	return goals[0], goals[1:]
+}
+
+// queueGoals queues the open goals of rest beneath the active goal, lowest
+// priority first so the most urgent one is resumed next, and returns them
+// highest priority first. Goals that wait for a dependency are deferred
+// instead; they start on their own once it is done.
+func queueGoals(st *statex.SessionState, rest []plannedGoal, now time.Time) ([]*statex.Goal, error) {
+	var queued []*statex.Goal
+	for _, p := range slices.Backward(rest) {
+		g := p.goal
+		switch {
+		case g.ID == st.ActiveGoalID || g.IsClosed():
+			continue
+		case st.IsWaiting(g):
+			if err := deferGoal(st, g, now); err != nil {
 				return nil, err
 			}
+		default:
+			if err := st.QueueGoal(g.ID, now); err != nil {
+				return nil, invalidTransition(err)
+			}
+		}
+		queued = append(queued, g)
+	}
+	slices.Reverse(queued)
+	return queued, nil
+}
+
+// mergeGoalPatch applies a planner goal patch to g: priority, type, slots,
+// confirmations and missing slots.
+func mergeGoalPatch(
+	st *statex.SessionState,
+	g *statex.Goal,
+	patch contractx.GoalPatch,
+	schemas *slotx.Registry,
+	policy InterleavePolicy,
+	now time.Time,
+) error {
+	goalType := strings.TrimSpace(patch.GoalType)
+	priority := g.Priority
+	if patch.Priority > 0 {
+		priority = patch.Priority
+	} else if priority <= 0 {
+		priority = policy.Priority(goalType)
+	}
+	if err := st.SetGoalPriority(g.ID, priority, now); err != nil {
+		return err
+	}
+	if err := st.SetGoalType(g.ID, goalType, now); err != nil {
+		return err
+	}
+	changed, err := patchSlots(st, g, patch.SlotsPatch, patch.SlotSources, statex.SlotSourcePlanner, schemas, now)
+	if err != nil {
+		return err
+	}
+	if err := applyConfirmations(st, g, changed, patch.Confirmations, schemas, now); err != nil {
+		return err
+	}
+	missing, nextQuestion := patch.Missing, patch.NextQuestion
+	if schema, ok := schemas.Lookup(goalType); ok {
+		missing, nextQuestion = schema.Missing(g.Slots)
+	}
+	if err := st.SetGoalMissing(g.ID, missing, nextQuestion, now); err != nil {
+		return invalidTransition(err)
+	}
+	return nil
+}
+
+// addDependencies adds deps to the goals g depends on. Unknown goals and
+// cycles are validation errors of the plan.
+func addDependencies(st *statex.SessionState, g *statex.Goal, deps []string, now time.Time) error {
+	if len(deps) == 0 {
+		return nil
+	}
+	err := st.SetGoalDependencies(g.ID, append(slices.Clone(g.DependsOn), deps...), now)
+	if errors.Is(err, statex.ErrGoalNotFound) || errors.Is(err, statex.ErrDependencyCycle) {
+		return fmt.Errorf("%w: %w", contractx.ErrValidation, err)
+	}
+	return err
+}
+
+// addDependentGoal creates or updates the goal described by patch and makes it
+// wait for prereq.
+func addDependentGoal(
+	st *statex.SessionState,
+	prereq *statex.Goal,
+	patch contractx.GoalPatch,
+	schemas *slotx.Registry,
+	policy InterleavePolicy,
+	now time.Time,
+) error {
+	g, _, err := upsertGoal(st, patch, schemas, policy, now)
+	if err != nil {
+		return err
+	}
+	if err := addDependencies(st, g, append(slices.Clone(patch.DependsOn), prereq.ID), now); err != nil {
+		return err
+	}
+	return deferGoal(st, g, now)
+}
+
+// upsertGoal merges patch into the open goal patch.GoalID, or into a new goal
+// when there is no such goal, and reports whether it created one.
+func upsertGoal(
+	st *statex.SessionState,
+	patch contractx.GoalPatch,
+	schemas *slotx.Registry,
+	policy InterleavePolicy,
+	now time.Time,
+) (*statex.Goal, bool, error) {
+	goalType := strings.TrimSpace(patch.GoalType)
+	if !strings.HasPrefix(goalType, "sales.") && !strings.HasPrefix(goalType, "support.") {
+		return nil, false, fmt.Errorf("%w: unsupported goal type=%q", contractx.ErrValidation, goalType)
+	}
+	g, ok := st.GetGoal(strings.TrimSpace(patch.GoalID))
+	if !ok {
+		var err error
+		if g, err = createGoal(st, patch, policy, now); err != nil {
+			return nil, false, err
+		}
+	} else if g.IsClosed() {
+		return nil, false, fmt.Errorf("%w: goal id=%s is %s", contractx.ErrValidation, g.ID, g.Status)
+	}
+	if err := mergeGoalPatch(st, g, patch, schemas, policy, now); err != nil {
+		return nil, false, err
+	}
+	return g, !ok, nil
+}
+
+// deferGoal keeps g, which waits for a goal it depends on, from running: it is
+// suspended, and if it was the active goal (or nothing is active) a
+// prerequisite that can run now takes over. g starts once its prerequisites
+// are done. If they already are, or were dropped, an active g stays active.
+func deferGoal(st *statex.SessionState, g *statex.Goal, now time.Time) error {
+	if prereq := st.ReadyPrerequisite(g); prereq != nil {
+		if current := st.ActiveGoal(); current == nil || current.ID == g.ID {
+			if err := st.SwitchToGoal(prereq.ID, now); err != nil {
+				return invalidTransition(err)
+			}
 		}
-	} else if current == nil {
-		if err := st.SetActiveGoal(targetGoal.ID); err != nil {
-			return nil, err
+	}
+	if g.ID != st.ActiveGoalID && g.Status == statex.GoalActive {
+		return invalidTransition(st.SetGoalStatus(g.ID, statex.GoalSuspended, now))
+	}
+	return nil
+}
+
+// patchSlots normalizes patch against the slot schema of g's type, dropping
+// the values the schema rejects, or with slotx.NormalizeGeneric when the type
+// has no schema, and merges the slots whose value changed into g. Each changed
+// slot records its reported source, or fallback when the model gave none, and
+// the original text of a normalized value; a slot repeated with the same value
+// keeps the meta of when it was set. It returns the names of the changed
+// slots, sorted.
+func patchSlots(
+	st *statex.SessionState,
+	g *statex.Goal,
+	patch map[string]any,
+	sources map[string]contractx.SlotProvenance,
+	fallback statex.SlotSource,
+	schemas *slotx.Registry,
+	now time.Time,
+) ([]string, error) {
+	var raw map[string]string
+	if schema, ok := schemas.Lookup(g.Type); ok {
+		patch, raw = schema.Normalize(patch)
+		var err error
+		if patch, err = schema.DropInvalid(patch); err != nil {
+			log.Warn().Err(err).Str("goal_id", g.ID).Msg("dropped invalid slot values")
 		}
-	} else if shouldInterleave(current, targetGoal) {
-		if err := st.SuspendAndActivate(targetGoal.ID, now); err != nil {
-			return nil, err
+	} else {
+		patch, raw = slotx.NormalizeGeneric(patch)
+	}
+
+	var changed []string
+	updates := make(map[string]any, len(patch))
+	meta := make(map[string]statex.SlotMeta, len(patch))
+	for _, name := range slices.Sorted(maps.Keys(patch)) {
+		if old, ok := g.Slots[name]; ok && reflect.DeepEqual(old, patch[name]) {
+			continue
+		}
+		changed = append(changed, name)
+		updates[name] = patch[name]
+		m := statex.SlotMeta{Source: fallback, Raw: raw[name]}
+		if p, ok := sources[name]; ok {
+			if p.Source.Valid() {
+				m.Source = p.Source
+			}
+			if c := p.Confidence; c != nil && *c >= 0 && *c <= 1 {
+				m.Confidence = c
+			}
 		}
+		meta[name] = m
 	}
+	return changed, st.PatchSlotsWithMeta(g.ID, updates, meta, now)
+}
 
-	st.Touch(now)
-	return st.ActiveGoal(), nil
+// cancelGoals cancels the given goals in order and returns the last one it
+// cancelled. Ids the planner made up, and goals that are already closed, are
+// skipped.
+func cancelGoals(st *statex.SessionState, goalIDs []string, now time.Time) (*statex.Goal, error) {
+	var last *statex.Goal
+	for _, id := range goalIDs {
+		if g, ok := st.GetGoal(id); !ok || g.IsClosed() {
+			log.Warn().Str("session_id", st.SessionID).Str("goal_id", id).Msg("skipped cancelling an unknown or closed goal")
+			continue
+		}
+		if err := st.CancelGoal(id, now); err != nil {
+			return nil, invalidTransition(err)
+		}
+		last = st.Goals[id]
+	}
+	return last, nil
 }
 
 func findOrCreateGoal(
 	st *statex.SessionState,
 	patch contractx.GoalPatch,
+	policy InterleavePolicy,
 	now time.Time,
 ) (*statex.Goal, bool, error) {
 	if st == nil {
@@ -91,32 +453,57 @@ func findOrCreateGoal(
 
 	if goalID := strings.TrimSpace(patch.GoalID); goalID != "" {
 		if g, ok := st.GetGoal(goalID); ok {
+			if g.IsClosed() {
+				return nil, false, fmt.Errorf("%w: goal id=%s is %s", contractx.ErrValidation, goalID, g.Status)
+			}
 			return g, false, nil
 		}
 	}
 
-	if active := st.ActiveGoal(); active != nil && active.Type == patch.GoalType && !active.IsDone() {
+	if active := st.ActiveGoal(); active != nil && active.Type == patch.GoalType && !active.IsClosed() {
 		return active, false, nil
 	}
 
+	g, err := createGoal(st, patch, policy, now)
+	if err != nil {
+		return nil, false, err
+	}
+	return g, true, nil
+}
+
+// createGoal adds a new goal for patch, under patch.GoalID unless that id is
+// empty or already taken.
+func createGoal(st *statex.SessionState, patch contractx.GoalPatch, policy InterleavePolicy, now time.Time) (*statex.Goal, error) {
+	// Archived ids are not reused: the customer is starting over.
 	goalID := strings.TrimSpace(patch.GoalID)
-	if goalID == "" {
-		goalID = newGoalID(patch.GoalType, now)
+	if _, archived := st.ArchivedGoal(goalID); goalID == "" || archived {
+		goalID = newGoalID(st, patch.GoalType, now)
 	}
 	g := statex.CreateGoal(goalID, patch.GoalType, patch.Priority, now)
 	if g.Priority <= 0 {
-		g.Priority = defaultPriorityForGoalType(patch.GoalType)
+		g.Priority = policy.Priority(patch.GoalType)
 	}
 	if err := st.AddGoal(g); err != nil {
-		return nil, false, err
+		return nil, err
 	}
-	return g, true, nil
+	return g, nil
 }
 
-func newGoalID(goalType string, now time.Time) string {
+// newGoalID derives an unused goal id from the type and time; goals created in
+// the same turn get a numeric suffix.
+func newGoalID(st *statex.SessionState, goalType string, now time.Time) string {
 	safeType := strings.ReplaceAll(strings.TrimSpace(goalType), ".", "_")
 	if safeType == "" {
 		safeType = "goal"
 	}
-	return fmt.Sprintf("%s_%d", safeType, now.UnixNano())
+	base := fmt.Sprintf("%s_%d", safeType, now.UnixNano())
+	id := base
+	for n := 2; ; n++ {
+		_, live := st.GetGoal(id)
+		_, archived := st.ArchivedGoal(id)
+		if !live && !archived {
+			return id
+		}
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
 }
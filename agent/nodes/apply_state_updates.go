@@ -1,22 +1,41 @@
 package orchestratornode
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	slotx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/slot"
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
-func ApplyStateUpdates(in *GraphState) (*GraphState, error) {
+// ApplyStateUpdates merges the specialist's state updates into the active goal.
+// For goal types with a slot schema, Missing/NextQuestion come from the schema
+// and active/blocked follow from them. When finishing the goal resumes another
+// one, that goal is recorded as in.ResumedGoal. The goal on top of the stack
+// is resumed unless policy (PriorityPolicy if nil) resumes another suspended
+// goal instead; see ResumingPolicy.
+func ApplyStateUpdates(in *GraphState, schemas *slotx.Registry, policy InterleavePolicy) (*GraphState, error) {
 	if in == nil || in.Session == nil || in.ActiveGoal == nil {
 		return nil, fmt.Errorf("%w: graph state is incomplete", contractx.ErrValidation)
 	}
+	if policy == nil {
+		policy = PriorityPolicy{}
+	}
 
-	if err := applyStateUpdates(in.Session, in.ActiveGoal.ID, in.StateUpdates, in.Now); err != nil {
+	if err := applyStateUpdates(in.Session, in.ActiveGoal.ID, in.StateUpdates, schemas, in.Now); err != nil {
 		return nil, err
 	}
+	if active := in.Session.ActiveGoal(); active != nil && active.ID != in.ActiveGoal.ID {
+		// Nobody is asked here: a goal the policy would only offer stays
+		// suspended until a later plan.
+		if _, err := resumeSuspendedGoal(in.Session, policy, in.Now); err != nil {
+			return nil, err
+		}
+		in.ResumedGoal = in.Session.ActiveGoal()
+	}
 	return in, nil
 }
 
@@ -24,6 +43,7 @@ func applyStateUpdates(
 	st *statex.SessionState,
 	goalID string,
 	updates contractx.StateUpdates,
+	schemas *slotx.Registry,
 	now time.Time,
 ) error {
 	if st == nil {
@@ -33,31 +53,52 @@ func applyStateUpdates(
 		return fmt.Errorf("%w: goal id is empty", contractx.ErrValidation)
 	}
 
-	goal, ok := st.GetGoal(goalID)
+	g, ok := st.GetGoal(goalID)
 	if !ok {
 		return fmt.Errorf("%w: goal id=%s", statex.ErrGoalNotFound, goalID)
 	}
+	if g.IsCancelled() {
+		// The specialist only acknowledged the cancellation.
+		st.Touch(now)
+		return nil
+	}
 
-	for k, v := range updates.SlotsPatch {
-		goal.SetSlot(k, v)
+	changed, err := patchSlots(st, g, updates.SlotsPatch, updates.SlotSources, statex.SlotSourceSpecialist, schemas, now)
+	if err != nil {
+		return err
+	}
+	if err := applyConfirmations(st, g, changed, updates.Confirmations, schemas, now); err != nil {
+		return err
 	}
 
-	if len(updates.Missing) > 0 || strings.TrimSpace(updates.NextQuestion) != "" {
-		goal.SetMissing(updates.Missing, strings.TrimSpace(updates.NextQuestion))
+	schema, hasSchema := schemas.Lookup(g.Type)
+	switch {
+	case hasSchema:
+		missing, nextQuestion := schema.Missing(g.Slots)
+		if err := st.SetGoalMissing(goalID, missing, nextQuestion, now); err != nil {
+			return invalidTransition(err)
+		}
+	case len(updates.Missing) > 0 || strings.TrimSpace(updates.NextQuestion) != "":
+		if err := st.SetGoalMissing(goalID, updates.Missing, strings.TrimSpace(updates.NextQuestion), now); err != nil {
+			return invalidTransition(err)
+		}
 	}
 
 	setStatus := strings.TrimSpace(updates.SetStatus)
 	if setStatus != "" {
-		switch statex.GoalStatus(setStatus) {
-		case statex.GoalActive:
-			goal.Status = statex.GoalActive
-		case statex.GoalBlocked:
-			if len(goal.Missing) == 0 || strings.TrimSpace(goal.NextQuestion) == "" {
-				return fmt.Errorf("%w: blocked status requires missing+next_question", contractx.ErrValidation)
+		switch status := statex.GoalStatus(setStatus); status {
+		case statex.GoalActive, statex.GoalBlocked:
+			if hasSchema {
+				// Derived from the schema's missing slots above.
+				break
+			}
+			if err := st.SetGoalStatus(goalID, status, now); err != nil {
+				return invalidTransition(err)
 			}
-			goal.Status = statex.GoalBlocked
 		case statex.GoalSuspended:
-			goal.Status = statex.GoalSuspended
+			if err := st.SetGoalStatus(goalID, status, now); err != nil {
+				return invalidTransition(err)
+			}
 		case statex.GoalDone:
 			updates.MarkDone = true
 		default:
@@ -66,10 +107,18 @@ func applyStateUpdates(
 	}
 
 	if updates.MarkDone {
-		return st.MarkGoalDone(goalID, now)
+		return invalidTransition(st.MarkGoalDone(goalID, now))
 	}
 
-	goal.UpdatedAt = now.UTC()
 	st.Touch(now)
 	return nil
 }
+
+// invalidTransition reports a status change the goal machine refused as a
+// validation error of the specialist's state updates.
+func invalidTransition(err error) error {
+	if errors.Is(err, statex.ErrInvalidTransition) {
+		return fmt.Errorf("%w: %w", contractx.ErrValidation, err)
+	}
+	return err
+}
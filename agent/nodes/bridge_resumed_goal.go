@@ -0,0 +1,53 @@
+package orchestratornode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+)
+
+// BridgeResumedGoal has the resumed goal's specialist write a short bridge back
+// to it, e.g. "Your screen issue is fixed. Shall we continue with the laptop
+// under 35k?", so the customer knows the interrupted request was not lost. If
+// the specialist fails, the resumed goal's NextQuestion is used instead. It
+// does nothing when no goal was resumed this turn.
+func BridgeResumedGoal(
+	ctx context.Context,
+	in *GraphState,
+	models contractx.Registry,
+) (*GraphState, error) {
+	if in == nil || in.ResumedGoal == nil {
+		return in, nil
+	}
+	if in.Session == nil || in.ActiveGoal == nil {
+		return nil, fmt.Errorf("%w: graph state is incomplete", contractx.ErrValidation)
+	}
+
+	finished := in.ActiveGoal
+	if g, ok := in.Session.GetGoal(finished.ID); ok {
+		finished = g
+	}
+	req := contractx.SpecialistRequest{
+		UserMessage:         in.Text,
+		MemorySummary:       in.MemorySummary,
+		ConversationSummary: in.Session.ConversationSummary,
+		Transcript:          in.Session.Transcript,
+		ActiveGoal:          in.ResumedGoal,
+		FinishedGoal:        finished,
+	}
+
+	msg, _, err := dispatchToSpecialist(ctx, req, models)
+	if err != nil {
+		// The turn is answered already; the bridge is only a courtesy.
+		log.Warn().Err(err).
+			Str("session_id", in.SessionID).
+			Str("goal_id", in.ResumedGoal.ID).
+			Msg("bridge to resumed goal failed; using its next question")
+		msg = strings.TrimSpace(in.ResumedGoal.NextQuestion)
+	}
+	in.Bridge = msg
+	return in, nil
+}
@@ -0,0 +1,20 @@
+package orchestratornode
+
+import (
+	"fmt"
+
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+)
+
+// CheckDuplicate marks the turn as a replay when the session already processed
+// in.MessageID, and loads the reply it produced back then.
+func CheckDuplicate(in *GraphState) (*GraphState, error) {
+	if in == nil || in.Session == nil {
+		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
+	}
+	if reply, ok := in.Session.ProcessedReply(in.MessageID); ok {
+		in.Duplicate = true
+		in.Message = reply
+	}
+	return in, nil
+}
@@ -0,0 +1,79 @@
+package orchestratornode
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+)
+
+// TranscriptPolicy controls how much history stays verbatim in SessionState.
+type TranscriptPolicy struct {
+	// MaxEntries is a hard cap on stored entries (<= 0 means no cap).
+	MaxEntries int
+	// SummaryTriggerTokens starts summarization once the transcript estimate exceeds it.
+	SummaryTriggerTokens int
+	// SummaryKeepEntries is how many recent entries stay verbatim after summarizing.
+	SummaryKeepEntries int
+}
+
+// CompactTranscript folds older turns into the running conversation summary once
+// the transcript passes the policy thresholds. Without a summarizer it can only
+// enforce MaxEntries by dropping the oldest turns. When summarizing fails, a
+// transcript that is only over the token budget is kept as is and retried next
+// turn, but one over MaxEntries fails the turn rather than losing entries that
+// were never summarized.
+func CompactTranscript(
+	ctx context.Context,
+	in *GraphState,
+	summarizer contractx.Summarizer,
+	policy TranscriptPolicy,
+) (*GraphState, error) {
+	if in == nil || in.Session == nil {
+		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
+	}
+	st := in.Session
+
+	overCap := policy.MaxEntries > 0 && len(st.Transcript) > policy.MaxEntries
+	if summarizer == nil {
+		if overCap {
+			dropped := st.SplitTranscript(policy.MaxEntries)
+			log.Warn().Str("session_id", in.SessionID).Int("dropped", len(dropped)).Msg("no summarizer configured; dropped oldest transcript entries")
+		}
+		return in, nil
+	}
+
+	overBudget := policy.SummaryTriggerTokens > 0 && st.TranscriptTokens() > policy.SummaryTriggerTokens
+	if !overCap && !overBudget {
+		return in, nil
+	}
+
+	keep := policy.SummaryKeepEntries
+	if policy.MaxEntries > 0 && keep > policy.MaxEntries {
+		keep = policy.MaxEntries
+	}
+
+	recent := st.Transcript
+	older := st.SplitTranscript(keep)
+	if len(older) == 0 {
+		return in, nil
+	}
+
+	resp, err := summarizer.Summarize(ctx, contractx.SummarizeRequest{
+		PreviousSummary: st.ConversationSummary,
+		Entries:         older,
+	})
+	if err != nil {
+		st.Transcript = recent
+		if overCap {
+			return nil, fmt.Errorf("summarize transcript past %d entries: %w", policy.MaxEntries, err)
+		}
+		// Compaction is housekeeping: keep the turn and try summarizing again
+		// next turn.
+		log.Warn().Err(err).Str("session_id", in.SessionID).Msg("summarize transcript failed; skipping compaction")
+		return in, nil
+	}
+	st.ConversationSummary = resp.Summary
+	return in, nil
+}
@@ -0,0 +1,64 @@
+package orchestratornode
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	slotx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/slot"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+// applyConfirmations updates the confirm sub-state of g. Answers settle
+// pending slots: a confirmed value stays, a rejected one is cleared so the
+// schema asks for it again, unless the same update already corrected it.
+// Every changed slot whose spec requires confirmation becomes pending, unless
+// it was confirmed in the same update.
+func applyConfirmations(
+	st *statex.SessionState,
+	g *statex.Goal,
+	changed []string,
+	answers map[string]bool,
+	schemas *slotx.Registry,
+	now time.Time,
+) error {
+	schema, ok := schemas.Lookup(g.Type)
+	if !ok {
+		return nil
+	}
+
+	pending := slices.Clone(g.PendingConfirm)
+	var discard map[string]any
+	for _, name := range slices.Sorted(maps.Keys(answers)) {
+		if !slices.Contains(pending, name) {
+			continue
+		}
+		pending = slices.DeleteFunc(pending, func(p string) bool { return p == name })
+		if !answers[name] && !slices.Contains(changed, name) {
+			if discard == nil {
+				discard = make(map[string]any, len(answers))
+			}
+			discard[name] = nil
+		}
+	}
+	for _, name := range changed {
+		if slotx.IsEmpty(g.Slots[name]) {
+			pending = slices.DeleteFunc(pending, func(p string) bool { return p == name })
+			continue
+		}
+		spec, ok := schema.Spec(name)
+		if !ok || !spec.Confirm || answers[name] {
+			continue
+		}
+		if !slices.Contains(pending, name) {
+			pending = append(pending, name)
+		}
+	}
+
+	if len(discard) > 0 {
+		if err := st.PatchSlots(g.ID, discard, now); err != nil {
+			return err
+		}
+	}
+	return st.SetGoalPendingConfirm(g.ID, pending, now)
+}
@@ -18,7 +18,19 @@ func DispatchSpecialist(
 		return nil, ErrNoActiveGoal
 	}
 
-	msg, updates, err := dispatchToSpecialist(ctx, in.Text, in.MemorySummary, in.ActiveGoal, models)
+	req := contractx.SpecialistRequest{
+		UserMessage:   in.Text,
+		MemorySummary: in.MemorySummary,
+		ActiveGoal:    in.ActiveGoal,
+		OfferSwitch:   in.OfferSwitch,
+		QueuedGoals:   in.QueuedGoals,
+	}
+	if in.Session != nil {
+		req.Transcript = in.Session.Transcript
+		req.ConversationSummary = in.Session.ConversationSummary
+	}
+
+	msg, updates, err := dispatchToSpecialist(ctx, req, models)
 	if err != nil {
 		return nil, err
 	}
@@ -30,22 +42,14 @@ func DispatchSpecialist(
 
 func dispatchToSpecialist(
 	ctx context.Context,
-	userMessage string,
-	memorySummary string,
-	activeGoal *statex.Goal,
+	req contractx.SpecialistRequest,
 	models contractx.Registry,
 ) (string, contractx.StateUpdates, error) {
-	specialist, _, err := pickSpecialist(activeGoal, models)
+	specialist, _, err := pickSpecialist(req.ActiveGoal, models)
 	if err != nil {
 		return "", contractx.StateUpdates{}, err
 	}
 
-	req := contractx.SpecialistRequest{
-		UserMessage:   userMessage,
-		MemorySummary: memorySummary,
-		ActiveGoal:    activeGoal,
-	}
-
 	resp, err := specialist.Run(ctx, req)
 	if err != nil {
 		return "", contractx.StateUpdates{}, err
@@ -16,5 +16,14 @@ func FinalizeReply(in *GraphState) (GraphOutput, error) {
 	if reply == "" {
 		return GraphOutput{}, fmt.Errorf("%w: specialist returned empty message", contractx.ErrValidation)
 	}
-	return GraphOutput{Reply: reply}, nil
+	return GraphOutput{Reply: joinReply(reply, in.Bridge)}, nil
+}
+
+// joinReply appends the bridge to a resumed goal, if any, as its own paragraph.
+func joinReply(message, bridge string) string {
+	message, bridge = strings.TrimSpace(message), strings.TrimSpace(bridge)
+	if bridge == "" {
+		return message
+	}
+	return message + "\n\n" + bridge
 }
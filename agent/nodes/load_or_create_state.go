@@ -4,16 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"time"
+	"strings"
 
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
+// LoadOrCreateState loads the session for in.SessionID or creates a new one.
+// The request identity takes precedence over the given defaults for new sessions.
+// When no customer is known the session keeps an empty CustomerID, which a later
+// message may fill once, and memory is kept per session until then.
+// The session checks its goal status changes against machine, or the default
+// machine when it is nil.
 func LoadOrCreateState(
 	ctx context.Context,
 	in *GraphState,
 	store statex.Store,
+	machine *statex.GoalMachine,
 	workspaceID string,
 	customerID string,
 	channelType string,
@@ -22,30 +29,76 @@ func LoadOrCreateState(
 		return nil, fmt.Errorf("%w: graph state is nil", contractx.ErrValidation)
 	}
 
-	st, err := loadOrCreateState(ctx, store, in.SessionID, workspaceID, customerID, channelType, in.Now)
+	st, err := loadOrCreateState(ctx, store, in,
+		firstNonEmpty(in.WorkspaceID, workspaceID),
+		firstNonEmpty(in.CustomerID, customerID),
+		firstNonEmpty(in.ChannelType, channelType),
+	)
 	if err != nil {
 		return nil, err
 	}
+	st.UseGoalMachine(machine)
 	in.Session = st
+	in.Turn = st.BeginTurn()
 	return in, nil
 }
 
 func loadOrCreateState(
 	ctx context.Context,
 	store statex.Store,
-	sessionID string,
+	in *GraphState,
 	workspaceID string,
 	customerID string,
 	channelType string,
-	now time.Time,
 ) (*statex.SessionState, error) {
-	st, err := store.Load(ctx, sessionID)
+	st, err := store.Load(ctx, in.SessionID)
 	if err == nil {
+		if err := matchIdentity(st, in); err != nil {
+			return nil, err
+		}
 		return st, nil
 	}
 	if !errors.Is(err, statex.ErrStateNotFound) {
 		return nil, err
 	}
 
-	return statex.NewSessionState(sessionID, workspaceID, customerID, channelType, now), nil
+	return statex.NewSessionState(in.SessionID, workspaceID, customerID, channelType, in.Now), nil
+}
+
+// matchIdentity rejects a message whose explicit identity differs from the stored
+// session. Identity fields missing on the stored session, e.g. the customer of an
+// anonymous session, are adopted from the request once.
+func matchIdentity(st *statex.SessionState, in *GraphState) error {
+	fields := []struct {
+		name   string
+		stored *string
+		got    string
+	}{
+		{"workspace_id", &st.WorkspaceID, in.WorkspaceID},
+		{"customer_id", &st.CustomerID, in.CustomerID},
+		{"channel_type", &st.ChannelType, in.ChannelType},
+	}
+
+	for _, f := range fields {
+		if f.got == "" {
+			continue
+		}
+		if strings.TrimSpace(*f.stored) == "" {
+			*f.stored = f.got
+			continue
+		}
+		if *f.stored != f.got {
+			return fmt.Errorf("%w: %s=%q, session has %q", ErrIdentityMismatch, f.name, f.got, *f.stored)
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if trimmed := strings.TrimSpace(v); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
 }
@@ -5,12 +5,14 @@ import (
 	"fmt"
 
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	slotx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/slot"
 )
 
 func PlanGoal(
 	ctx context.Context,
 	in *GraphState,
 	planner contractx.Planner,
+	schemas *slotx.Registry,
 ) (*GraphState, error) {
 	if in == nil || in.Session == nil {
 		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
@@ -21,6 +23,7 @@ func PlanGoal(
 		MemorySummary: in.MemorySummary,
 		Session:       in.Session,
 		Now:           in.Now,
+		SlotSchemas:   schemas.Describe(),
 	})
 	if err != nil {
 		return nil, err
@@ -1,25 +1,43 @@
 package orchestratornode
 
 import (
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
-func shouldInterleave(current *statex.Goal, candidate *statex.Goal) bool {
-	if candidate == nil {
-		return false
-	}
-	if current == nil {
-		return true
-	}
-	if current.ID == candidate.ID {
-		return false
-	}
-	return candidate.Priority > current.Priority
+// InterleaveAction is what happens when the planner routes a message to a goal
+// other than the active one.
+type InterleaveAction int
+
+const (
+	// InterleaveStay keeps the current goal active.
+	InterleaveStay InterleaveAction = iota
+	// InterleaveSwitch suspends the current goal and activates the candidate.
+	InterleaveSwitch
+	// InterleaveAsk keeps the current goal active and has the specialist ask
+	// the customer whether to handle the candidate first.
+	InterleaveAsk
+)
+
+// InterleavePolicy decides when a goal may interrupt the active one. Explicit
+// switch_to requests from the planner bypass it.
+type InterleavePolicy interface {
+	// Priority is the priority of a new goal the planner gave none.
+	Priority(goalType string) int
+	// Decide is called with the active goal current and a different
+	// candidate, both non-nil.
+	Decide(st *statex.SessionState, current, candidate *statex.Goal, now time.Time) InterleaveAction
 }
 
-func defaultPriorityForGoalType(goalType string) int {
+// PriorityPolicy switches when the candidate's priority is strictly higher.
+// Support goals default to 100 and sales goals to 50.
+type PriorityPolicy struct{}
+
+func (PriorityPolicy) Priority(goalType string) int {
 	switch {
 	case strings.HasPrefix(goalType, "support."):
 		return 100
@@ -29,3 +47,189 @@ func defaultPriorityForGoalType(goalType string) int {
 		return 10
 	}
 }
+
+func (PriorityPolicy) Decide(st *statex.SessionState, current, candidate *statex.Goal, now time.Time) InterleaveAction {
+	if candidate.Priority > current.Priority {
+		return InterleaveSwitch
+	}
+	return InterleaveStay
+}
+
+// ResumingPolicy is implemented by policies that bring a suspended goal back
+// on their own, without the planner routing a message to it. ApplyPlan asks it
+// after every plan that leaves the active goal in place, and ApplyStateUpdates
+// when finishing a goal resumed another; the goal it returns then goes through
+// Decide like any other candidate.
+type ResumingPolicy interface {
+	// Resume returns the suspended goal on the stack that should take over
+	// from current, which is non-nil, or nil to keep current.
+	Resume(st *statex.SessionState, current *statex.Goal, now time.Time) *statex.Goal
+}
+
+// resumeCandidate is policy's Resume, or nil when it never resumes goals.
+func resumeCandidate(policy InterleavePolicy, st *statex.SessionState, current *statex.Goal, now time.Time) *statex.Goal {
+	if r, ok := policy.(ResumingPolicy); ok {
+		return r.Resume(st, current, now)
+	}
+	return nil
+}
+
+// NoInterruptPolicy never interrupts goals of the given types, e.g. an order
+// the customer is in the middle of, and defers to Base otherwise.
+type NoInterruptPolicy struct {
+	Base  InterleavePolicy
+	Types []string
+}
+
+func (p NoInterruptPolicy) Priority(goalType string) int { return p.Base.Priority(goalType) }
+
+func (p NoInterruptPolicy) Decide(st *statex.SessionState, current, candidate *statex.Goal, now time.Time) InterleaveAction {
+	if !current.IsClosed() && slices.Contains(p.Types, current.Type) {
+		return InterleaveStay
+	}
+	return p.Base.Decide(st, current, candidate, now)
+}
+
+func (p NoInterruptPolicy) Resume(st *statex.SessionState, current *statex.Goal, now time.Time) *statex.Goal {
+	return resumeCandidate(p.Base, st, current, now)
+}
+
+// AskFirstPolicy asks the customer instead of switching whenever Base would
+// interrupt an active goal.
+type AskFirstPolicy struct {
+	Base InterleavePolicy
+}
+
+func (p AskFirstPolicy) Priority(goalType string) int { return p.Base.Priority(goalType) }
+
+func (p AskFirstPolicy) Decide(st *statex.SessionState, current, candidate *statex.Goal, now time.Time) InterleaveAction {
+	action := p.Base.Decide(st, current, candidate, now)
+	if action == InterleaveSwitch && !current.IsClosed() {
+		return InterleaveAsk
+	}
+	return action
+}
+
+func (p AskFirstPolicy) Resume(st *statex.SessionState, current *statex.Goal, now time.Time) *statex.Goal {
+	return resumeCandidate(p.Base, st, current, now)
+}
+
+// AgingPolicy is PriorityPolicy with suspended goals gaining Step priority for
+// every Interval since they were suspended, so a goal interrupted long ago
+// eventually wins against the goal that interrupted it. It also resumes such a
+// goal from the stack once it outranks the active goal, even if no message
+// mentions it again.
+type AgingPolicy struct {
+	Step     int
+	Interval time.Duration
+}
+
+func (AgingPolicy) Priority(goalType string) int { return PriorityPolicy{}.Priority(goalType) }
+
+func (p AgingPolicy) Decide(st *statex.SessionState, current, candidate *statex.Goal, now time.Time) InterleaveAction {
+	if p.effectivePriority(candidate, now) > p.effectivePriority(current, now) {
+		return InterleaveSwitch
+	}
+	return InterleaveStay
+}
+
+// Resume returns the suspended goal on the stack with the highest aged
+// priority if it outranks current; of equal goals the one nearer the top wins.
+// Goals waiting for a dependency are skipped.
+func (p AgingPolicy) Resume(st *statex.SessionState, current *statex.Goal, now time.Time) *statex.Goal {
+	var best *statex.Goal
+	for _, id := range slices.Backward(st.GoalStack) {
+		g, ok := st.GetGoal(id)
+		if !ok || g.ID == current.ID || g.Status != statex.GoalSuspended || st.IsWaiting(g) {
+			continue
+		}
+		if best == nil || p.effectivePriority(g, now) > p.effectivePriority(best, now) {
+			best = g
+		}
+	}
+	if best == nil || p.effectivePriority(best, now) <= p.effectivePriority(current, now) {
+		return nil
+	}
+	return best
+}
+
+func (p AgingPolicy) effectivePriority(g *statex.Goal, now time.Time) int {
+	if g.Status != statex.GoalSuspended || g.SuspendedAt.IsZero() || p.Step <= 0 || p.Interval <= 0 {
+		return g.Priority
+	}
+	return g.Priority + p.Step*int(now.Sub(g.SuspendedAt)/p.Interval)
+}
+
+// MaxDepthPolicy stops interrupting once MaxDepth goals are on the stack and
+// defers to Base otherwise. Switching to a goal already on the stack does not
+// make it deeper and is left to Base.
+type MaxDepthPolicy struct {
+	Base     InterleavePolicy
+	MaxDepth int
+}
+
+func (p MaxDepthPolicy) Priority(goalType string) int { return p.Base.Priority(goalType) }
+
+func (p MaxDepthPolicy) Decide(st *statex.SessionState, current, candidate *statex.Goal, now time.Time) InterleaveAction {
+	if p.MaxDepth > 0 && len(st.GoalStack) >= p.MaxDepth && !slices.Contains(st.GoalStack, candidate.ID) {
+		return InterleaveStay
+	}
+	return p.Base.Decide(st, current, candidate, now)
+}
+
+func (p MaxDepthPolicy) Resume(st *statex.SessionState, current *statex.Goal, now time.Time) *statex.Goal {
+	return resumeCandidate(p.Base, st, current, now)
+}
+
+// Defaults for the strategies built by ParseInterleavePolicy.
+const (
+	DefaultAgingStep     = 10
+	DefaultAgingInterval = 10 * time.Minute
+	DefaultMaxStackDepth = 3
+)
+
+// ParseInterleavePolicy builds a policy from a strategy spec: a base strategy,
+// "priority" or "aging", optionally followed by "+"-separated modifiers,
+// "no_interrupt=<type>|<type>", "ask" or "max_depth", e.g.
+// "priority+no_interrupt=sales.recommend_item+ask". no_interrupt lists the goal
+// types that are never interrupted. Modifiers may also stand alone on top of
+// "priority". An empty spec is "priority".
+func ParseInterleavePolicy(spec string) (InterleavePolicy, error) {
+	var policy InterleavePolicy = PriorityPolicy{}
+	for i, part := range strings.Split(spec, "+") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if hasArg && name != "no_interrupt" {
+			return nil, fmt.Errorf("interleave policy %q: %q takes no argument", spec, name)
+		}
+		switch name {
+		case "", "priority":
+			if i > 0 && name != "" {
+				return nil, fmt.Errorf("interleave policy %q: %q must come first", spec, name)
+			}
+		case "aging":
+			if i > 0 {
+				return nil, fmt.Errorf("interleave policy %q: %q must come first", spec, name)
+			}
+			policy = AgingPolicy{Step: DefaultAgingStep, Interval: DefaultAgingInterval}
+		case "no_interrupt":
+			var types []string
+			for _, t := range strings.Split(arg, "|") {
+				if t = strings.TrimSpace(t); t != "" {
+					types = append(types, t)
+				}
+			}
+			if len(types) == 0 {
+				return nil, fmt.Errorf("interleave policy %q: %q needs goal types, e.g. no_interrupt=sales.recommend_item", spec, name)
+			}
+			policy = NoInterruptPolicy{Base: policy, Types: types}
+		case "ask":
+			policy = AskFirstPolicy{Base: policy}
+		case "max_depth":
+			policy = MaxDepthPolicy{Base: policy, MaxDepth: DefaultMaxStackDepth}
+		default:
+			return nil, fmt.Errorf("interleave policy %q: unknown strategy %q", spec, name)
+		}
+	}
+	return policy, nil
+}
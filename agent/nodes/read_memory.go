@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 )
 
 func ReadMemory(
@@ -16,10 +17,16 @@ func ReadMemory(
 		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
 	}
 
-	summary, err := memory.ReadSummary(ctx, in.Session.CustomerID)
+	summary, err := memory.ReadSummary(ctx, memoryKey(in.Session))
 	if err != nil {
 		return nil, err
 	}
 	in.MemorySummary = summary
 	return in, nil
 }
+
+// memoryKey is the id customer memory is kept under: the session's customer,
+// or the session itself while the customer is unknown.
+func memoryKey(st *statex.SessionState) string {
+	return firstNonEmpty(st.CustomerID, st.SessionID)
+}
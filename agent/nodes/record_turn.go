@@ -0,0 +1,58 @@
+package orchestratornode
+
+import (
+	"fmt"
+
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+// RecordTurn appends the user message and the specialist reply to the session
+// transcript, attributed to the goal that handled the turn, and remembers the
+// reply under in.MessageID (keeping at most maxProcessed ids). A bridge to a
+// resumed goal is recorded as a separate reply attributed to that goal.
+func RecordTurn(in *GraphState, maxProcessed int) (*GraphState, error) {
+	if in == nil || in.Session == nil {
+		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
+	}
+
+	goalID := ""
+	if in.ActiveGoal != nil {
+		goalID = in.ActiveGoal.ID
+	}
+
+	in.Session.AppendTranscript(
+		statex.TranscriptEntry{
+			Turn:   in.Turn,
+			Role:   statex.TranscriptRoleUser,
+			Text:   in.Text,
+			GoalID: goalID,
+			At:     in.Now,
+		},
+		statex.TranscriptEntry{
+			Turn:   in.Turn,
+			Role:   statex.TranscriptRoleAssistant,
+			Text:   in.Message,
+			GoalID: goalID,
+			At:     in.Now,
+		},
+	)
+	if in.ResumedGoal != nil {
+		in.Session.AppendTranscript(statex.TranscriptEntry{
+			Turn:   in.Turn,
+			Role:   statex.TranscriptRoleAssistant,
+			Text:   in.Bridge,
+			GoalID: in.ResumedGoal.ID,
+			At:     in.Now,
+		})
+	}
+	if in.MessageID != "" {
+		in.Session.RememberMessage(maxProcessed, statex.ProcessedMessage{
+			ID:    in.MessageID,
+			Reply: joinReply(in.Message, in.Bridge),
+			Turn:  in.Turn,
+			At:    in.Now,
+		})
+	}
+	return in, nil
+}
@@ -0,0 +1,121 @@
+package orchestratornode
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+// GoalRetentionPolicy controls how long goals stay in SessionState. A zero
+// value disables the matching rule.
+type GoalRetentionPolicy struct {
+	// SuspendAfter suspends the active goal once it has been idle this long.
+	SuspendAfter GoalTimeouts
+	// ExpireAfter cancels and archives open goals idle this long.
+	ExpireAfter GoalTimeouts
+	// MaxLiveGoals caps the open goals of a session; the least recently
+	// updated ones beyond it expire. The active goal never expires for the cap.
+	MaxLiveGoals int
+	// MaxHistory caps GoalHistory, dropping the oldest records.
+	MaxHistory int
+}
+
+// GoalTimeouts is an idle timeout per goal type. Types without an entry in
+// ByType use Default; a timeout <= 0 never fires.
+type GoalTimeouts struct {
+	Default time.Duration
+	ByType  map[string]time.Duration
+}
+
+// For returns the timeout for goalType.
+func (t GoalTimeouts) For(goalType string) time.Duration {
+	if d, ok := t.ByType[goalType]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// RetainGoals applies the retention policy before the planner runs. In order,
+// it expires idle goals, suspends an idle active goal, expires goals over
+// MaxLiveGoals, archives done and cancelled goals into GoalHistory and trims
+// the history. Idle time is measured from the goals' UpdatedAt as loaded to
+// in.Now, and goals are visited oldest first, so the outcome depends only on
+// the stored state and the turn time.
+func RetainGoals(in *GraphState, policy GoalRetentionPolicy) (*GraphState, error) {
+	if in == nil || in.Session == nil {
+		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
+	}
+	st, now := in.Session, in.Now
+
+	// Resuming a goal stamps its UpdatedAt, so idle times are taken up front.
+	idle := make(map[string]time.Duration, len(st.Goals))
+	for id, g := range st.Goals {
+		idle[id] = now.Sub(g.UpdatedAt)
+	}
+	timedOut := func(g *statex.Goal, t GoalTimeouts) bool {
+		d := t.For(g.Type)
+		return d > 0 && idle[g.ID] >= d
+	}
+
+	for _, g := range goalsByAge(st, idle, func(g *statex.Goal) bool { return !g.IsClosed() }) {
+		if timedOut(g, policy.ExpireAfter) {
+			if err := st.ExpireGoal(g.ID, now); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if active := st.ActiveGoal(); active != nil && !active.IsClosed() && timedOut(active, policy.SuspendAfter) {
+		if err := st.SuspendActiveGoal(now); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy.MaxLiveGoals > 0 {
+		open := goalsByAge(st, idle, func(g *statex.Goal) bool { return !g.IsClosed() })
+		over := len(open) - policy.MaxLiveGoals
+		for _, g := range open {
+			if over <= 0 {
+				break
+			}
+			if g.ID == st.ActiveGoalID {
+				continue
+			}
+			if err := st.ExpireGoal(g.ID, now); err != nil {
+				return nil, err
+			}
+			over--
+		}
+	}
+
+	for _, g := range goalsByAge(st, idle, (*statex.Goal).IsClosed) {
+		if err := st.ArchiveGoal(g.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy.MaxHistory > 0 {
+		if err := st.TrimGoalHistory(policy.MaxHistory, now); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// goalsByAge returns the goals matching keep, longest idle first.
+func goalsByAge(st *statex.SessionState, idle map[string]time.Duration, keep func(*statex.Goal) bool) []*statex.Goal {
+	var out []*statex.Goal
+	for _, g := range st.Goals {
+		if g != nil && keep(g) {
+			out = append(out, g)
+		}
+	}
+	slices.SortFunc(out, func(a, b *statex.Goal) int {
+		return cmp.Or(cmp.Compare(idle[b.ID], idle[a.ID]), cmp.Compare(a.ID, b.ID))
+	})
+	return out
+}
@@ -10,14 +10,23 @@ import (
 )
 
 var (
-	ErrInvalidMessage = errors.New("message is empty")
-	ErrInvalidSession = errors.New("session id is empty")
-	ErrNoActiveGoal   = errors.New("active goal is missing")
+	ErrInvalidMessage   = errors.New("message is empty")
+	ErrInvalidSession   = errors.New("session id is empty")
+	ErrNoActiveGoal     = errors.New("active goal is missing")
+	ErrIdentityMismatch = errors.New("message identity does not match session")
 )
 
+// GraphInput is one inbound message. Identity fields are optional; empty values
+// fall back to the orchestrator defaults when a session is created.
 type GraphInput struct {
 	SessionID string
 	Text      string
+	// MessageID is the client's message id; a repeated id is answered from cache.
+	MessageID string
+
+	WorkspaceID string
+	CustomerID  string
+	ChannelType string
 }
 
 type GraphOutput struct {
@@ -27,15 +36,33 @@ type GraphOutput struct {
 type GraphState struct {
 	SessionID string
 	Text      string
+	MessageID string
 	Now       time.Time
 
+	WorkspaceID string
+	CustomerID  string
+	ChannelType string
+
 	Session       *statex.SessionState
+	Turn          int
+	Duplicate     bool
 	MemorySummary string
 	PlanResp      contractx.PlannerResponse
 	ActiveGoal    *statex.Goal
+	// OfferSwitch is a goal the interleave policy asks the customer about
+	// before switching to it.
+	OfferSwitch *statex.Goal
+	// QueuedGoals are the message's other goals, queued beneath ActiveGoal.
+	QueuedGoals []*statex.Goal
+	// ResumedGoal is the goal that became active because ActiveGoal closed
+	// this turn, e.g. the sales goal a finished support goal interrupted.
+	ResumedGoal *statex.Goal
 
 	Message      string
 	StateUpdates contractx.StateUpdates
+	// Bridge is the short message leading the customer back to ResumedGoal,
+	// sent after Message.
+	Bridge string
 }
 
 func ValidateRequest(in GraphInput, nowFn func() time.Time) (*GraphState, error) {
@@ -50,8 +77,12 @@ func ValidateRequest(in GraphInput, nowFn func() time.Time) (*GraphState, error)
 	}
 
 	return &GraphState{
-		SessionID: sessionID,
-		Text:      text,
-		Now:       nowFn().UTC(),
+		SessionID:   sessionID,
+		Text:        text,
+		MessageID:   strings.TrimSpace(in.MessageID),
+		Now:         nowFn().UTC(),
+		WorkspaceID: strings.TrimSpace(in.WorkspaceID),
+		CustomerID:  strings.TrimSpace(in.CustomerID),
+		ChannelType: strings.TrimSpace(in.ChannelType),
 	}, nil
 }
@@ -16,7 +16,7 @@ func WriteMemory(
 		return nil, fmt.Errorf("%w: graph session is nil", contractx.ErrValidation)
 	}
 
-	if err := memory.WriteSummary(ctx, in.Session.CustomerID, in.StateUpdates.MemoryUpdate); err != nil {
+	if err := memory.WriteSummary(ctx, memoryKey(in.Session), in.StateUpdates.MemoryUpdate); err != nil {
 		return nil, err
 	}
 	return in, nil
@@ -14,21 +14,26 @@ var (
 
 	//go:embed template/support.txt
 	supportRaw string
+
+	//go:embed template/summarizer.txt
+	summarizerRaw string
 )
 
 // PromptSet holds loaded prompt content.
 type PromptSet struct {
-	Planner string
-	Sales   string
-	Support string
+	Planner    string
+	Sales      string
+	Support    string
+	Summarizer string
 }
 
 // LoadPromptSet returns a PromptSet with trimmed prompt strings.
 // This is safe to call concurrently; the embed is compile-time, and trimming is cheap.
 func LoadPromptSet() PromptSet {
 	return PromptSet{
-		Planner: strings.TrimSpace(plannerRaw),
-		Sales:   strings.TrimSpace(salesRaw),
-		Support: strings.TrimSpace(supportRaw),
+		Planner:    strings.TrimSpace(plannerRaw),
+		Sales:      strings.TrimSpace(salesRaw),
+		Support:    strings.TrimSpace(supportRaw),
+		Summarizer: strings.TrimSpace(summarizerRaw),
 	}
 }
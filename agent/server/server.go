@@ -0,0 +1,347 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	orchestratorx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/agents/orchestrator"
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	nodex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/nodes"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+const maxRequestBodyBytes = 1 << 20
+
+const (
+	defaultEventsPageSize = 200
+	maxEventsPageSize     = 1000
+)
+
+type Config struct {
+	Addr            string        `envconfig:"ADDR" split_words:"true" default:":8080"`
+	ReadTimeout     time.Duration `envconfig:"READ_TIMEOUT" split_words:"true" default:"10s"`
+	WriteTimeout    time.Duration `envconfig:"WRITE_TIMEOUT" split_words:"true" default:"90s"`
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" split_words:"true" default:"15s"`
+}
+
+// MessageHandler is the ingress contract implemented by orchestrator.Orchestrator.
+type MessageHandler interface {
+	HandleMessage(ctx context.Context, msg orchestratorx.Message) (string, error)
+}
+
+// SessionRewinder is implemented by handlers that can undo turns, such as
+// orchestrator.Orchestrator.
+type SessionRewinder interface {
+	Rewind(ctx context.Context, sessionID string, beforeTurn int) (*statex.SessionState, error)
+}
+
+// Server exposes the orchestrator and session store as a JSON API.
+type Server struct {
+	handler MessageHandler
+	store   statex.Store
+	mux     *http.ServeMux
+}
+
+type messageRequest struct {
+	Text        string `json:"text"`
+	MessageID   string `json:"message_id,omitempty"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	CustomerID  string `json:"customer_id,omitempty"`
+	ChannelType string `json:"channel_type,omitempty"`
+}
+
+type messageResponse struct {
+	SessionID string `json:"session_id"`
+	Reply     string `json:"reply"`
+}
+
+type rewindRequest struct {
+	BeforeTurn int `json:"before_turn"`
+}
+
+type eventsResponse struct {
+	SessionID string             `json:"session_id"`
+	Events    []statex.GoalEvent `json:"events"`
+	// NextAfter is the after value of the next page; it is omitted on the last
+	// page.
+	NextAfter int64 `json:"next_after,omitempty"`
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(handler MessageHandler, store statex.Store) (*Server, error) {
+	if handler == nil {
+		return nil, errors.New("message handler is required")
+	}
+	if store == nil {
+		return nil, errors.New("state store is required")
+	}
+
+	s := &Server{
+		handler: handler,
+		store:   store,
+		mux:     http.NewServeMux(),
+	}
+	s.routes()
+	return s, nil
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("POST /v1/sessions/{session_id}/messages", s.handlePostMessage)
+	s.mux.HandleFunc("GET /v1/sessions/{session_id}", s.handleGetSession)
+	s.mux.HandleFunc("DELETE /v1/sessions/{session_id}", s.handleDeleteSession)
+	s.mux.HandleFunc("GET /v1/sessions/{session_id}/events", s.handleGetEvents)
+	s.mux.HandleFunc("POST /v1/sessions/{session_id}/rewind", s.handleRewind)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe runs the API until ctx is cancelled, then shuts down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context, cfg Config) error {
+	httpServer := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      s,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown http server: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("session_id")
+
+	var req messageRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	reply, err := s.handler.HandleMessage(r.Context(), orchestratorx.Message{
+		SessionID:   sessionID,
+		Text:        req.Text,
+		MessageID:   req.MessageID,
+		WorkspaceID: req.WorkspaceID,
+		CustomerID:  req.CustomerID,
+		ChannelType: req.ChannelType,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messageResponse{
+		SessionID: strings.TrimSpace(sessionID),
+		Reply:     reply,
+	})
+}
+
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	st, err := s.store.Load(r.Context(), r.PathValue("session_id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Delete(r.Context(), r.PathValue("session_id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetEvents returns a page of the session's goal event log. ?after=N
+// returns only events with seq > N, and ?limit=M at most M of them (default
+// defaultEventsPageSize, at most maxEventsPageSize).
+func (s *Server) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	eventLog, ok := s.store.(statex.GoalEventLog)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "events_unsupported", "state store does not keep a goal event log")
+		return
+	}
+
+	var after int64
+	if raw := r.URL.Query().Get("after"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_query", "after must be a non-negative integer")
+			return
+		}
+		after = n
+	}
+	limit := defaultEventsPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxEventsPageSize {
+			writeError(w, http.StatusBadRequest, "invalid_query", fmt.Sprintf("limit must be between 1 and %d", maxEventsPageSize))
+			return
+		}
+		limit = n
+	}
+
+	sessionID := r.PathValue("session_id")
+	events, err := eventLog.GoalEvents(r.Context(), sessionID, after, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resp := eventsResponse{
+		SessionID: strings.TrimSpace(sessionID),
+		Events:    events,
+	}
+	if resp.Events == nil {
+		resp.Events = []statex.GoalEvent{}
+	}
+	if len(events) == limit {
+		resp.NextAfter = events[len(events)-1].Seq
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRewind restores the session's goals to how they were before turn
+// before_turn and returns the rewound state.
+func (s *Server) handleRewind(w http.ResponseWriter, r *http.Request) {
+	rewinder, ok := s.handler.(SessionRewinder)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "rewind_unsupported", "handler does not support rewinding sessions")
+		return
+	}
+
+	var req rewindRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	st, err := rewinder.Rewind(r.Context(), r.PathValue("session_id"), req.BeforeTurn)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func decodeJSON(r *http.Request, dst any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("request body is empty")
+		}
+		return fmt.Errorf("decode request body: %w", err)
+	}
+	return nil
+}
+
+// errorStatus maps service errors to an HTTP status and a stable error code.
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, nodex.ErrInvalidSession), errors.Is(err, statex.ErrInvalidSession):
+		return http.StatusBadRequest, "invalid_session"
+	case errors.Is(err, nodex.ErrInvalidMessage):
+		return http.StatusBadRequest, "invalid_message"
+	case errors.Is(err, nodex.ErrIdentityMismatch):
+		return http.StatusForbidden, "identity_mismatch"
+	case errors.Is(err, statex.ErrStateNotFound):
+		return http.StatusNotFound, "session_not_found"
+	case errors.Is(err, statex.ErrInvalidRewind):
+		return http.StatusBadRequest, "invalid_rewind"
+	case errors.Is(err, statex.ErrSnapshotNotFound):
+		return http.StatusNotFound, "snapshot_not_found"
+	case errors.Is(err, orchestratorx.ErrRewindUnsupported):
+		return http.StatusNotImplemented, "rewind_unsupported"
+	case errors.Is(err, statex.ErrVersionConflict):
+		return http.StatusConflict, "version_conflict"
+	case errors.Is(err, statex.ErrSessionBusy):
+		return http.StatusTooManyRequests, "session_busy"
+	case errors.Is(err, statex.ErrLeaseLost):
+		return http.StatusConflict, "session_lock_lost"
+	case errors.Is(err, contractx.ErrValidation):
+		return http.StatusUnprocessableEntity, "validation_failed"
+	case errors.Is(err, contractx.ErrModelInvoke):
+		return http.StatusBadGateway, "model_invoke_failed"
+	case errors.Is(err, contractx.ErrSchemaViolation):
+		return http.StatusBadGateway, "model_schema_violation"
+	case errors.Is(err, contractx.ErrPromptMissing):
+		return http.StatusInternalServerError, "prompt_missing"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "timeout"
+	case errors.Is(err, context.Canceled):
+		return 499, "request_cancelled"
+	default:
+		return http.StatusInternalServerError, "internal_error"
+	}
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		log.Error().Err(err).Str("code", code).Msg("request failed")
+		if status == http.StatusInternalServerError {
+			message = "internal server error"
+		}
+	}
+	writeError(w, status, code, message)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, errorBody{
+		Error: errorDetail{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error().Err(err).Msg("encode response body")
+	}
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	orchestratorx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/agents/orchestrator"
+	contractx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/contract"
+	nodex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/nodes"
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+type fakeHandler struct {
+	reply   string
+	err     error
+	lastMsg orchestratorx.Message
+}
+
+func (f *fakeHandler) HandleMessage(ctx context.Context, msg orchestratorx.Message) (string, error) {
+	f.lastMsg = msg
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.reply, nil
+}
+
+type fakeStore struct {
+	states  map[string]*statex.SessionState
+	deleted []string
+}
+
+func (f *fakeStore) Load(ctx context.Context, sessionID string) (*statex.SessionState, error) {
+	st, ok := f.states[sessionID]
+	if !ok {
+		return nil, statex.ErrStateNotFound
+	}
+	return st, nil
+}
+
+func (f *fakeStore) Save(ctx context.Context, st *statex.SessionState) error {
+	return nil
+}
+
+func (f *fakeStore) Delete(ctx context.Context, sessionID string) error {
+	f.deleted = append(f.deleted, sessionID)
+	return nil
+}
+
+func TestPostMessageReturnsReply(t *testing.T) {
+	t.Parallel()
+
+	handler := &fakeHandler{reply: "ลองรุ่น A ก่อนครับ"}
+	srv := newTestServer(t, handler, &fakeStore{})
+
+	rec := doRequest(t, srv, http.MethodPost, "/v1/sessions/session-1/messages", `{"text":"แนะนำเมาส์หน่อย","message_id":"m-1","customer_id":"cust-1","channel_type":"line"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var got messageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.SessionID != "session-1" || got.Reply != "ลองรุ่น A ก่อนครับ" {
+		t.Fatalf("unexpected response: %+v", got)
+	}
+	want := orchestratorx.Message{
+		SessionID:   "session-1",
+		Text:        "แนะนำเมาส์หน่อย",
+		MessageID:   "m-1",
+		CustomerID:  "cust-1",
+		ChannelType: "line",
+	}
+	if handler.lastMsg != want {
+		t.Fatalf("unexpected handler input: %+v", handler.lastMsg)
+	}
+}
+
+func TestPostMessageRejectsInvalidBody(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, &fakeHandler{}, &fakeStore{})
+
+	rec := doRequest(t, srv, http.MethodPost, "/v1/sessions/session-1/messages", `{bad json`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if code := decodeErrorCode(t, rec); code != "invalid_body" {
+		t.Fatalf("error code = %q, want invalid_body", code)
+	}
+}
+
+func TestPostMessageMapsServiceErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid session", nodex.ErrInvalidSession, http.StatusBadRequest, "invalid_session"},
+		{"invalid message", nodex.ErrInvalidMessage, http.StatusBadRequest, "invalid_message"},
+		{"identity mismatch", fmt.Errorf("%w: customer_id", nodex.ErrIdentityMismatch), http.StatusForbidden, "identity_mismatch"},
+		{"version conflict", fmt.Errorf("%w: session=s1", statex.ErrVersionConflict), http.StatusConflict, "version_conflict"},
+		{"session busy", fmt.Errorf("%w: session=s1", statex.ErrSessionBusy), http.StatusTooManyRequests, "session_busy"},
+		{"validation", fmt.Errorf("%w: unsupported goal type", contractx.ErrValidation), http.StatusUnprocessableEntity, "validation_failed"},
+		{"model invoke", fmt.Errorf("%w: planner invoke", contractx.ErrModelInvoke), http.StatusBadGateway, "model_invoke_failed"},
+		{"schema violation", fmt.Errorf("%w: bad json", contractx.ErrSchemaViolation), http.StatusBadGateway, "model_schema_violation"},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newTestServer(t, &fakeHandler{err: tc.err}, &fakeStore{})
+			rec := doRequest(t, srv, http.MethodPost, "/v1/sessions/s1/messages", `{"text":"hi"}`)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if code := decodeErrorCode(t, rec); code != tc.wantCode {
+				t.Fatalf("error code = %q, want %q", code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	t.Parallel()
+
+	st := statex.NewSessionState("session-2", "ws", "cust", "chat", time.Now())
+	srv := newTestServer(t, &fakeHandler{}, &fakeStore{
+		states: map[string]*statex.SessionState{"session-2": st},
+	})
+
+	rec := doRequest(t, srv, http.MethodGet, "/v1/sessions/session-2", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var got statex.SessionState
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.SessionID != "session-2" || got.CustomerID != "cust" {
+		t.Fatalf("unexpected session: %+v", got)
+	}
+
+	rec = doRequest(t, srv, http.MethodGet, "/v1/sessions/unknown", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if code := decodeErrorCode(t, rec); code != "session_not_found" {
+		t.Fatalf("error code = %q, want session_not_found", code)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{}
+	srv := newTestServer(t, &fakeHandler{}, store)
+
+	rec := doRequest(t, srv, http.MethodDelete, "/v1/sessions/session-3", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "session-3" {
+		t.Fatalf("unexpected deletes: %#v", store.deleted)
+	}
+}
+
+type fakeEventStore struct {
+	fakeStore
+	events    []statex.GoalEvent
+	lastAfter int64
+	lastLimit int
+}
+
+func (f *fakeEventStore) GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]statex.GoalEvent, error) {
+	f.lastAfter, f.lastLimit = afterSeq, limit
+	if _, ok := f.states[sessionID]; !ok {
+		return nil, statex.ErrStateNotFound
+	}
+	return f.events[:min(limit, len(f.events))], nil
+}
+
+func TestGetEvents(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	store := &fakeEventStore{
+		fakeStore: fakeStore{states: map[string]*statex.SessionState{
+			"session-1": statex.NewSessionState("session-1", "ws", "cust", "web", now),
+		}},
+		events: []statex.GoalEvent{
+			{Seq: 3, Turn: 2, At: now, Type: statex.EventGoalPushed, GoalID: "g1"},
+			{Seq: 4, Turn: 2, At: now, Type: statex.EventGoalResumed, GoalID: "g1"},
+		},
+	}
+	srv := newTestServer(t, &fakeHandler{}, store)
+
+	rec := doRequest(t, srv, http.MethodGet, "/v1/sessions/session-1/events?after=2", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var got eventsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if store.lastAfter != 2 || store.lastLimit != defaultEventsPageSize || len(got.Events) != 2 || got.Events[0].Type != statex.EventGoalPushed || got.NextAfter != 0 {
+		t.Fatalf("unexpected events response (after=%d limit=%d): %+v", store.lastAfter, store.lastLimit, got)
+	}
+
+	rec = doRequest(t, srv, http.MethodGet, "/v1/sessions/session-1/events?after=2&limit=1", "")
+	got = eventsResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if store.lastLimit != 1 || len(got.Events) != 1 || got.NextAfter != 3 {
+		t.Fatalf("expected a first page ending at seq 3, got %+v", got)
+	}
+
+	for _, query := range []string{"after=x", "limit=0", "limit=5000"} {
+		if rec := doRequest(t, srv, http.MethodGet, "/v1/sessions/session-1/events?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d", query, rec.Code)
+		}
+	}
+	if rec := doRequest(t, srv, http.MethodGet, "/v1/sessions/missing/events", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing session: status = %d", rec.Code)
+	}
+	plain := newTestServer(t, &fakeHandler{}, &fakeStore{})
+	if rec := doRequest(t, plain, http.MethodGet, "/v1/sessions/session-1/events", ""); rec.Code != http.StatusNotImplemented {
+		t.Fatalf("store without log: status = %d", rec.Code)
+	}
+}
+
+type fakeRewinder struct {
+	fakeHandler
+	st             *statex.SessionState
+	err            error
+	lastBeforeTurn int
+}
+
+func (f *fakeRewinder) Rewind(ctx context.Context, sessionID string, beforeTurn int) (*statex.SessionState, error) {
+	f.lastBeforeTurn = beforeTurn
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.st, nil
+}
+
+func TestRewindSession(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	handler := &fakeRewinder{st: statex.NewSessionState("session-1", "ws", "cust", "web", now)}
+	srv := newTestServer(t, handler, &fakeStore{})
+
+	rec := doRequest(t, srv, http.MethodPost, "/v1/sessions/session-1/rewind", `{"before_turn":3}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if handler.lastBeforeTurn != 3 {
+		t.Fatalf("before_turn = %d, want 3", handler.lastBeforeTurn)
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"invalid turn", fmt.Errorf("wrap: %w", statex.ErrInvalidRewind), http.StatusBadRequest, "invalid_rewind"},
+		{"no snapshot", statex.ErrSnapshotNotFound, http.StatusNotFound, "snapshot_not_found"},
+		{"store without history", orchestratorx.ErrRewindUnsupported, http.StatusNotImplemented, "rewind_unsupported"},
+	}
+	for _, tt := range tests {
+		handler.err = tt.err
+		rec := doRequest(t, srv, http.MethodPost, "/v1/sessions/session-1/rewind", `{"before_turn":9}`)
+		if rec.Code != tt.status || decodeErrorCode(t, rec) != tt.code {
+			t.Fatalf("%s: status = %d, body = %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	plain := newTestServer(t, &fakeHandler{}, &fakeStore{})
+	if rec := doRequest(t, plain, http.MethodPost, "/v1/sessions/session-1/rewind", `{"before_turn":1}`); rec.Code != http.StatusNotImplemented {
+		t.Fatalf("handler without rewind: status = %d", rec.Code)
+	}
+}
+
+func newTestServer(t *testing.T, handler MessageHandler, store statex.Store) *Server {
+	t.Helper()
+	srv, err := New(handler, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return srv
+}
+
+func doRequest(t *testing.T, srv *Server, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeErrorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body: %v", err)
+	}
+	return body.Error.Code
+}
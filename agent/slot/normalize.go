@@ -0,0 +1,310 @@
+package slot
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Normalize converts the text values of patch into the canonical typed values
+// of their specs: numbers from Thai or Arabic numerals, Thai number words and
+// shorthand such as "35k" or "15,000 บาท", number ranges as {"min", "max"},
+// yes/no words as bools and enum values in their declared spelling. It returns
+// the normalized patch and, for every converted value, the original text.
+// Values that cannot be converted are left as they are for Validate to reject.
+func (s *Schema) Normalize(patch map[string]any) (map[string]any, map[string]string) {
+	if len(patch) == 0 {
+		return patch, nil
+	}
+	out := make(map[string]any, len(patch))
+	var raw map[string]string
+	for name, v := range patch {
+		out[name] = v
+		spec, ok := s.Spec(name)
+		if !ok {
+			continue
+		}
+		text, ok := v.(string)
+		if !ok {
+			continue
+		}
+		norm, ok := spec.normalizeText(text)
+		if !ok {
+			continue
+		}
+		out[name] = norm
+		if norm != text {
+			if raw == nil {
+				raw = make(map[string]string, len(patch))
+			}
+			raw[name] = text
+		}
+	}
+	return out, raw
+}
+
+// NormalizeGeneric is Normalize for goal types without a schema: a text value
+// that reads entirely as an amount or a range, such as "35k", "หนึ่งพันห้า" or
+// "1000-2000", becomes a number or a {"min", "max"} range, and any other value
+// is left as it is. Digit strings with a leading zero, such as phone or serial
+// numbers, stay text.
+func NormalizeGeneric(patch map[string]any) (map[string]any, map[string]string) {
+	if len(patch) == 0 {
+		return patch, nil
+	}
+	out := make(map[string]any, len(patch))
+	var raw map[string]string
+	for name, v := range patch {
+		out[name] = v
+		text, ok := v.(string)
+		if !ok || isCode(text) {
+			continue
+		}
+		norm, ok := parseAmount(text)
+		if !ok {
+			continue
+		}
+		out[name] = norm
+		if raw == nil {
+			raw = make(map[string]string, len(patch))
+		}
+		raw[name] = text
+	}
+	return out, raw
+}
+
+// isCode reports whether text is a digit string with a leading zero, which
+// reads as an identifier rather than an amount.
+func isCode(text string) bool {
+	s := strings.TrimSpace(text)
+	return len(s) > 1 && s[0] == '0' && numeralRe.MatchString(s) && s[1] != '.'
+}
+
+// parseAmount reads text as a range or, failing that, a single number.
+func parseAmount(text string) (any, bool) {
+	if lo, hi, ok := ParseRange(text); ok {
+		return map[string]any{"min": lo, "max": hi}, true
+	}
+	return ParseNumber(text)
+}
+
+func (sp Spec) normalizeText(text string) (any, bool) {
+	switch sp.Kind {
+	case KindString:
+		trimmed := strings.TrimSpace(text)
+		for _, e := range sp.Enum {
+			if strings.EqualFold(e, trimmed) {
+				return e, true
+			}
+		}
+		return trimmed, true
+	case KindNumber, KindInteger:
+		return parseAmount(text)
+	case KindBool:
+		return parseBool(text)
+	default:
+		return nil, false
+	}
+}
+
+// Range returns the bounds of a normalized range value.
+func Range(v any) (lo, hi float64, ok bool) {
+	m, isMap := v.(map[string]any)
+	if !isMap || len(m) != 2 {
+		return 0, 0, false
+	}
+	lo, okLo := AsFloat(m["min"])
+	hi, okHi := AsFloat(m["max"])
+	return lo, hi, okLo && okHi
+}
+
+var (
+	thaiDigits = strings.NewReplacer(
+		"๐", "0", "๑", "1", "๒", "2", "๓", "3", "๔", "4",
+		"๕", "5", "๖", "6", "๗", "7", "๘", "8", "๙", "9",
+	)
+	// Currency and unit words dropped before parsing, longest first.
+	unitWords = []string{
+		"บาทถ้วน", "บาท", "฿", "thb", "baht",
+		"ชิ้น", "อัน", "เครื่อง", "ตัว", "pieces", "piece", "pcs", "units", "unit",
+		"ประมาณ", "about", "around",
+	}
+	// Multipliers written after a numeral, e.g. "35k" or "3 หมื่น".
+	suffixMultipliers = []struct {
+		suffix string
+		mult   float64
+	}{
+		{"ล้าน", 1e6}, {"แสน", 1e5}, {"หมื่น", 1e4}, {"พัน", 1e3}, {"ร้อย", 1e2},
+		{"m", 1e6}, {"k", 1e3},
+	}
+	numeralRe  = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+	rangeSepRe = regexp.MustCompile(`\s*(?:-|–|~|ถึง|\bto\b)\s*`)
+)
+
+// ParseNumber reads a single amount such as "1500", "1.5k", "๑,๕๐๐",
+// "15,000 บาท", "3 หมื่น" or "หนึ่งพันห้า".
+func ParseNumber(text string) (float64, bool) {
+	s := cleanNumberText(text)
+	if s == "" {
+		return 0, false
+	}
+	if n, ok := parseNumeral(s); ok {
+		return n, true
+	}
+	return parseThaiWords(s)
+}
+
+// ParseRange reads a range such as "1000-2000", "1-2k" or "ระหว่าง 1 ถึง 2 หมื่น".
+// A multiplier written only on the upper bound applies to both.
+func ParseRange(text string) (lo, hi float64, ok bool) {
+	s := strings.ToLower(strings.TrimSpace(text))
+	for _, prefix := range []string{"ระหว่าง", "between"} {
+		s = strings.TrimSpace(strings.TrimPrefix(s, prefix))
+	}
+	parts := rangeSepRe.Split(s, -1)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	left, right := cleanNumberText(parts[0]), cleanNumberText(parts[1])
+	hi, ok = ParseNumber(right)
+	if !ok {
+		return 0, 0, false
+	}
+	lo, ok = ParseNumber(left)
+	if !ok {
+		return 0, 0, false
+	}
+	if numeralRe.MatchString(left) {
+		for _, m := range suffixMultipliers {
+			if strings.HasSuffix(right, m.suffix) && lo < hi/m.mult {
+				lo *= m.mult
+				break
+			}
+		}
+	}
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo, hi, true
+}
+
+func cleanNumberText(text string) string {
+	s := strings.ToLower(thaiDigits.Replace(strings.TrimSpace(text)))
+	for _, w := range unitWords {
+		s = strings.ReplaceAll(s, w, "")
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	return strings.Join(strings.Fields(s), "")
+}
+
+// parseNumeral reads Arabic digits with an optional multiplier suffix.
+func parseNumeral(s string) (float64, bool) {
+	mult := 1.0
+	for _, m := range suffixMultipliers {
+		if rest, found := strings.CutSuffix(s, m.suffix); found && numeralRe.MatchString(rest) {
+			s, mult = rest, m.mult
+			break
+		}
+	}
+	if !numeralRe.MatchString(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n * mult, true
+}
+
+var (
+	thaiDigitWords = []struct {
+		word  string
+		value float64
+	}{
+		{"ศูนย์", 0}, {"หนึ่ง", 1}, {"เอ็ด", 1}, {"สอง", 2}, {"ยี่", 2}, {"สาม", 3},
+		{"สี่", 4}, {"ห้า", 5}, {"หก", 6}, {"เจ็ด", 7}, {"แปด", 8}, {"เก้า", 9},
+	}
+	thaiUnitWords = []struct {
+		word  string
+		value float64
+	}{
+		{"ล้าน", 1e6}, {"แสน", 1e5}, {"หมื่น", 1e4}, {"พัน", 1e3}, {"ร้อย", 1e2}, {"สิบ", 10},
+	}
+)
+
+// parseThaiWords reads Thai number words. A trailing digit after a unit counts
+// in the next lower unit, as in spoken prices: "หนึ่งพันห้า" is 1500 and
+// "สามหมื่นห้า" is 35000. Arabic numerals may stand in for digit words, as in
+// "1.5แสน" or "2ล้าน".
+func parseThaiWords(s string) (float64, bool) {
+	var (
+		total, millions float64
+		pending         float64
+		hasPending      bool
+		lastUnit        float64
+		parsed          bool
+	)
+next:
+	for s != "" {
+		if loc := leadingNumeral(s); loc > 0 {
+			n, err := strconv.ParseFloat(s[:loc], 64)
+			if err != nil || hasPending {
+				return 0, false
+			}
+			pending, hasPending, s = n, true, s[loc:]
+			continue
+		}
+		for _, d := range thaiDigitWords {
+			if rest, found := strings.CutPrefix(s, d.word); found {
+				if hasPending {
+					return 0, false
+				}
+				pending, hasPending, s = d.value, true, rest
+				continue next
+			}
+		}
+		for _, u := range thaiUnitWords {
+			if rest, found := strings.CutPrefix(s, u.word); found {
+				if !hasPending {
+					pending = 1
+				}
+				if u.value == 1e6 {
+					millions += (total + pending) * u.value
+					total = 0
+				} else {
+					total += pending * u.value
+				}
+				pending, hasPending, lastUnit, parsed, s = 0, false, u.value, true, rest
+				continue next
+			}
+		}
+		return 0, false
+	}
+	if hasPending {
+		if lastUnit > 10 && pending < 10 && pending == float64(int(pending)) {
+			pending *= lastUnit / 10
+		}
+		total += pending
+		parsed = true
+	}
+	return millions + total, parsed
+}
+
+func leadingNumeral(s string) int {
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	return i
+}
+
+func parseBool(text string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "true", "yes", "y", "ใช่", "ใช่ครับ", "ใช่ค่ะ", "ได้", "ถูกต้อง":
+		return true, true
+	case "false", "no", "n", "ไม่", "ไม่ใช่", "ไม่ครับ", "ไม่ค่ะ", "ไม่ได้":
+		return false, true
+	default:
+		return false, false
+	}
+}
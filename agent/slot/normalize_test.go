@@ -0,0 +1,89 @@
+package slot
+
+import (
+	"testing"
+)
+
+func TestParseNumberReadsThaiAndEnglishAmounts(t *testing.T) {
+	for text, want := range map[string]float64{
+		"1500":         1500,
+		"1.5k":         1500,
+		"35K":          35000,
+		"15,000 บาท":   15000,
+		"฿2,990":       2990,
+		"๑,๕๐๐":        1500,
+		"หนึ่งพันห้า":  1500,
+		"สามหมื่นห้า":  35000,
+		"ยี่สิบเอ็ด":   21,
+		"3 หมื่น":      30000,
+		"1.5 แสน":      150000,
+		"สองล้านห้า":   2500000,
+		"ประมาณ 2 พัน": 2000,
+		"หนึ่งร้อยสิบ": 110,
+	} {
+		got, ok := ParseNumber(text)
+		if !ok || got != want {
+			t.Errorf("ParseNumber(%q) = %v, %v; want %v", text, got, ok, want)
+		}
+	}
+	for _, text := range []string{"", "cheap", "พันหนึ่งสอง", "1.2.3"} {
+		if got, ok := ParseNumber(text); ok {
+			t.Errorf("ParseNumber(%q) = %v, want no number", text, got)
+		}
+	}
+}
+
+func TestSchemaNormalizeKeepsOriginalText(t *testing.T) {
+	schema := Schema{GoalType: "sales.recommend_item", Slots: []Spec{
+		{Name: "budget", Kind: KindNumber},
+		{Name: "shipping", Kind: KindString, Enum: []string{"express", "standard"}},
+		{Name: "gift", Kind: KindBool},
+	}}
+
+	out, raw := schema.Normalize(map[string]any{
+		"budget":   "1-2k",
+		"shipping": " Express ",
+		"gift":     "ใช่",
+		"note":     "35k",
+	})
+
+	if lo, hi, ok := Range(out["budget"]); !ok || lo != 1000 || hi != 2000 {
+		t.Fatalf("budget = %v, want range 1000-2000", out["budget"])
+	}
+	if out["shipping"] != "express" || out["gift"] != true || out["note"] != "35k" {
+		t.Fatalf("unexpected normalized patch %v", out)
+	}
+	if raw["budget"] != "1-2k" || raw["gift"] != "ใช่" || raw["shipping"] != " Express " {
+		t.Fatalf("unexpected raw text %v", raw)
+	}
+	if _, ok := raw["note"]; ok {
+		t.Fatal("slots without a spec must not be normalized")
+	}
+	if err := schema.Validate(out); err != nil {
+		t.Fatalf("Validate(normalized) = %v", err)
+	}
+}
+
+func TestNormalizeGenericConvertsOnlyWholeAmounts(t *testing.T) {
+	out, raw := NormalizeGeneric(map[string]any{
+		"budget":   "35k",
+		"price":    "หนึ่งพันห้า",
+		"range":    "1000-2000",
+		"phone":    "0812345678",
+		"model":    "iPhone 15",
+		"quantity": float64(2),
+	})
+
+	if out["budget"] != float64(35000) || out["price"] != float64(1500) {
+		t.Fatalf("unexpected amounts %v", out)
+	}
+	if lo, hi, ok := Range(out["range"]); !ok || lo != 1000 || hi != 2000 {
+		t.Fatalf("range = %v, want 1000-2000", out["range"])
+	}
+	if out["phone"] != "0812345678" || out["model"] != "iPhone 15" || out["quantity"] != float64(2) {
+		t.Fatalf("non-amount values must stay as they are, got %v", out)
+	}
+	if len(raw) != 3 || raw["budget"] != "35k" || raw["price"] != "หนึ่งพันห้า" || raw["range"] != "1000-2000" {
+		t.Fatalf("unexpected raw text %v", raw)
+	}
+}
@@ -0,0 +1,100 @@
+package slot
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Registry holds the slot schemas of the known goal types. Goal types without
+// a schema keep the planner's own missing/next_question.
+type Registry struct {
+	schemas map[string]*Schema
+}
+
+// NewRegistry returns a registry with the given schemas.
+func NewRegistry(schemas ...Schema) (*Registry, error) {
+	r := &Registry{schemas: make(map[string]*Schema, len(schemas))}
+	for _, s := range schemas {
+		if err := r.Register(s); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds or replaces the schema for s.GoalType.
+func (r *Registry) Register(s Schema) error {
+	goalType := strings.TrimSpace(s.GoalType)
+	if goalType == "" {
+		return fmt.Errorf("slot schema: goal type is empty")
+	}
+	seen := make(map[string]bool, len(s.Slots))
+	for _, spec := range s.Slots {
+		if spec.Name == "" || seen[spec.Name] {
+			return fmt.Errorf("slot schema %s: empty or duplicate slot name %q", goalType, spec.Name)
+		}
+		seen[spec.Name] = true
+		if spec.Required && strings.TrimSpace(spec.Question) == "" {
+			return fmt.Errorf("slot schema %s: required slot %s needs a question", goalType, spec.Name)
+		}
+	}
+	s.GoalType = goalType
+	r.schemas[goalType] = &s
+	return nil
+}
+
+// Lookup returns the schema for goalType. A nil registry has no schemas.
+func (r *Registry) Lookup(goalType string) (*Schema, bool) {
+	if r == nil {
+		return nil, false
+	}
+	s, ok := r.schemas[strings.TrimSpace(goalType)]
+	return s, ok
+}
+
+// Describe renders every schema with Schema.Describe, one line each, sorted by
+// goal type. A nil or empty registry describes as "".
+func (r *Registry) Describe() string {
+	if r == nil {
+		return ""
+	}
+	lines := make([]string, 0, len(r.schemas))
+	for _, goalType := range slices.Sorted(maps.Keys(r.schemas)) {
+		lines = append(lines, r.schemas[goalType].Describe())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DefaultRegistry returns the schemas for the built-in goal types.
+func DefaultRegistry() *Registry {
+	r, err := NewRegistry(
+		Schema{
+			GoalType: "sales.recommend_item",
+			Slots: []Spec{
+				{Name: "category", Kind: KindString, Required: true, Question: "สนใจสินค้าประเภทไหนครับ"},
+				{Name: "budget", Kind: KindNumber, Required: true, Min: ptr(0), Question: "งบประมาณประมาณเท่าไหร่ครับ", Confirm: true},
+				{Name: "brand_preference", Kind: KindString},
+				{Name: "quantity", Kind: KindInteger, Min: ptr(1), Confirm: true},
+				{Name: "shipping_address", Kind: KindString, Confirm: true},
+			},
+		},
+		Schema{
+			GoalType: "support.troubleshoot",
+			Slots: []Spec{
+				{Name: "device_model", Kind: KindString, Required: true, Question: "ใช้อุปกรณ์รุ่นอะไรอยู่ครับ"},
+				{Name: "symptom", Kind: KindString, Required: true, Question: "อาการที่เจอเป็นอย่างไรครับ"},
+				{Name: "serial_number", Kind: KindString, Confirm: true},
+			},
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,246 @@
+package slot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidSlot is returned when a slot value does not fit its Spec.
+var ErrInvalidSlot = errors.New("invalid slot value")
+
+// Kind is the value type of a slot.
+type Kind string
+
+const (
+	KindString  Kind = "string"
+	KindNumber  Kind = "number"
+	KindInteger Kind = "integer"
+	KindBool    Kind = "bool"
+)
+
+// Spec declares one slot of a goal type.
+type Spec struct {
+	Name     string
+	Kind     Kind
+	Required bool
+	// Enum restricts string slots to these values (compared case-insensitively).
+	Enum []string
+	// Min and Max bound number and integer slots when set.
+	Min *float64
+	Max *float64
+	// Question asks the customer for this slot while it is missing.
+	Question string
+	// Confirm marks a high-impact slot whose value the customer must confirm
+	// before the goal proceeds to act.
+	Confirm bool
+}
+
+// Schema is the ordered slot list of one goal type. The order of Slots is the
+// order in which missing slots are asked for.
+type Schema struct {
+	GoalType string
+	Slots    []Spec
+}
+
+// Spec returns the spec of slot name.
+func (s *Schema) Spec(name string) (Spec, bool) {
+	for _, spec := range s.Slots {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return Spec{}, false
+}
+
+// Validate checks every value of patch that has a Spec. Slots the schema does
+// not declare are left to the caller; a nil value clears a slot and is always
+// valid.
+func (s *Schema) Validate(patch map[string]any) error {
+	var errs []error
+	for _, name := range sortedKeys(patch) {
+		spec, ok := s.Spec(name)
+		if !ok || patch[name] == nil {
+			continue
+		}
+		if err := spec.Check(patch[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DropInvalid returns patch without the values Validate rejects, and the
+// rejections joined. A dropped required slot stays missing, so the schema asks
+// for it again instead of failing the turn.
+func (s *Schema) DropInvalid(patch map[string]any) (map[string]any, error) {
+	var (
+		out  map[string]any
+		errs []error
+	)
+	for _, name := range sortedKeys(patch) {
+		spec, ok := s.Spec(name)
+		if ok && patch[name] != nil {
+			if err := spec.Check(patch[name]); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if out == nil {
+			out = make(map[string]any, len(patch))
+		}
+		out[name] = patch[name]
+	}
+	return out, errors.Join(errs...)
+}
+
+// Describe renders the schema as one line for the planner prompt, e.g.
+// "sales.recommend_item: category (string, required), budget (number ≥ 0)".
+func (s *Schema) Describe() string {
+	slots := make([]string, 0, len(s.Slots))
+	for _, spec := range s.Slots {
+		slots = append(slots, spec.Describe())
+	}
+	return s.GoalType + ": " + strings.Join(slots, ", ")
+}
+
+// Missing returns the required slots that have no value in slots, in schema
+// order, and the question for the first of them.
+func (s *Schema) Missing(slots map[string]any) ([]string, string) {
+	var (
+		missing  []string
+		question string
+	)
+	for _, spec := range s.Slots {
+		if !spec.Required || !IsEmpty(slots[spec.Name]) {
+			continue
+		}
+		if len(missing) == 0 {
+			question = spec.Question
+		}
+		missing = append(missing, spec.Name)
+	}
+	return missing, question
+}
+
+// Check returns ErrInvalidSlot unless v fits the spec.
+func (sp Spec) Check(v any) error {
+	switch sp.Kind {
+	case KindString:
+		str, ok := v.(string)
+		if !ok {
+			return sp.invalid(v, "want a string")
+		}
+		if len(sp.Enum) > 0 && !slices.ContainsFunc(sp.Enum, func(e string) bool {
+			return strings.EqualFold(e, strings.TrimSpace(str))
+		}) {
+			return sp.invalid(v, "want one of "+strings.Join(sp.Enum, ", "))
+		}
+	case KindNumber, KindInteger:
+		if lo, hi, ok := Range(v); ok {
+			if lo > hi {
+				return sp.invalid(v, "range min above max")
+			}
+			if err := sp.checkNumber(lo); err != nil {
+				return err
+			}
+			return sp.checkNumber(hi)
+		}
+		n, ok := AsFloat(v)
+		if !ok {
+			return sp.invalid(v, "want a number")
+		}
+		return sp.checkNumber(n)
+	case KindBool:
+		if _, ok := v.(bool); !ok {
+			return sp.invalid(v, "want true or false")
+		}
+	default:
+		return fmt.Errorf("%w: slot %s has unknown kind %q", ErrInvalidSlot, sp.Name, sp.Kind)
+	}
+	return nil
+}
+
+// Describe renders the spec as its name followed by its constraints.
+func (sp Spec) Describe() string {
+	parts := []string{string(sp.Kind)}
+	if sp.Min != nil {
+		parts[0] += fmt.Sprintf(" ≥ %g", *sp.Min)
+	}
+	if sp.Max != nil {
+		parts[0] += fmt.Sprintf(" ≤ %g", *sp.Max)
+	}
+	if len(sp.Enum) > 0 {
+		parts = append(parts, "one of "+strings.Join(sp.Enum, "|"))
+	}
+	if sp.Required {
+		parts = append(parts, "required")
+	}
+	return sp.Name + " (" + strings.Join(parts, ", ") + ")"
+}
+
+func (sp Spec) checkNumber(n float64) error {
+	if sp.Kind == KindInteger && n != math.Trunc(n) {
+		return sp.invalid(n, "want an integer")
+	}
+	if sp.Min != nil && n < *sp.Min {
+		return sp.invalid(n, fmt.Sprintf("below minimum %g", *sp.Min))
+	}
+	if sp.Max != nil && n > *sp.Max {
+		return sp.invalid(n, fmt.Sprintf("above maximum %g", *sp.Max))
+	}
+	return nil
+}
+
+func (sp Spec) invalid(v any, reason string) error {
+	return fmt.Errorf("%w: %s=%v: %s", ErrInvalidSlot, sp.Name, v, reason)
+}
+
+// AsFloat converts the numeric types a decoded slot value can have.
+func AsFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case interface{ Float64() (float64, error) }: // json.Number
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// IsEmpty reports whether a slot value counts as not filled: nil, a blank
+// string or an empty list or map.
+func IsEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	if s, ok := v.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package slot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSchemaMissingFollowsDeclaredOrder(t *testing.T) {
+	schema, ok := DefaultRegistry().Lookup("sales.recommend_item")
+	if !ok {
+		t.Fatal("expected a sales.recommend_item schema")
+	}
+
+	missing, question := schema.Missing(map[string]any{"budget": 1500, "category": "  "})
+	if !slices.Equal(missing, []string{"category"}) || question != "สนใจสินค้าประเภทไหนครับ" {
+		t.Fatalf("Missing() = %v, %q", missing, question)
+	}
+	if missing, question := schema.Missing(map[string]any{"budget": 0, "category": "mouse"}); missing != nil || question != "" {
+		t.Fatalf("a zero budget is a value, got missing=%v question=%q", missing, question)
+	}
+}
+
+func TestSchemaValidateChecksKindsEnumsAndRanges(t *testing.T) {
+	lo, hi := 1.0, 10.0
+	schema := Schema{GoalType: "sales.order", Slots: []Spec{
+		{Name: "quantity", Kind: KindInteger, Min: &lo, Max: &hi},
+		{Name: "shipping", Kind: KindString, Enum: []string{"standard", "express"}},
+		{Name: "gift", Kind: KindBool},
+	}}
+
+	valid := map[string]any{"quantity": float64(3), "shipping": "Express", "gift": true, "note": 42, "shipping_alt": nil}
+	if err := schema.Validate(valid); err != nil {
+		t.Fatalf("Validate(valid) = %v", err)
+	}
+
+	for name, patch := range map[string]map[string]any{
+		"fraction":   {"quantity": 2.5},
+		"too many":   {"quantity": 11},
+		"not enum":   {"shipping": "drone"},
+		"wrong bool": {"gift": "yes"},
+	} {
+		if err := schema.Validate(patch); !errors.Is(err, ErrInvalidSlot) {
+			t.Errorf("%s: Validate() = %v, want ErrInvalidSlot", name, err)
+		}
+	}
+}
+
+func TestSchemaDropInvalidKeepsTheValidValues(t *testing.T) {
+	schema, _ := DefaultRegistry().Lookup("sales.recommend_item")
+
+	patch, err := schema.DropInvalid(map[string]any{"category": 42, "budget": "cheap", "brand_preference": "Logitech", "note": "gift"})
+	if !errors.Is(err, ErrInvalidSlot) {
+		t.Fatalf("DropInvalid() error = %v, want ErrInvalidSlot", err)
+	}
+	if len(patch) != 2 || patch["brand_preference"] != "Logitech" || patch["note"] != "gift" {
+		t.Fatalf("DropInvalid() = %v, want only brand_preference and note", patch)
+	}
+	if missing, _ := schema.Missing(patch); !slices.Equal(missing, []string{"category", "budget"}) {
+		t.Fatalf("dropped required slots should be missing, got %v", missing)
+	}
+}
+
+func TestRegistryDescribeListsSchemasByGoalType(t *testing.T) {
+	want := "sales.recommend_item: category (string, required), budget (number ≥ 0, required), " +
+		"brand_preference (string), quantity (integer ≥ 1), shipping_address (string)\n" +
+		"support.troubleshoot: device_model (string, required), symptom (string, required), serial_number (string)"
+	if got := DefaultRegistry().Describe(); got != want {
+		t.Fatalf("Describe() =\n%s\nwant\n%s", got, want)
+	}
+	var r *Registry
+	if got := r.Describe(); got != "" {
+		t.Fatalf("nil registry Describe() = %q", got)
+	}
+}
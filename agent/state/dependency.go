@@ -0,0 +1,181 @@
+package state
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrDependencyCycle means goals would (transitively) depend on themselves.
+var ErrDependencyCycle = errors.New("goal dependency cycle")
+
+// SetGoalDependencies replaces the goals goalID depends on. Each dependency must
+// be a live or archived goal; archived goals are closed, so they are dropped
+// rather than recorded. A change that would close a cycle returns
+// ErrDependencyCycle and records nothing.
+func (s *SessionState) SetGoalDependencies(goalID string, deps []string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	for _, id := range deps {
+		if !s.knownGoal(id) {
+			return fmt.Errorf("%w: goal %s depends on %s", ErrGoalNotFound, goalID, id)
+		}
+	}
+	deps = slices.DeleteFunc(slices.Compact(slices.Sorted(slices.Values(deps))), func(id string) bool {
+		_, live := s.Goals[id]
+		return !live
+	})
+	if slices.Equal(g.DependsOn, deps) {
+		return nil
+	}
+	if cycle := dependencyCycle(s.Goals, goalID, deps); cycle != nil {
+		return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+	return s.emit(GoalEvent{Type: EventDependsSet, GoalID: goalID, DependsOn: deps, At: now})
+}
+
+// PendingDependencies returns the goals g depends on that are still open.
+// Done, cancelled and archived goals no longer hold g back.
+func (s *SessionState) PendingDependencies(g *Goal) []string {
+	if s == nil || g == nil {
+		return nil
+	}
+	var pending []string
+	for _, id := range g.DependsOn {
+		if dep, ok := s.Goals[id]; ok && !dep.IsClosed() {
+			pending = append(pending, id)
+		}
+	}
+	return pending
+}
+
+// IsWaiting reports whether g cannot become active yet because a goal it
+// depends on is not done.
+func (s *SessionState) IsWaiting(g *Goal) bool {
+	return len(s.PendingDependencies(g)) > 0
+}
+
+// ReadyPrerequisite returns the open goal g waits for that can run now,
+// following dependencies down to one that waits for nothing, or nil if g does
+// not wait.
+func (s *SessionState) ReadyPrerequisite(g *Goal) *Goal {
+	seen := make(map[string]bool)
+	var walk func(g *Goal) *Goal
+	walk = func(g *Goal) *Goal {
+		for _, id := range s.PendingDependencies(g) {
+			dep, ok := s.Goals[id]
+			if !ok || dep.IsClosed() || seen[id] {
+				continue
+			}
+			seen[id] = true
+			if !s.IsWaiting(dep) {
+				return dep
+			}
+			if ready := walk(dep); ready != nil {
+				return ready
+			}
+		}
+		return nil
+	}
+	return walk(g)
+}
+
+// readyDependent returns the open goal that waited for goalID and can run now,
+// highest priority first.
+func (s *SessionState) readyDependent(goalID string) *Goal {
+	var ready []*Goal
+	for _, g := range s.Goals {
+		if !g.IsClosed() && slices.Contains(g.DependsOn, goalID) && !s.IsWaiting(g) {
+			ready = append(ready, g)
+		}
+	}
+	if len(ready) == 0 {
+		return nil
+	}
+	return slices.MinFunc(ready, func(a, b *Goal) int {
+		return cmp.Or(cmp.Compare(b.Priority, a.Priority), a.UpdatedAt.Compare(b.UpdatedAt), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// releaseDependents removes goalID from the dependencies of every goal that
+// depends on it, so that no goal waits for it once it is cancelled or refers
+// to it once it is archived.
+func (s *SessionState) releaseDependents(goalID string, now time.Time) error {
+	for _, id := range slices.Sorted(maps.Keys(s.Goals)) {
+		g := s.Goals[id]
+		if !slices.Contains(g.DependsOn, goalID) {
+			continue
+		}
+		deps := slices.DeleteFunc(slices.Clone(g.DependsOn), func(dep string) bool { return dep == goalID })
+		if err := s.emit(GoalEvent{Type: EventDependsSet, GoalID: id, DependsOn: deps, At: now}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionState) knownGoal(goalID string) bool {
+	if _, ok := s.Goals[goalID]; ok {
+		return true
+	}
+	_, ok := s.ArchivedGoal(goalID)
+	return ok
+}
+
+// dependencyCycle returns a dependency cycle in goals, with goalID depending on
+// deps instead of its current DependsOn, or nil if there is none.
+func dependencyCycle(goals map[string]*Goal, goalID string, deps []string) []string {
+	dependsOn := func(id string) []string {
+		if id == goalID {
+			return deps
+		}
+		if g, ok := goals[id]; ok {
+			return g.DependsOn
+		}
+		return nil
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(goals))
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch state[id] {
+		case visiting:
+			start := slices.Index(path, id)
+			return append(slices.Clone(path[start:]), id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range dependsOn(id) {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+
+	ids := slices.Sorted(maps.Keys(goals))
+	if goalID != "" && !slices.Contains(ids, goalID) {
+		ids = append(ids, goalID)
+	}
+	for _, id := range ids {
+		if cycle := visit(id); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
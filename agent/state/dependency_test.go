@@ -0,0 +1,172 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetGoalDependenciesRejectsCycles(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := st.AddGoal(CreateGoal(id, "support.troubleshoot", 100, now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := st.SetGoalDependencies("b", []string{"a"}, now); err != nil {
+		t.Fatalf("b -> a: %v", err)
+	}
+	if err := st.SetGoalDependencies("c", []string{"b"}, now); err != nil {
+		t.Fatalf("c -> b: %v", err)
+	}
+	if err := st.SetGoalDependencies("a", []string{"c"}, now); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("expected ErrDependencyCycle for a -> c, got %v", err)
+	}
+	if err := st.SetGoalDependencies("a", []string{"a"}, now); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("expected ErrDependencyCycle for a -> a, got %v", err)
+	}
+	if err := st.SetGoalDependencies("a", []string{"missing"}, now); !errors.Is(err, ErrGoalNotFound) {
+		t.Fatalf("expected ErrGoalNotFound, got %v", err)
+	}
+	if len(st.Goals["a"].DependsOn) != 0 {
+		t.Fatalf("rejected changes must not be recorded, got %v", st.Goals["a"].DependsOn)
+	}
+
+	// A cycle that bypassed SetGoalDependencies is still caught by Validate.
+	st.Goals["a"].DependsOn = []string{"c"}
+	if err := st.Validate(); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("expected Validate to report the cycle, got %v", err)
+	}
+}
+
+func TestMarkGoalDoneStartsGoalThatWaitedForIt(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+
+	mouse := CreateGoal("mouse", "sales.recommend_item", 50, now)
+	warranty := CreateGoal("warranty", "support.warranty_inquiry", 100, now)
+	replacement := CreateGoal("replacement", "sales.recommend_item", 50, now)
+	replacement.Status = GoalSuspended
+	for _, g := range []*Goal{mouse, warranty, replacement} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.SuspendAndActivate(mouse.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SuspendAndActivate(warranty.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalDependencies(replacement.ID, []string{warranty.ID}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.SwitchToGoal(replacement.ID, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected a waiting goal to refuse activation, got %v", err)
+	}
+
+	if err := st.MarkGoalDone(warranty.ID, now); err != nil {
+		t.Fatalf("MarkGoalDone: %v", err)
+	}
+	if st.ActiveGoalID != replacement.ID || st.Goals[replacement.ID].Status != GoalActive {
+		t.Fatalf("expected replacement started, got active=%s status=%s", st.ActiveGoalID, st.Goals[replacement.ID].Status)
+	}
+	if want := []string{mouse.ID, replacement.ID}; len(st.GoalStack) != 2 || st.GoalStack[0] != want[0] || st.GoalStack[1] != want[1] {
+		t.Fatalf("expected stack %v, got %v", want, st.GoalStack)
+	}
+	if st.Goals[mouse.ID].Status != GoalSuspended {
+		t.Fatalf("expected mouse still suspended underneath, got %s", st.Goals[mouse.ID].Status)
+	}
+}
+
+func TestArchivingPrerequisiteReleasesDependents(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	st.BeginTurn()
+
+	support := CreateGoal("sup", "support.warranty_inquiry", 100, now)
+	sales := CreateGoal("sal", "sales.recommend_item", 50, now)
+	sales.Status = GoalSuspended
+	other := CreateGoal("other", "support.troubleshoot", 100, now)
+	for _, g := range []*Goal{support, sales, other} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.SuspendAndActivate(support.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalDependencies(sales.ID, []string{support.ID}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MarkGoalDone(support.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ArchiveGoal(support.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Goals[sales.ID].DependsOn) != 0 {
+		t.Fatalf("expected the archived prerequisite dropped, got %v", st.Goals[sales.ID].DependsOn)
+	}
+
+	// Pushing the prerequisite's record out of the history keeps the session valid.
+	if err := st.CancelGoal(other.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ArchiveGoal(other.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.TrimGoalHistory(1, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.ArchivedGoal(support.ID); ok {
+		t.Fatal("expected the prerequisite's record trimmed")
+	}
+	if err := st.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	// Depending on an archived goal records nothing.
+	if err := st.SetGoalDependencies(sales.ID, []string{other.ID}, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Goals[sales.ID].DependsOn) != 0 {
+		t.Fatalf("expected no dependency on an archived goal, got %v", st.Goals[sales.ID].DependsOn)
+	}
+}
+
+func TestCancellingPrerequisiteReleasesDependents(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+
+	support := CreateGoal("sup", "support.warranty_inquiry", 100, now)
+	sales := CreateGoal("sal", "sales.recommend_item", 50, now)
+	sales.Status = GoalSuspended
+	for _, g := range []*Goal{support, sales} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.SuspendAndActivate(support.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalDependencies(sales.ID, []string{support.ID}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.ExpireGoal(support.ID, now); err != nil {
+		t.Fatalf("ExpireGoal: %v", err)
+	}
+	if st.IsWaiting(st.Goals[sales.ID]) || len(st.Goals[sales.ID].DependsOn) != 0 {
+		t.Fatalf("expected sal released, got depends_on=%v", st.Goals[sales.ID].DependsOn)
+	}
+	if st.Goals[sales.ID].Status != GoalSuspended {
+		t.Fatalf("expected sal to stay suspended, got %s", st.Goals[sales.ID].Status)
+	}
+	if err := st.SwitchToGoal(sales.ID, now); err != nil {
+		t.Fatalf("SwitchToGoal: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// GoalEventType names one kind of goal or stack change.
+type GoalEventType string
+
+const (
+	EventGoalCreated     GoalEventType = "goal_created"
+	EventSlotsPatched    GoalEventType = "slots_patched"
+	EventMissingSet      GoalEventType = "missing_set"
+	EventConfirmSet      GoalEventType = "confirm_set"
+	EventDependsSet      GoalEventType = "depends_set"
+	EventStatusChanged   GoalEventType = "status_changed"
+	EventPriorityChanged GoalEventType = "priority_changed"
+	EventTypeChanged     GoalEventType = "type_changed"
+	EventGoalPushed      GoalEventType = "goal_pushed"
+	EventGoalPopped      GoalEventType = "goal_popped"
+	EventGoalRemoved     GoalEventType = "goal_removed"
+	EventGoalQueued      GoalEventType = "goal_queued"
+	EventGoalResumed     GoalEventType = "goal_resumed"
+	EventGoalArchived    GoalEventType = "goal_archived"
+	EventHistoryTrimmed  GoalEventType = "history_trimmed"
+	EventActiveChanged   GoalEventType = "active_changed"
+	EventRewound         GoalEventType = "rewound"
+	EventCheckpoint      GoalEventType = "checkpoint"
+)
+
+// EventCheckpointInterval spaces the checkpoint events in a session's log:
+// every event whose Seq is a multiple of it is a checkpoint holding the goal
+// state as of the event before. Stores trim the log only up to a checkpoint,
+// so a trimmed log can still be replayed from the checkpoint it starts with.
+const EventCheckpointInterval = 100
+
+// GoalEvent records one change to Goals, GoalStack or ActiveGoalID. Only the
+// fields relevant to Type are set. Seq is 1-based and gapless per session.
+type GoalEvent struct {
+	Seq    int64         `json:"seq"`
+	Turn   int           `json:"turn"`
+	At     time.Time     `json:"at"`
+	Type   GoalEventType `json:"type"`
+	GoalID string        `json:"goal_id,omitempty"`
+
+	Goal         *Goal               `json:"goal,omitempty"`          // goal_created
+	Slots        map[string]any      `json:"slots,omitempty"`         // slots_patched
+	SlotMeta     map[string]SlotMeta `json:"slot_meta,omitempty"`     // slots_patched
+	Missing      []string            `json:"missing,omitempty"`       // missing_set
+	NextQuestion string              `json:"next_question,omitempty"` // missing_set
+	Confirm      []string            `json:"confirm,omitempty"`       // confirm_set
+	DependsOn    []string            `json:"depends_on,omitempty"`    // depends_set
+	From         GoalStatus          `json:"from,omitempty"`          // status_changed
+	To           GoalStatus          `json:"to,omitempty"`            // status_changed
+	Priority     int                 `json:"priority,omitempty"`      // priority_changed
+	GoalType     string              `json:"goal_type,omitempty"`     // type_changed
+	Record       *GoalHistoryEntry   `json:"record,omitempty"`        // goal_archived
+	Keep         int                 `json:"keep,omitempty"`          // history_trimmed
+
+	// rewound, checkpoint: the restored goal state; GoalID is the restored
+	// active goal.
+	Goals     map[string]*Goal `json:"goals,omitempty"`
+	GoalStack []string         `json:"goal_stack,omitempty"`
+	RewoundTo int              `json:"rewound_to,omitempty"`
+	// checkpoint: the archived goals.
+	History []GoalHistoryEntry `json:"history,omitempty"`
+}
+
+// GoalEventLog is implemented by stores that persist goal events. Save appends
+// the session's pending events atomically with the snapshot, so the log and the
+// snapshot never disagree. The log keeps the session's latest events (see
+// WithEventLimit) and expires with the session.
+type GoalEventLog interface {
+	// GoalEvents returns up to limit events of a live session with Seq >
+	// afterSeq, in order; limit <= 0 returns all of them. Page through the log
+	// by passing the last returned Seq as afterSeq.
+	GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]GoalEvent, error)
+}
+
+// PendingEvents returns the events recorded since the state was loaded or last
+// saved.
+func (s *SessionState) PendingEvents() []GoalEvent {
+	return slices.Clone(s.pendingEvents)
+}
+
+// emit stamps e with the next sequence number and the current turn, applies it
+// and queues it for the next Save. Every goal/stack mutation goes through here
+// so that replaying the log reproduces the snapshot. When the next sequence
+// number is due a checkpoint, the checkpoint is recorded first.
+func (s *SessionState) emit(e GoalEvent) error {
+	if (s.EventSeq+1)%EventCheckpointInterval == 0 {
+		if err := s.record(GoalEvent{
+			Type:      EventCheckpoint,
+			GoalID:    s.ActiveGoalID,
+			Goals:     s.Goals,
+			GoalStack: s.GoalStack,
+			History:   s.GoalHistory,
+			At:        e.At,
+		}); err != nil {
+			return err
+		}
+	}
+	return s.record(e)
+}
+
+// record applies e as the next event and queues it for the next Save.
+func (s *SessionState) record(e GoalEvent) error {
+	e.Seq = s.EventSeq + 1
+	e.Turn = s.Turn
+	e.At = e.At.UTC()
+	// A checkpoint describes the state as it is; applying it would only swap
+	// the live goals for copies.
+	if e.Type != EventCheckpoint {
+		if err := s.applyEvent(e); err != nil {
+			return err
+		}
+	}
+	s.EventSeq = e.Seq
+
+	// The live goal pointer is owned by the state; the log keeps a copy taken
+	// at this point in time.
+	if e.Goal != nil {
+		e.Goal = e.Goal.clone()
+	}
+	e.Slots = maps.Clone(e.Slots)
+	e.SlotMeta = maps.Clone(e.SlotMeta)
+	e.Missing = slices.Clone(e.Missing)
+	e.Confirm = slices.Clone(e.Confirm)
+	e.DependsOn = slices.Clone(e.DependsOn)
+	e.Goals = cloneGoals(e.Goals)
+	e.GoalStack = slices.Clone(e.GoalStack)
+	e.History = cloneHistory(e.History)
+	s.pendingEvents = append(s.pendingEvents, e)
+	return nil
+}
+
+// applyEvent performs the change e describes. Goal-field events stamp the goal's
+// UpdatedAt with e.At; stack and active-goal events leave it alone.
+func (s *SessionState) applyEvent(e GoalEvent) error {
+	s.EnsureGoalsMap()
+
+	if e.Type == EventGoalCreated {
+		if e.Goal == nil || e.Goal.ID == "" {
+			return ErrNilGoalID
+		}
+		s.Goals[e.Goal.ID] = e.Goal
+		return nil
+	}
+	if e.Type == EventActiveChanged && e.GoalID == "" {
+		s.ActiveGoalID = ""
+		return nil
+	}
+	if e.Type == EventRewound {
+		s.restoreGoals(e)
+		return nil
+	}
+	if e.Type == EventCheckpoint {
+		s.Goals = cloneGoals(e.Goals)
+		s.EnsureGoalsMap()
+		s.GoalStack = slices.Clone(e.GoalStack)
+		s.ActiveGoalID = e.GoalID
+		s.GoalHistory = cloneHistory(e.History)
+		return nil
+	}
+	if e.Type == EventGoalArchived {
+		return s.archiveGoal(e)
+	}
+	if e.Type == EventHistoryTrimmed {
+		s.GoalHistory = slices.Clone(s.GoalHistory[len(s.GoalHistory)-min(e.Keep, len(s.GoalHistory)):])
+		return nil
+	}
+
+	g, ok := s.Goals[e.GoalID]
+	if !ok {
+		return fmt.Errorf("%w: event %d %s goal_id=%s", ErrGoalNotFound, e.Seq, e.Type, e.GoalID)
+	}
+
+	switch e.Type {
+	case EventSlotsPatched:
+		for k, v := range e.Slots {
+			g.SetSlot(k, v)
+			if m, ok := e.SlotMeta[k]; ok {
+				g.setSlotMeta(k, m)
+			} else {
+				delete(g.SlotMeta, k)
+			}
+		}
+	case EventMissingSet:
+		g.Missing = slices.Clone(e.Missing)
+		g.NextQuestion = e.NextQuestion
+	case EventConfirmSet:
+		g.PendingConfirm = slices.Clone(e.Confirm)
+	case EventDependsSet:
+		g.DependsOn = slices.Clone(e.DependsOn)
+	case EventStatusChanged:
+		g.Status = e.To
+		g.SuspendedAt = time.Time{}
+		if e.To == GoalSuspended {
+			g.SuspendedAt = e.At
+		}
+	case EventPriorityChanged:
+		g.Priority = e.Priority
+	case EventTypeChanged:
+		g.Type = e.GoalType
+	case EventGoalPushed:
+		s.GoalStack = append(s.GoalStack, e.GoalID)
+		return nil
+	case EventGoalPopped:
+		if top, ok := s.PeekGoal(); !ok || top != e.GoalID {
+			return fmt.Errorf("%w: event %d pops %s but top is %q", ErrStackCorrupt, e.Seq, e.GoalID, top)
+		}
+		s.GoalStack = s.GoalStack[:len(s.GoalStack)-1]
+		return nil
+	case EventGoalRemoved:
+		// Removes every occurrence, unlike goal_popped which takes only the top.
+		s.GoalStack = slices.DeleteFunc(s.GoalStack, func(id string) bool { return id == e.GoalID })
+		return nil
+	case EventGoalQueued:
+		// Inserted beneath the top of the stack, where the active goal sits.
+		s.GoalStack = slices.Insert(s.GoalStack, max(len(s.GoalStack)-1, 0), e.GoalID)
+		return nil
+	case EventGoalResumed, EventActiveChanged:
+		s.ActiveGoalID = e.GoalID
+		if e.Type == EventActiveChanged {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown goal event type %q", e.Type)
+	}
+	g.UpdatedAt = e.At
+	return nil
+}
+
+// ReplayGoalEvents rebuilds Goals, GoalStack, ActiveGoalID and GoalHistory
+// from a complete event log, or from a trimmed one that starts at a checkpoint.
+// The result matches the snapshot saved with the last event.
+func ReplayGoalEvents(events []GoalEvent) (*SessionState, error) {
+	st := &SessionState{SchemaVersion: CurrentSchemaVersion}
+	st.EnsureGoalsMap()
+	if len(events) > 0 && events[0].Seq != 1 {
+		if events[0].Type != EventCheckpoint {
+			return nil, fmt.Errorf("goal event log starts at seq %d without a checkpoint", events[0].Seq)
+		}
+		st.EventSeq = events[0].Seq - 1
+	}
+	for _, e := range events {
+		if e.Seq != st.EventSeq+1 {
+			return nil, fmt.Errorf("goal event log has a gap: expected seq %d, got %d", st.EventSeq+1, e.Seq)
+		}
+		if e.Goal != nil {
+			e.Goal = e.Goal.clone()
+		}
+		if err := st.applyEvent(e); err != nil {
+			return nil, err
+		}
+		st.EventSeq = e.Seq
+	}
+	return st, nil
+}
+
+// archiveGoal applies a goal_archived event.
+func (s *SessionState) archiveGoal(e GoalEvent) error {
+	if _, ok := s.Goals[e.GoalID]; !ok {
+		return fmt.Errorf("%w: event %d %s goal_id=%s", ErrGoalNotFound, e.Seq, e.Type, e.GoalID)
+	}
+	delete(s.Goals, e.GoalID)
+	s.GoalStack = slices.DeleteFunc(s.GoalStack, func(id string) bool { return id == e.GoalID })
+	if s.ActiveGoalID == e.GoalID {
+		s.ActiveGoalID = ""
+	}
+	if e.Record != nil {
+		rec := *e.Record
+		rec.Slots = maps.Clone(rec.Slots)
+		s.GoalHistory = append(s.GoalHistory, rec)
+	}
+	return nil
+}
+
+func cloneHistory(history []GoalHistoryEntry) []GoalHistoryEntry {
+	out := slices.Clone(history)
+	for i := range out {
+		out[i].Slots = maps.Clone(out[i].Slots)
+	}
+	return out
+}
+
+func (g *Goal) clone() *Goal {
+	c := *g
+	c.Slots = maps.Clone(g.Slots)
+	c.SlotMeta = maps.Clone(g.SlotMeta)
+	c.Missing = slices.Clone(g.Missing)
+	c.PendingConfirm = slices.Clone(g.PendingConfirm)
+	c.DependsOn = slices.Clone(g.DependsOn)
+	return &c
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestGoalEventsReplayInterleavedWorkflow(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	st.BeginTurn()
+
+	sales := CreateGoal("sales", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(sales); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SuspendAndActivate(sales.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalMissing(sales.ID, []string{"budget"}, "งบเท่าไหร่ครับ", now); err != nil {
+		t.Fatal(err)
+	}
+
+	later := now.Add(time.Minute)
+	st.BeginTurn()
+	support := CreateGoal("support", "support.troubleshoot", 80, later)
+	if err := st.AddGoal(support); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SuspendAndActivate(support.ID, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MarkGoalDone(support.ID, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.ActiveGoalID != sales.ID || st.Goals[sales.ID].Status != GoalActive {
+		t.Fatalf("expected sales resumed, got active=%s status=%s", st.ActiveGoalID, st.Goals[sales.ID].Status)
+	}
+
+	events := st.PendingEvents()
+	if events[len(events)-1].Type != EventGoalResumed || events[len(events)-1].Turn != 2 {
+		t.Fatalf("expected final goal_resumed event in turn 2, got %+v", events[len(events)-1])
+	}
+
+	replayed, err := ReplayGoalEvents(events)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	want, _ := json.Marshal([]any{st.ActiveGoalID, st.GoalStack, st.Goals})
+	got, _ := json.Marshal([]any{replayed.ActiveGoalID, replayed.GoalStack, replayed.Goals})
+	if string(got) != string(want) {
+		t.Fatalf("replay diverged:\n got  %s\n want %s", got, want)
+	}
+}
+
+func TestReplayGoalEventsRejectsGaps(t *testing.T) {
+	events := []GoalEvent{
+		{Seq: 1, Type: EventGoalCreated, GoalID: "g", Goal: &Goal{ID: "g"}},
+		{Seq: 3, Type: EventGoalPushed, GoalID: "g"},
+	}
+	if _, err := ReplayGoalEvents(events); err == nil {
+		t.Fatal("expected an error for a gap in the log")
+	}
+}
+
+func TestReplayGoalEventsNeedsCheckpointForTrimmedLog(t *testing.T) {
+	events := []GoalEvent{
+		{Seq: 5, Type: EventGoalPushed, GoalID: "g"},
+	}
+	if _, err := ReplayGoalEvents(events); err == nil {
+		t.Fatal("expected an error for a trimmed log without a checkpoint")
+	}
+}
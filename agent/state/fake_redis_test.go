@@ -0,0 +1,420 @@
+package state_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// fakeRedis is the keyspace shared by the Upstash and RESP stand-ins. It
+// implements the commands the Redis-backed stores send, and runs EVAL scripts
+// in a Lua interpreter whose redis.call goes back to the keyspace, so the
+// stores' real scripts are what the tests exercise. Callers serialize access.
+// With cluster set, commands and scripts whose keys fall in different hash
+// slots fail with CROSSSLOT as on Redis Cluster.
+type fakeRedis struct {
+	cluster bool
+
+	data    map[string]string
+	lists   map[string][]string
+	hashes  map[string]map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis() fakeRedis {
+	return fakeRedis{
+		data:    make(map[string]string),
+		lists:   make(map[string][]string),
+		hashes:  make(map[string]map[string]string),
+		expires: make(map[string]time.Time),
+	}
+}
+
+// exec runs one command. Results are nil, int64, string, []string, []any or
+// error.
+func (f *fakeRedis) exec(cmd string, args []string) any {
+	keys := commandKeys(cmd, args)
+	if strings.EqualFold(cmd, "EVAL") {
+		numKeys, _ := strconv.Atoi(args[1])
+		keys = args[2 : 2+numKeys]
+	}
+	if f.cluster && crossSlot(keys) {
+		return fmt.Errorf("CROSSSLOT Keys in request don't hash to the same slot")
+	}
+	for _, key := range commandKeys(cmd, args) {
+		f.expire(key)
+	}
+	switch strings.ToUpper(cmd) {
+	case "PING":
+		return "PONG"
+	case "SELECT":
+		return "OK"
+	case "GET":
+		if v, ok := f.data[args[0]]; ok {
+			return v
+		}
+		return nil
+	case "TIME":
+		now := time.Now()
+		return []string{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}
+	case "SET":
+		var ttl time.Duration
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if f.exists(args[0]) {
+					return nil
+				}
+			case "EX", "PX":
+				n, _ := strconv.ParseInt(args[i+1], 10, 64)
+				ttl = time.Duration(n) * time.Second
+				if strings.EqualFold(args[i], "PX") {
+					ttl = time.Duration(n) * time.Millisecond
+				}
+				i++
+			}
+		}
+		f.data[args[0]] = args[1]
+		delete(f.expires, args[0])
+		if ttl > 0 {
+			f.expires[args[0]] = time.Now().Add(ttl)
+		}
+		return "OK"
+	case "INCR":
+		n, _ := strconv.ParseInt(f.data[args[0]], 10, 64)
+		f.data[args[0]] = strconv.FormatInt(n+1, 10)
+		return n + 1
+	case "EXISTS":
+		if f.exists(args[0]) {
+			return int64(1)
+		}
+		return int64(0)
+	case "DEL":
+		var n int64
+		for _, key := range args {
+			if f.exists(key) {
+				n++
+			}
+			f.drop(key)
+		}
+		return n
+	case "RENAME":
+		if !f.exists(args[0]) {
+			return fmt.Errorf("ERR no such key")
+		}
+		f.drop(args[1])
+		if v, ok := f.data[args[0]]; ok {
+			f.data[args[1]] = v
+		}
+		if v, ok := f.lists[args[0]]; ok {
+			f.lists[args[1]] = v
+		}
+		if v, ok := f.hashes[args[0]]; ok {
+			f.hashes[args[1]] = v
+		}
+		if at, ok := f.expires[args[0]]; ok {
+			f.expires[args[1]] = at
+		}
+		f.drop(args[0])
+		return "OK"
+	case "EXPIRE", "PEXPIRE":
+		if !f.exists(args[0]) {
+			return int64(0)
+		}
+		n, _ := strconv.ParseInt(args[1], 10, 64)
+		unit := time.Second
+		if strings.EqualFold(cmd, "PEXPIRE") {
+			unit = time.Millisecond
+		}
+		f.expires[args[0]] = time.Now().Add(time.Duration(n) * unit)
+		return int64(1)
+	case "PERSIST":
+		if _, ok := f.expires[args[0]]; !ok {
+			return int64(0)
+		}
+		delete(f.expires, args[0])
+		return int64(1)
+	case "LPUSH":
+		for _, v := range args[1:] {
+			f.lists[args[0]] = append([]string{v}, f.lists[args[0]]...)
+		}
+		return int64(len(f.lists[args[0]]))
+	case "RPUSH":
+		f.lists[args[0]] = append(f.lists[args[0]], args[1:]...)
+		return int64(len(f.lists[args[0]]))
+	case "LRANGE":
+		list := f.lists[args[0]]
+		start, stop := listRange(len(list), args[1], args[2])
+		if start > stop {
+			return []string{}
+		}
+		return append([]string{}, list[start:stop+1]...)
+	case "LINDEX":
+		list := f.lists[args[0]]
+		i, _ := strconv.Atoi(args[1])
+		if i < 0 {
+			i += len(list)
+		}
+		if i < 0 || i >= len(list) {
+			return nil
+		}
+		return list[i]
+	case "LPOP":
+		list := f.lists[args[0]]
+		if len(list) == 0 {
+			return nil
+		}
+		f.setList(args[0], list[1:])
+		return list[0]
+	case "LREM":
+		// Only count 0 (remove all) is used.
+		var kept []string
+		for _, v := range f.lists[args[0]] {
+			if v != args[2] {
+				kept = append(kept, v)
+			}
+		}
+		removed := len(f.lists[args[0]]) - len(kept)
+		f.setList(args[0], kept)
+		return int64(removed)
+	case "HSET":
+		if f.hashes[args[0]] == nil {
+			f.hashes[args[0]] = make(map[string]string)
+		}
+		_, existed := f.hashes[args[0]][args[1]]
+		f.hashes[args[0]][args[1]] = args[2]
+		if existed {
+			return int64(0)
+		}
+		return int64(1)
+	case "HGET":
+		if v, ok := f.hashes[args[0]][args[1]]; ok {
+			return v
+		}
+		return nil
+	case "HDEL":
+		var n int64
+		for _, field := range args[1:] {
+			if _, ok := f.hashes[args[0]][field]; ok {
+				delete(f.hashes[args[0]], field)
+				n++
+			}
+		}
+		if len(f.hashes[args[0]]) == 0 {
+			f.drop(args[0])
+		}
+		return n
+	case "LTRIM":
+		list := f.lists[args[0]]
+		start, stop := listRange(len(list), args[1], args[2])
+		if start > stop {
+			f.drop(args[0])
+		} else {
+			f.lists[args[0]] = append([]string{}, list[start:stop+1]...)
+		}
+		return "OK"
+	case "SCAN":
+		// One page holds every key matching the MATCH pattern.
+		var pattern string
+		for i := 1; i+1 < len(args); i++ {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		keys := []string{}
+		for key := range f.data {
+			f.expire(key)
+			if ok, _ := path.Match(pattern, key); ok && f.exists(key) {
+				keys = append(keys, key)
+			}
+		}
+		return []any{"0", keys}
+	case "EVAL":
+		numKeys, _ := strconv.Atoi(args[1])
+		return f.eval(args[0], args[2:2+numKeys], args[2+numKeys:])
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", cmd)
+	}
+}
+
+// commandKeys returns the keys cmd reads or writes, to expire them first.
+func commandKeys(cmd string, args []string) []string {
+	switch strings.ToUpper(cmd) {
+	case "PING", "SELECT", "EVAL", "TIME", "SCAN":
+		return nil
+	case "DEL", "EXISTS":
+		return args
+	case "RENAME":
+		return args[:2]
+	default:
+		if len(args) == 0 {
+			return nil
+		}
+		return args[:1]
+	}
+}
+
+// crossSlot reports whether keys fall in different cluster slots. Keys are
+// compared by hash tag, or whole when they have none, which is at least as
+// strict as comparing their slots.
+func crossSlot(keys []string) bool {
+	for _, key := range keys {
+		if hashTag(key) != hashTag(keys[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashTag returns the part of key Redis Cluster hashes: the text between the
+// first "{" and the next "}" when it is not empty, else the whole key.
+func hashTag(key string) string {
+	if open := strings.IndexByte(key, '{'); open >= 0 {
+		if n := strings.IndexByte(key[open+1:], '}'); n > 0 {
+			return key[open+1 : open+1+n]
+		}
+	}
+	return key
+}
+
+func (f *fakeRedis) exists(key string) bool {
+	_, isString := f.data[key]
+	_, isList := f.lists[key]
+	_, isHash := f.hashes[key]
+	return isString || isList || isHash
+}
+
+// expire drops key once its TTL has passed.
+func (f *fakeRedis) expire(key string) {
+	if at, ok := f.expires[key]; ok && !time.Now().Before(at) {
+		f.drop(key)
+	}
+}
+
+func (f *fakeRedis) drop(key string) {
+	delete(f.data, key)
+	delete(f.lists, key)
+	delete(f.hashes, key)
+	delete(f.expires, key)
+}
+
+// setList stores list under key; like Redis, an empty list removes the key.
+func (f *fakeRedis) setList(key string, list []string) {
+	if len(list) == 0 {
+		f.drop(key)
+		return
+	}
+	f.lists[key] = list
+}
+
+// listRange resolves Redis list indexes, which may count from the end, to
+// bounds within a list of n entries. start > stop means an empty range.
+func listRange(n int, rawStart, rawStop string) (int, int) {
+	start, _ := strconv.Atoi(rawStart)
+	stop, _ := strconv.Atoi(rawStop)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	return start, min(stop, n-1)
+}
+
+// eval runs script the way Redis does: KEYS and ARGV are string tables,
+// redis.call runs a command against f and cjson.decode parses JSON. Replies
+// convert as in Redis: a nil reply is false in Lua, and a Lua number returns
+// as an integer.
+func (f *fakeRedis) eval(script string, keys, argv []string) any {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.SetGlobal("KEYS", luaStrings(L, keys))
+	L.SetGlobal("ARGV", luaStrings(L, argv))
+	redis := L.NewTable()
+	L.SetField(redis, "call", L.NewFunction(func(L *lua.LState) int {
+		args := make([]string, L.GetTop()-1)
+		for i := range args {
+			args[i] = L.Get(i + 2).String()
+		}
+		switch reply := f.exec(L.CheckString(1), args).(type) {
+		case error:
+			L.RaiseError("%v", reply)
+		case nil:
+			L.Push(lua.LFalse)
+		case int64:
+			L.Push(lua.LNumber(reply))
+		case string:
+			L.Push(lua.LString(reply))
+		case []string:
+			L.Push(luaStrings(L, reply))
+		}
+		return 1
+	}))
+	L.SetGlobal("redis", redis)
+	cjson := L.NewTable()
+	L.SetField(cjson, "decode", L.NewFunction(func(L *lua.LState) int {
+		var v any
+		if err := json.Unmarshal([]byte(L.CheckString(1)), &v); err != nil {
+			L.RaiseError("cjson.decode: %v", err)
+		}
+		L.Push(luaJSON(L, v))
+		return 1
+	}))
+	L.SetGlobal("cjson", cjson)
+
+	if err := L.DoString(script); err != nil {
+		return fmt.Errorf("ERR %v", err)
+	}
+	switch ret := L.Get(-1).(type) {
+	case lua.LNumber:
+		return int64(ret)
+	case lua.LString:
+		return string(ret)
+	case lua.LBool:
+		if ret {
+			return int64(1)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func luaStrings(L *lua.LState, items []string) *lua.LTable {
+	t := L.NewTable()
+	for _, item := range items {
+		t.Append(lua.LString(item))
+	}
+	return t
+}
+
+func luaJSON(L *lua.LState, v any) lua.LValue {
+	switch v := v.(type) {
+	case map[string]any:
+		t := L.NewTable()
+		for k, item := range v {
+			t.RawSetString(k, luaJSON(L, item))
+		}
+		return t
+	case []any:
+		t := L.NewTable()
+		for _, item := range v {
+			t.Append(luaJSON(L, item))
+		}
+		return t
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case bool:
+		return lua.LBool(v)
+	default:
+		return lua.LNil
+	}
+}
@@ -0,0 +1,176 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionBusy means another turn held the session lock for longer than the caller would wait.
+var ErrSessionBusy = errors.New("session is busy")
+
+// ErrLeaseLost means a held session lock expired or could not be refreshed, so
+// another turn may already hold it.
+var ErrLeaseLost = errors.New("session lock lost")
+
+// Locker serializes turns per session. Lock blocks until the session is free or
+// ctx is done, in which case it returns ctx.Err().
+type Locker interface {
+	Lock(ctx context.Context, sessionID string) (*Lease, error)
+}
+
+// Lease is a held session lock. Token increases with every acquisition of the
+// same session and identifies the lease. A turn that lost its lease is stopped
+// through Lost; a save it still makes with the token in its context (see
+// WithFencingToken) fails with ErrLeaseLost once a newer lease has saved.
+type Lease struct {
+	SessionID string
+	Token     int64
+
+	release  func(ctx context.Context) error
+	once     sync.Once
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// Release gives up the lock. Calling it more than once is a no-op.
+func (l *Lease) Release(ctx context.Context) error {
+	if l == nil || l.release == nil {
+		return nil
+	}
+	var err error
+	l.once.Do(func() {
+		err = l.release(ctx)
+	})
+	return err
+}
+
+// Lost is closed when the lock is lost while held. It is nil, and so never
+// ready, for locks that cannot be lost.
+func (l *Lease) Lost() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.lost
+}
+
+func (l *Lease) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
+
+type fencingTokenKey struct{}
+
+// WithFencingToken returns a copy of ctx whose saves carry the lease token.
+// Stores reject a save whose token is lower than the one the session was last
+// saved with, so a turn that outlived its lease cannot overwrite a newer one.
+func WithFencingToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// fencingToken returns the lease token of ctx, or 0 when saves are not fenced.
+func fencingToken(ctx context.Context) int64 {
+	token, _ := ctx.Value(fencingTokenKey{}).(int64)
+	return token
+}
+
+// LockConfig selects and tunes the session locker.
+type LockConfig struct {
+	// Backend is "memory" for single-instance setups or "redis" for a shared lease lock.
+	Backend       string        `envconfig:"BACKEND" split_words:"true" default:"memory"`
+	TTL           time.Duration `envconfig:"TTL" split_words:"true" default:"60s"`
+	RetryInterval time.Duration `envconfig:"RETRY_INTERVAL" split_words:"true" default:"100ms"`
+}
+
+// MemoryLocker is an in-process keyed mutex. Waiters for the same session are
+// granted the lock in arrival order. Tokens come from one counter for all
+// sessions, so they keep increasing after a session's entry is freed; the
+// counter starts from the clock in milliseconds so tokens also keep increasing
+// across restarts.
+type MemoryLocker struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionQueue
+	token    int64
+}
+
+type sessionQueue struct {
+	waiters []chan struct{}
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		sessions: make(map[string]*sessionQueue),
+	}
+}
+
+func (m *MemoryLocker) Lock(ctx context.Context, sessionID string) (*Lease, error) {
+	key := strings.TrimSpace(sessionID)
+	if key == "" {
+		return nil, ErrInvalidSession
+	}
+
+	m.mu.Lock()
+	q, held := m.sessions[key]
+	if !held {
+		m.sessions[key] = &sessionQueue{}
+		lease := m.newLeaseLocked(key)
+		m.mu.Unlock()
+		return lease, nil
+	}
+	ready := make(chan struct{})
+	q.waiters = append(q.waiters, ready)
+	m.mu.Unlock()
+
+	select {
+	case <-ready:
+		m.mu.Lock()
+		lease := m.newLeaseLocked(key)
+		m.mu.Unlock()
+		return lease, nil
+	case <-ctx.Done():
+		m.mu.Lock()
+		for i, w := range q.waiters {
+			if w == ready {
+				q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+				m.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		// The lock was handed to us while we gave up; pass it on.
+		m.handOffLocked(key)
+		m.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (m *MemoryLocker) newLeaseLocked(key string) *Lease {
+	m.token = max(m.token+1, time.Now().UnixMilli())
+	return &Lease{
+		SessionID: key,
+		Token:     m.token,
+		release: func(context.Context) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.handOffLocked(key)
+			return nil
+		},
+	}
+}
+
+// handOffLocked passes the lock to the next waiter or frees the session.
+func (m *MemoryLocker) handOffLocked(key string) {
+	q := m.sessions[key]
+	if q == nil {
+		return
+	}
+	if len(q.waiters) == 0 {
+		delete(m.sessions, key)
+		return
+	}
+	next := q.waiters[0]
+	q.waiters = q.waiters[1:]
+	close(next)
+}
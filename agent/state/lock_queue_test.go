@@ -0,0 +1,177 @@
+package state_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+const lockQueueKey = "conv:{s1}:agent:lock_queue"
+
+// redisLockers builds each Redis locker against its own fake server, with a
+// func reporting how many waiters are queued for session s1.
+var redisLockers = map[string]func(t *testing.T) (statex.Locker, func() int){
+	"upstash": newFakeUpstashLocker,
+	"resp": func(t *testing.T) (statex.Locker, func() int) {
+		return newFakeRESPLocker(t, false)
+	},
+	"resp on cluster": func(t *testing.T) (statex.Locker, func() int) {
+		return newFakeRESPLocker(t, true)
+	},
+}
+
+func TestRedisLockersGrantInArrivalOrder(t *testing.T) {
+	t.Parallel()
+	for name, newLocker := range redisLockers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testLockerGrantsInArrivalOrder(t, newLocker)
+		})
+	}
+}
+
+func TestRedisLockersDropWaitersThatGiveUp(t *testing.T) {
+	t.Parallel()
+	for name, newLocker := range redisLockers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testLockerDropsWaiterThatGivesUp(t, newLocker)
+		})
+	}
+}
+
+func testLockerGrantsInArrivalOrder(t *testing.T, newLocker func(t *testing.T) (statex.Locker, func() int)) {
+	locker, queued := newLocker(t)
+	first, err := locker.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			lease, err := locker.Lock(context.Background(), "s1")
+			if err != nil {
+				t.Errorf("Lock() waiter %d error = %v", n, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, n)
+			mu.Unlock()
+			_ = lease.Release(context.Background())
+		}(i)
+		waitForQueue(t, queued, i)
+	}
+
+	if err := first.Release(context.Background()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	wg.Wait()
+
+	if fmt.Sprint(order) != "[1 2 3]" {
+		t.Fatalf("grant order = %v, want [1 2 3]", order)
+	}
+	waitForQueue(t, queued, 0)
+}
+
+func testLockerDropsWaiterThatGivesUp(t *testing.T, newLocker func(t *testing.T) (statex.Locker, func() int)) {
+	locker, queued := newLocker(t)
+	held, err := locker.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := locker.Lock(ctx, "s1")
+		done <- err
+	}()
+	waitForQueue(t, queued, 1)
+	// Let the waiter learn its place before it gives up.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Lock() error = %v, want Canceled", err)
+	}
+	waitForQueue(t, queued, 0)
+
+	_ = held.Release(context.Background())
+	next, err := locker.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock() after release error = %v", err)
+	}
+	if next.Token <= held.Token {
+		t.Fatalf("Token = %d after %d, want it to increase", next.Token, held.Token)
+	}
+	_ = next.Release(context.Background())
+}
+
+func newFakeUpstashLocker(t *testing.T) (statex.Locker, func() int) {
+	t.Helper()
+	fake := newFakeUpstash()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := statex.NewUpstashRedisStore(statex.UpstashRedisConfig{URL: server.URL, Token: "token"}, statex.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewUpstashRedisStore() error = %v", err)
+	}
+	locker, err := statex.NewUpstashRedisLocker(store, testLockConfig)
+	if err != nil {
+		t.Fatalf("NewUpstashRedisLocker() error = %v", err)
+	}
+	return locker, func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.lists[lockQueueKey])
+	}
+}
+
+func newFakeRESPLocker(t *testing.T, cluster bool) (statex.Locker, func() int) {
+	t.Helper()
+	fake := startFakeRESP(t, "", nil)
+	fake.cluster = cluster
+	store, err := statex.NewRedisStore(statex.RedisConfig{Addr: fake.addr, PoolSize: 8})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	locker, err := statex.NewRedisLocker(store, testLockConfig)
+	if err != nil {
+		t.Fatalf("NewRedisLocker() error = %v", err)
+	}
+	return locker, func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.lists[lockQueueKey])
+	}
+}
+
+var testLockConfig = statex.LockConfig{TTL: time.Minute, RetryInterval: time.Millisecond}
+
+// waitForQueue waits until n waiters are queued for session s1.
+func waitForQueue(t *testing.T, queued func() int, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if queued() == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued waiters", n)
+}
@@ -0,0 +1,250 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Hash-tagged like the session keys, so the lock scripts work on Redis Cluster.
+	sessionLockRedisKey        = "conv:{%s}:agent:lock"
+	sessionLockTokenRedisKey   = "conv:{%s}:agent:lock_token"
+	sessionLockQueueRedisKey   = "conv:{%s}:agent:lock_queue"
+	sessionLockWaitersRedisKey = "conv:{%s}:agent:lock_waiters"
+
+	defaultLockTTL           = 60 * time.Second
+	defaultLockRetryInterval = 100 * time.Millisecond
+	// lockWaiterPolls is how many retry intervals a queued waiter may go
+	// without polling before it is dropped from the queue.
+	lockWaiterPolls = 10
+)
+
+// acquireScript queues a waiter and grants the lock in queue order. A first
+// call (ARGV[3] = 0) takes the next token from KEYS[2] and appends it to the
+// queue list KEYS[3]; later calls pass that token back. Every call records the
+// waiter's deadline (now + ARGV[4] ms) in the hash KEYS[4], and waiters at the
+// head of the queue whose deadline passed are dropped, so a crashed waiter only
+// holds up the queue for ARGV[4] ms. The head of the queue claims KEYS[1] with
+// SET NX PX ARGV[1] once it is free.
+//
+// The token counter is seeded from the clock in milliseconds and expires with
+// the session (ARGV[2], 0 for never), so tokens keep increasing even after it
+// expires. Returns the token once the lock is held, and minus the token while
+// queued.
+const acquireScript = `
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local token = tonumber(ARGV[3])
+if token == 0 then
+  if redis.call('EXISTS', KEYS[2]) == 0 then
+    redis.call('SET', KEYS[2], now)
+  end
+  token = redis.call('INCR', KEYS[2])
+  if tonumber(ARGV[2]) > 0 then
+    redis.call('PEXPIRE', KEYS[2], ARGV[2])
+  end
+  redis.call('RPUSH', KEYS[3], token)
+elseif not redis.call('HGET', KEYS[4], token) then
+  -- Dropped after polling too late; queue again at the back.
+  redis.call('RPUSH', KEYS[3], token)
+end
+redis.call('HSET', KEYS[4], token, now + tonumber(ARGV[4]))
+while true do
+  local head = redis.call('LINDEX', KEYS[3], 0)
+  if not head then
+    break
+  end
+  local deadline = redis.call('HGET', KEYS[4], head)
+  if deadline and tonumber(deadline) > now then
+    break
+  end
+  redis.call('LPOP', KEYS[3])
+  redis.call('HDEL', KEYS[4], head)
+end
+if redis.call('LINDEX', KEYS[3], 0) == tostring(token) and redis.call('SET', KEYS[1], token, 'NX', 'PX', ARGV[1]) then
+  redis.call('LPOP', KEYS[3])
+  redis.call('HDEL', KEYS[4], token)
+  return token
+end
+redis.call('PEXPIRE', KEYS[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[4], ARGV[4])
+return -token
+`
+
+// leaveScript takes a waiter that gave up out of the queue.
+const leaveScript = `
+redis.call('LREM', KEYS[1], 0, ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`
+
+// refreshScript extends the lease only while it is still ours.
+const refreshScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// releaseScript deletes the lock only while it is still ours.
+const releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// redisLocker is the lease lock shared by UpstashRedisLocker and RedisLocker.
+// eval runs a script and returns its integer reply (0 for nil).
+type redisLocker struct {
+	eval          func(ctx context.Context, script string, keys []string, args ...any) (int64, error)
+	ttl           time.Duration
+	retryInterval time.Duration
+	// tokenTTL is how long the token counter outlives its last use; it follows
+	// the store TTL so tokens keep increasing for as long as the session exists.
+	tokenTTL time.Duration
+}
+
+func newRedisLocker(eval func(ctx context.Context, script string, keys []string, args ...any) (int64, error), storeTTL time.Duration, cfg LockConfig) redisLocker {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	retry := cfg.RetryInterval
+	if retry <= 0 {
+		retry = defaultLockRetryInterval
+	}
+	tokenTTL := storeTTL
+	if tokenTTL > 0 && tokenTTL < ttl {
+		tokenTTL = ttl
+	}
+	return redisLocker{eval: eval, ttl: ttl, retryInterval: retry, tokenTTL: tokenTTL}
+}
+
+func (l *redisLocker) Lock(ctx context.Context, sessionID string) (*Lease, error) {
+	key := strings.TrimSpace(sessionID)
+	if key == "" {
+		return nil, ErrInvalidSession
+	}
+	lockKey := fmt.Sprintf(sessionLockRedisKey, key)
+	keys := []string{
+		lockKey,
+		fmt.Sprintf(sessionLockTokenRedisKey, key),
+		fmt.Sprintf(sessionLockQueueRedisKey, key),
+		fmt.Sprintf(sessionLockWaitersRedisKey, key),
+	}
+
+	waiterTTL := max(lockWaiterPolls*l.retryInterval, time.Second)
+
+	var token int64
+	for {
+		n, err := l.eval(ctx, acquireScript, keys, l.ttl.Milliseconds(), l.tokenTTL.Milliseconds(), token, waiterTTL.Milliseconds())
+		if err != nil {
+			l.leave(ctx, keys, token)
+			return nil, err
+		}
+		if n > 0 {
+			return l.newLease(key, lockKey, n), nil
+		}
+		token = -n
+
+		timer := time.NewTimer(l.retryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.leave(ctx, keys, token)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// leave takes a queued waiter that gave up out of the queue, so the ones
+// behind it need not wait for it to time out. It is best effort.
+func (l *redisLocker) leave(ctx context.Context, keys []string, token int64) {
+	if token == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.ttl/3)
+	defer cancel()
+	_, _ = l.eval(ctx, leaveScript, keys[2:], token)
+}
+
+func (l *redisLocker) newLease(sessionID, lockKey string, token int64) *Lease {
+	stop := make(chan struct{})
+	lease := &Lease{
+		SessionID: sessionID,
+		Token:     token,
+		lost:      make(chan struct{}),
+		release: func(ctx context.Context) error {
+			close(stop)
+			_, err := l.eval(ctx, releaseScript, []string{lockKey}, token)
+			return err
+		},
+	}
+	go l.keepAlive(lease, lockKey, stop)
+	return lease
+}
+
+// keepAlive refreshes the lease until it is released. A failed refresh, or one
+// that finds the lock taken over, marks the lease lost and stops.
+func (l *redisLocker) keepAlive(lease *Lease, lockKey string, stop <-chan struct{}) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			n, err := l.eval(ctx, refreshScript, []string{lockKey}, lease.Token, l.ttl.Milliseconds())
+			cancel()
+			if err != nil || n == 0 {
+				select {
+				case <-stop:
+				default:
+					lease.markLost()
+				}
+				return
+			}
+		}
+	}
+}
+
+// RedisLocker is the lease lock of UpstashRedisLocker over RESP, for
+// self-hosted Redis or Valkey. It shares the connection pool of a RedisStore,
+// which need not be the session store.
+type RedisLocker struct {
+	redisLocker
+}
+
+func NewRedisLocker(store *RedisStore, cfg LockConfig) (*RedisLocker, error) {
+	if store == nil {
+		return nil, errors.New("redis store is required")
+	}
+	return &RedisLocker{redisLocker: newRedisLocker(store.evalInt, store.ttl, cfg)}, nil
+}
+
+func (s *RedisStore) evalInt(ctx context.Context, script string, keys []string, args ...any) (int64, error) {
+	cmd := []any{"EVAL", script, len(keys)}
+	for _, k := range keys {
+		cmd = append(cmd, k)
+	}
+	cmd = append(cmd, args...)
+
+	reply, err := s.pool.do(ctx, cmd...)
+	if err != nil {
+		return 0, err
+	}
+	switch n := reply.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return n, nil
+	default:
+		return 0, fmt.Errorf("decode lock result: unexpected reply %T", reply)
+	}
+}
@@ -0,0 +1,245 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryLockerGrantsInArrivalOrder(t *testing.T) {
+	t.Parallel()
+
+	locker := NewMemoryLocker()
+	first, err := locker.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			lease, err := locker.Lock(context.Background(), "s1")
+			if err != nil {
+				t.Errorf("Lock() waiter %d error = %v", n, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, n)
+			mu.Unlock()
+			_ = lease.Release(context.Background())
+		}(i)
+		waitForWaiters(t, locker, "s1", i)
+	}
+
+	if err := first.Release(context.Background()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	wg.Wait()
+
+	if fmt.Sprint(order) != "[1 2 3]" {
+		t.Fatalf("grant order = %v, want [1 2 3]", order)
+	}
+	if len(locker.sessions) != 0 {
+		t.Fatalf("expected session entry cleaned up, got %d", len(locker.sessions))
+	}
+}
+
+func TestMemoryLockerRespectsContextDeadline(t *testing.T) {
+	t.Parallel()
+
+	locker := NewMemoryLocker()
+	held, err := locker.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock() error = %v, want DeadlineExceeded", err)
+	}
+
+	// Other sessions are not affected, and the timed-out waiter left the queue.
+	other, err := locker.Lock(context.Background(), "s2")
+	if err != nil {
+		t.Fatalf("Lock(s2) error = %v", err)
+	}
+	_ = other.Release(context.Background())
+	_ = held.Release(context.Background())
+
+	next, err := locker.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock() after release error = %v", err)
+	}
+	_ = next.Release(context.Background())
+}
+
+func TestUpstashRedisLockerAcquireAndRelease(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		commands [][]any
+		attempts int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var cmd []any
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			t.Errorf("decode command: %v", err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, cmd)
+		switch cmd[1] {
+		case acquireScript:
+			attempts++
+			if attempts == 1 {
+				// Queued behind another waiter.
+				fmt.Fprint(w, `{"result":-7}`)
+				return
+			}
+			fmt.Fprint(w, `{"result":7}`)
+		default:
+			fmt.Fprint(w, `{"result":1}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	store, err := NewUpstashRedisStore(UpstashRedisConfig{URL: server.URL, Token: "token"}, WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewUpstashRedisStore() error = %v", err)
+	}
+	locker, err := NewUpstashRedisLocker(store, LockConfig{TTL: time.Minute, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewUpstashRedisLocker() error = %v", err)
+	}
+
+	lease, err := locker.Lock(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if lease.Token != 7 {
+		t.Fatalf("Token = %d, want 7", lease.Token)
+	}
+	if err := lease.Release(context.Background()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(commands) != 3 {
+		t.Fatalf("commands = %d, want 2 acquire attempts + 1 release", len(commands))
+	}
+	if first := commands[0]; first[9] != float64(0) {
+		t.Fatalf("first acquire token = %v, want 0", first[9])
+	}
+	acquire := commands[1]
+	if fmt.Sprint(acquire[3:7]) != "[conv:{session-1}:agent:lock conv:{session-1}:agent:lock_token conv:{session-1}:agent:lock_queue conv:{session-1}:agent:lock_waiters]" {
+		t.Fatalf("unexpected acquire keys: %v", acquire[3:7])
+	}
+	if acquire[9] != float64(7) {
+		t.Fatalf("second acquire token = %v, want the queued token 7", acquire[9])
+	}
+	release := commands[2]
+	if release[1] != releaseScript || release[4] != float64(7) {
+		t.Fatalf("unexpected release command: %v", release)
+	}
+}
+
+func TestMemoryLockerTokensKeepIncreasingAfterRelease(t *testing.T) {
+	t.Parallel()
+
+	locker := NewMemoryLocker()
+	var last int64
+	for i := 0; i < 3; i++ {
+		lease, err := locker.Lock(context.Background(), "s1")
+		if err != nil {
+			t.Fatalf("Lock() error = %v", err)
+		}
+		if lease.Token <= last {
+			t.Fatalf("Token = %d after %d, want it to increase", lease.Token, last)
+		}
+		last = lease.Token
+		_ = lease.Release(context.Background())
+	}
+	if lease, _ := locker.Lock(context.Background(), "s1"); lease.Lost() != nil {
+		t.Fatal("a memory lease cannot be lost")
+	}
+}
+
+func TestUpstashRedisLockerReportsLostLease(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var cmd []any
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			t.Errorf("decode command: %v", err)
+			return
+		}
+		switch cmd[1] {
+		case acquireScript:
+			fmt.Fprint(w, `{"result":3}`)
+		case refreshScript:
+			// Another instance took the lock over after it expired.
+			fmt.Fprint(w, `{"result":0}`)
+		default:
+			fmt.Fprint(w, `{"result":0}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	store, err := NewUpstashRedisStore(UpstashRedisConfig{URL: server.URL, Token: "token"}, WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewUpstashRedisStore() error = %v", err)
+	}
+	locker, err := NewUpstashRedisLocker(store, LockConfig{TTL: 30 * time.Millisecond, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewUpstashRedisLocker() error = %v", err)
+	}
+
+	lease, err := locker.Lock(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer lease.Release(context.Background())
+
+	select {
+	case <-lease.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expected the lease to be reported lost after a failed refresh")
+	}
+}
+
+func waitForWaiters(t *testing.T, locker *MemoryLocker, sessionID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		locker.mu.Lock()
+		q := locker.sessions[sessionID]
+		got := 0
+		if q != nil {
+			got = len(q.waiters)
+		}
+		locker.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d waiters", n)
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// UpstashRedisLocker is a lease lock shared across instances. Waiters are
+// queued in Redis and granted the lock in arrival order. The lease is
+// refreshed in the background while held so long turns do not lose it; when a
+// refresh fails the lease reports itself lost.
+type UpstashRedisLocker struct {
+	redisLocker
+}
+
+func NewUpstashRedisLocker(store *UpstashRedisStore, cfg LockConfig) (*UpstashRedisLocker, error) {
+	if store == nil {
+		return nil, errors.New("upstash redis store is required")
+	}
+	return &UpstashRedisLocker{redisLocker: newRedisLocker(store.evalInt, store.ttl, cfg)}, nil
+}
+
+func (s *UpstashRedisStore) evalInt(ctx context.Context, script string, keys []string, args ...any) (int64, error) {
+	cmd := []any{"EVAL", script, len(keys)}
+	for _, k := range keys {
+		cmd = append(cmd, k)
+	}
+	cmd = append(cmd, args...)
+
+	resp, err := s.exec(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	result := bytes.TrimSpace(resp.Result)
+	if len(result) == 0 || bytes.Equal(result, []byte("null")) {
+		return 0, nil
+	}
+	var n int64
+	if err := json.Unmarshal(result, &n); err != nil {
+		return 0, fmt.Errorf("decode lock result: %w", err)
+	}
+	return n, nil
+}
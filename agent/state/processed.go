@@ -0,0 +1,43 @@
+package state
+
+import (
+	"strings"
+	"time"
+)
+
+// ProcessedMessage remembers the reply produced for a client message ID so that
+// channel retries of the same message can be answered without re-running the turn.
+type ProcessedMessage struct {
+	ID    string    `json:"id"`
+	Reply string    `json:"reply"`
+	Turn  int       `json:"turn"`
+	At    time.Time `json:"at"`
+}
+
+// ProcessedReply returns the cached reply for a message ID, if it is still remembered.
+func (s *SessionState) ProcessedReply(messageID string) (string, bool) {
+	id := strings.TrimSpace(messageID)
+	if id == "" {
+		return "", false
+	}
+	for i := len(s.ProcessedMessages) - 1; i >= 0; i-- {
+		if s.ProcessedMessages[i].ID == id {
+			return s.ProcessedMessages[i].Reply, true
+		}
+	}
+	return "", false
+}
+
+// RememberMessage records a processed message and drops the oldest ones beyond
+// maxEntries. maxEntries <= 0 keeps every entry.
+func (s *SessionState) RememberMessage(maxEntries int, m ProcessedMessage) {
+	m.ID = strings.TrimSpace(m.ID)
+	if m.ID == "" {
+		return
+	}
+	m.At = m.At.UTC()
+	s.ProcessedMessages = append(s.ProcessedMessages, m)
+	if maxEntries > 0 && len(s.ProcessedMessages) > maxEntries {
+		s.ProcessedMessages = append([]ProcessedMessage(nil), s.ProcessedMessages[len(s.ProcessedMessages)-maxEntries:]...)
+	}
+}
@@ -0,0 +1,26 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRememberMessageKeepsMostRecentIDs(t *testing.T) {
+	t.Parallel()
+
+	st := NewSessionState("s1", "ws", "cust", "chat", time.Now())
+	st.RememberMessage(2, ProcessedMessage{ID: "m1", Reply: "r1", Turn: 1})
+	st.RememberMessage(2, ProcessedMessage{ID: "m2", Reply: "r2", Turn: 2})
+	st.RememberMessage(2, ProcessedMessage{ID: "m3", Reply: "r3", Turn: 3})
+	st.RememberMessage(2, ProcessedMessage{ID: "  ", Reply: "ignored"})
+
+	if _, ok := st.ProcessedReply("m1"); ok {
+		t.Fatal("expected m1 to be evicted")
+	}
+	if reply, ok := st.ProcessedReply("m3"); !ok || reply != "r3" {
+		t.Fatalf("ProcessedReply(m3) = %q, %v", reply, ok)
+	}
+	if len(st.ProcessedMessages) != 2 {
+		t.Fatalf("len(ProcessedMessages) = %d, want 2", len(st.ProcessedMessages))
+	}
+}
@@ -0,0 +1,280 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisError is an error reply ("-ERR ...") sent by the server. The connection
+// stays usable after it.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// respConn is a single RESP2 connection. It is not safe for concurrent use;
+// respPool hands it to one caller at a time.
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func newRESPConn(conn net.Conn) *respConn {
+	return &respConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+func (c *respConn) do(args ...any) (any, error) {
+	if err := c.writeCommand(args); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *respConn) writeCommand(args []any) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		s, err := respArg(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return c.w.Flush()
+}
+
+func respArg(arg any) (string, error) {
+	switch v := arg.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	default:
+		return "", fmt.Errorf("unsupported redis argument type %T", arg)
+	}
+}
+
+// readReply decodes one reply: simple strings and bulk strings become string,
+// integers int64, arrays []any, nil bulk/array nil, and error replies redisError.
+func (c *respConn) readReply() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := c.readReply()
+			if err != nil {
+				var rerr redisError
+				if !errors.As(err, &rerr) {
+					return nil, err
+				}
+				item = rerr
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (c *respConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// respPool keeps up to size connections. Callers block in get until a
+// connection is free or ctx is done.
+type respPool struct {
+	dial    func(ctx context.Context) (*respConn, error)
+	timeout time.Duration
+	idle    chan *respConn
+	slots   chan struct{}
+}
+
+func newRESPPool(size int, timeout time.Duration, dial func(ctx context.Context) (*respConn, error)) *respPool {
+	return &respPool{
+		dial:    dial,
+		timeout: timeout,
+		idle:    make(chan *respConn, size),
+		slots:   make(chan struct{}, size),
+	}
+}
+
+func (p *respPool) get(ctx context.Context) (*respConn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	c, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *respPool) put(c *respConn, broken bool) {
+	defer func() { <-p.slots }()
+	if broken {
+		_ = c.conn.Close()
+		return
+	}
+	select {
+	case p.idle <- c:
+	default:
+		_ = c.conn.Close()
+	}
+}
+
+// do runs one command on a pooled connection. Network and protocol errors
+// discard the connection; error replies do not.
+func (p *respPool) do(ctx context.Context, args ...any) (any, error) {
+	c, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(p.timeout)
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline, ctxDeadline = d, true
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		p.put(c, true)
+		return nil, fmt.Errorf("set redis deadline: %w", err)
+	}
+
+	reply, err := c.do(args...)
+	var rerr redisError
+	broken := err != nil && !errors.As(err, &rerr)
+	p.put(c, broken)
+	if broken {
+		// Report a timeout on the deadline of ctx as ctx's own error.
+		var nerr net.Error
+		if ctxDeadline && errors.As(err, &nerr) && nerr.Timeout() {
+			return nil, context.DeadlineExceeded
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return reply, err
+}
+
+func (p *respPool) close() {
+	for {
+		select {
+		case c := <-p.idle:
+			_ = c.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// dialRESP opens a connection, performs the TLS handshake when tlsConfig is
+// set, then authenticates and selects the database.
+func dialRESP(ctx context.Context, cfg RedisConfig, tlsConfig *tls.Config) (*respConn, error) {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial redis: %w", err)
+	}
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	c := newRESPConn(conn)
+	if err := conn.SetDeadline(time.Now().Add(cfg.DialTimeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if cfg.Password != "" {
+		args := []any{"AUTH", cfg.Password}
+		if cfg.Username != "" {
+			args = []any{"AUTH", cfg.Username, cfg.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if cfg.DB > 0 {
+		if _, err := c.do("SELECT", cfg.DB); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis select db=%d: %w", cfg.DB, err)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// GoalHistoryEntry is the compact form a closed goal is kept in once it has
+// been archived out of Goals.
+type GoalHistoryEntry struct {
+	ID     string         `json:"id"`
+	Type   string         `json:"type"`
+	Status GoalStatus     `json:"status"` // done/cancelled
+	Slots  map[string]any `json:"slots,omitempty"`
+	// Expired marks goals cancelled by retention rather than by the customer.
+	Expired  bool      `json:"expired,omitempty"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+// ArchiveGoal moves a done or cancelled goal out of Goals and GoalStack into
+// GoalHistory. Archiving an open goal returns ErrInvalidTransition.
+func (s *SessionState) ArchiveGoal(goalID string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if !g.IsClosed() {
+		return fmt.Errorf("%w: cannot archive %s goal %s", ErrInvalidTransition, g.Status, goalID)
+	}
+	return s.archive(g, false, now)
+}
+
+// ExpireGoal cancels an open goal nobody came back to, as CancelGoal does, and
+// archives it with Expired set.
+func (s *SessionState) ExpireGoal(goalID string, now time.Time) error {
+	if err := s.CancelGoal(goalID, now); err != nil {
+		return err
+	}
+	return s.archive(s.Goals[goalID], true, now)
+}
+
+func (s *SessionState) archive(g *Goal, expired bool, now time.Time) error {
+	// Dependencies only refer to live goals, so trimming the history later
+	// cannot leave a dependent pointing at nothing.
+	if err := s.releaseDependents(g.ID, now); err != nil {
+		return err
+	}
+	rec := &GoalHistoryEntry{
+		ID:       g.ID,
+		Type:     g.Type,
+		Status:   g.Status,
+		Slots:    maps.Clone(g.Slots),
+		Expired:  expired,
+		ClosedAt: g.UpdatedAt.UTC(),
+	}
+	return s.emit(GoalEvent{Type: EventGoalArchived, GoalID: g.ID, Record: rec, At: now})
+}
+
+// SuspendActiveGoal suspends the active goal and leaves the session without
+// one, so the next plan decides whether the customer is picking it up again.
+// The goal keeps its place on GoalStack.
+func (s *SessionState) SuspendActiveGoal(now time.Time) error {
+	g := s.ActiveGoal()
+	if g == nil {
+		return ErrNoActiveGoal
+	}
+	if g.Status != GoalSuspended {
+		if err := s.transition(g, GoalSuspended, now); err != nil {
+			return err
+		}
+	}
+	if err := s.emit(GoalEvent{Type: EventActiveChanged, At: now}); err != nil {
+		return err
+	}
+	s.Touch(now)
+	return nil
+}
+
+// ArchivedGoal returns the history record of an archived goal.
+func (s *SessionState) ArchivedGoal(goalID string) (GoalHistoryEntry, bool) {
+	if s == nil {
+		return GoalHistoryEntry{}, false
+	}
+	i := slices.IndexFunc(s.GoalHistory, func(r GoalHistoryEntry) bool { return r.ID == goalID })
+	if i < 0 {
+		return GoalHistoryEntry{}, false
+	}
+	return s.GoalHistory[i], true
+}
+
+// TrimGoalHistory keeps only the keep most recently archived records.
+func (s *SessionState) TrimGoalHistory(keep int, now time.Time) error {
+	keep = max(keep, 0)
+	if len(s.GoalHistory) <= keep {
+		return nil
+	}
+	return s.emit(GoalEvent{Type: EventHistoryTrimmed, Keep: keep, At: now})
+}
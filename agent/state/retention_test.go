@@ -0,0 +1,69 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestArchiveAndExpireGoalsMoveThemToHistory(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	st.BeginTurn()
+
+	sales := CreateGoal("sales", "sales.recommend_item", 50, now)
+	sales.Slots = map[string]any{"category": "laptop"}
+	support := CreateGoal("support", "support.troubleshoot", 100, now)
+	for _, g := range []*Goal{sales, support} {
+		if err := st.AddGoal(g); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SuspendAndActivate(g.ID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.ArchiveGoal(support.ID, now); err == nil {
+		t.Fatal("expected archiving an open goal to fail")
+	}
+	if err := st.MarkGoalDone(support.ID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	later := now.Add(time.Hour)
+	if err := st.ArchiveGoal(support.ID, later); err != nil {
+		t.Fatalf("ArchiveGoal: %v", err)
+	}
+	if err := st.ExpireGoal(sales.ID, later); err != nil {
+		t.Fatalf("ExpireGoal: %v", err)
+	}
+
+	if len(st.Goals) != 0 || len(st.GoalStack) != 0 || st.ActiveGoalID != "" {
+		t.Fatalf("expected no live goals, got goals=%v stack=%v active=%q", st.Goals, st.GoalStack, st.ActiveGoalID)
+	}
+	if len(st.GoalHistory) != 2 {
+		t.Fatalf("expected two history entries, got %+v", st.GoalHistory)
+	}
+	if h := st.GoalHistory[0]; h.ID != support.ID || h.Status != GoalDone || h.Expired {
+		t.Fatalf("unexpected support entry %+v", h)
+	}
+	if h, ok := st.ArchivedGoal(sales.ID); !ok || h.Status != GoalCancelled || !h.Expired || h.Slots["category"] != "laptop" {
+		t.Fatalf("unexpected sales entry %+v", h)
+	}
+
+	if err := st.TrimGoalHistory(1, later); err != nil {
+		t.Fatalf("TrimGoalHistory: %v", err)
+	}
+	if len(st.GoalHistory) != 1 || st.GoalHistory[0].ID != sales.ID {
+		t.Fatalf("expected only the newest entry kept, got %+v", st.GoalHistory)
+	}
+
+	replayed, err := ReplayGoalEvents(st.PendingEvents())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	want, _ := json.Marshal([]any{st.ActiveGoalID, st.GoalStack, st.Goals, st.GoalHistory})
+	got, _ := json.Marshal([]any{replayed.ActiveGoalID, replayed.GoalStack, replayed.Goals, replayed.GoalHistory})
+	if string(got) != string(want) {
+		t.Fatalf("replay diverged:\n got  %s\n want %s", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrInvalidRewind means the requested turn is outside the session's turns.
+	ErrInvalidRewind = errors.New("invalid rewind turn")
+	// ErrSnapshotNotFound means no retained snapshot predates the requested turn.
+	ErrSnapshotNotFound = errors.New("no snapshot before requested turn")
+)
+
+// SnapshotHistory is implemented by stores that keep prior snapshots of a
+// session (see WithSnapshotHistory).
+type SnapshotHistory interface {
+	// Snapshots returns the retained prior snapshots of a live session, newest
+	// first. The current state is not included.
+	Snapshots(ctx context.Context, sessionID string) ([]*SessionState, error)
+}
+
+// SnapshotBefore picks the newest of snapshots taken before turn beforeTurn of
+// s started, i.e. the state saved at the end of an earlier turn. Rewinding to
+// turn 1 needs no snapshot: the result is an empty goal state.
+func (s *SessionState) SnapshotBefore(snapshots []*SessionState, beforeTurn int) (*SessionState, error) {
+	if err := s.checkRewind(beforeTurn); err != nil {
+		return nil, err
+	}
+	for _, snap := range snapshots {
+		if snap != nil && snap.Turn < beforeTurn {
+			return snap, nil
+		}
+	}
+	if beforeTurn == 1 {
+		return &SessionState{}, nil
+	}
+	return nil, fmt.Errorf("%w: turn %d", ErrSnapshotNotFound, beforeTurn)
+}
+
+// RewindTo restores the goal state of snapshot (Goals, GoalStack and
+// ActiveGoalID) and marks transcript entries from beforeTurn on as rewound.
+// The turn counter, transcript and processed messages are kept so turn numbers
+// stay unique and retried messages are still recognized.
+func (s *SessionState) RewindTo(snapshot *SessionState, beforeTurn int, now time.Time) error {
+	if s == nil || snapshot == nil {
+		return errors.New("nil session state")
+	}
+	if err := s.checkRewind(beforeTurn); err != nil {
+		return err
+	}
+
+	if err := s.emit(GoalEvent{
+		Type:      EventRewound,
+		GoalID:    snapshot.ActiveGoalID,
+		Goals:     cloneGoals(snapshot.Goals),
+		GoalStack: snapshot.GoalStack,
+		RewoundTo: beforeTurn,
+		At:        now,
+	}); err != nil {
+		return err
+	}
+
+	for i := range s.Transcript {
+		if s.Transcript[i].Turn >= beforeTurn {
+			s.Transcript[i].Rewound = true
+		}
+	}
+	s.Touch(now)
+	return nil
+}
+
+func (s *SessionState) checkRewind(beforeTurn int) error {
+	if beforeTurn < 1 || beforeTurn > s.Turn {
+		return fmt.Errorf("%w: turn %d, session is at turn %d", ErrInvalidRewind, beforeTurn, s.Turn)
+	}
+	return nil
+}
+
+// restoreGoals applies a rewound event.
+func (s *SessionState) restoreGoals(e GoalEvent) {
+	s.Goals = cloneGoals(e.Goals)
+	s.EnsureGoalsMap()
+	s.GoalStack = slices.Clone(e.GoalStack)
+	s.ActiveGoalID = e.GoalID
+	// Goals archived after the snapshot are live again.
+	s.GoalHistory = slices.DeleteFunc(s.GoalHistory, func(r GoalHistoryEntry) bool {
+		_, ok := s.Goals[r.ID]
+		return ok
+	})
+}
+
+func cloneGoals(goals map[string]*Goal) map[string]*Goal {
+	out := maps.Clone(goals)
+	for id, g := range out {
+		out[id] = g.clone()
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRewindToReplaysFromEventLog(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	st.BeginTurn()
+	sales := CreateGoal("sales", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(sales); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SuspendAndActivate(sales.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(st)
+	var before *SessionState
+	if err := json.Unmarshal(raw, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	st.BeginTurn()
+	st.AppendTranscript(TranscriptEntry{Turn: st.Turn, Role: TranscriptRoleUser, Text: "เครื่องเปิดไม่ติด"})
+	support := CreateGoal("support", "support.troubleshoot", 80, now)
+	if err := st.AddGoal(support); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SuspendAndActivate(support.ID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.SnapshotBefore([]*SessionState{before}, 3); !errors.Is(err, ErrInvalidRewind) {
+		t.Fatalf("expected ErrInvalidRewind, got %v", err)
+	}
+	snap, err := st.SnapshotBefore([]*SessionState{before}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RewindTo(snap, 2, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if st.ActiveGoalID != sales.ID || len(st.GoalStack) != 1 || st.Goals[sales.ID].Status != GoalActive {
+		t.Fatalf("unexpected rewound state: active=%s stack=%v", st.ActiveGoalID, st.GoalStack)
+	}
+	if !st.Transcript[0].Rewound {
+		t.Fatal("expected turn 2 transcript entry marked rewound")
+	}
+
+	replayed, err := ReplayGoalEvents(st.PendingEvents())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	want, _ := json.Marshal([]any{st.ActiveGoalID, st.GoalStack, st.Goals})
+	got, _ := json.Marshal([]any{replayed.ActiveGoalID, replayed.GoalStack, replayed.Goals})
+	if string(got) != string(want) {
+		t.Fatalf("replay diverged:\n got  %s\n want %s", got, want)
+	}
+}
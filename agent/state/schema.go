@@ -0,0 +1,98 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// CurrentSchemaVersion is the SessionState layout written by this build.
+// Bump it together with a new entry in schemaMigrations.
+const CurrentSchemaVersion = 2
+
+// ErrUnsupportedSchema means a stored session was written by a newer build.
+var ErrUnsupportedSchema = errors.New("unsupported session schema version")
+
+// schemaMigration upgrades a raw session document from version From to From+1.
+// Migrations work on the decoded JSON map so they can read fields that no
+// longer exist on SessionState.
+type schemaMigration struct {
+	From    int
+	Migrate func(doc map[string]any) error
+}
+
+// schemaMigrations is the ordered migration registry; entry i upgrades i -> i+1.
+var schemaMigrations = []schemaMigration{
+	{
+		// v0: documents written before schema_version existed. The layout is
+		// unchanged, so only the version stamp is added.
+		From:    0,
+		Migrate: func(doc map[string]any) error { return nil },
+	},
+	{
+		// v1: goals gain suspended_at. Suspended goals take their updated_at,
+		// the closest record of when they were suspended.
+		From: 1,
+		Migrate: func(doc map[string]any) error {
+			goals, _ := doc["goals"].(map[string]any)
+			for _, raw := range goals {
+				g, ok := raw.(map[string]any)
+				if !ok || g["status"] != string(GoalSuspended) {
+					continue
+				}
+				if _, ok := g["suspended_at"]; !ok {
+					g["suspended_at"] = g["updated_at"]
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// migrateSessionDocument upgrades payload to CurrentSchemaVersion and returns
+// the upgraded payload together with the version it was stored at.
+func migrateSessionDocument(payload []byte) ([]byte, int, error) {
+	var head struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(payload, &head); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal session schema version: %w", err)
+	}
+	from := head.SchemaVersion
+	if from == CurrentSchemaVersion {
+		return payload, from, nil
+	}
+	if from > CurrentSchemaVersion || from < 0 {
+		return nil, from, fmt.Errorf("%w: stored=%d supported=%d", ErrUnsupportedSchema, from, CurrentSchemaVersion)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, from, fmt.Errorf("unmarshal session document: %w", err)
+	}
+	for v := from; v < CurrentSchemaVersion; v++ {
+		m := schemaMigrations[v]
+		if m.From != v {
+			return nil, from, fmt.Errorf("schema migration registry out of order at version %d", v)
+		}
+		if err := m.Migrate(doc); err != nil {
+			return nil, from, fmt.Errorf("migrate session schema %d -> %d: %w", v, v+1, err)
+		}
+		doc["schema_version"] = v + 1
+	}
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, from, fmt.Errorf("marshal migrated session: %w", err)
+	}
+	return upgraded, from, nil
+}
+
+// LoadedSchemaVersion is the schema version the session had in the store before
+// Load migrated it. It is CurrentSchemaVersion for sessions created in memory.
+func (s *SessionState) LoadedSchemaVersion() int {
+	if s.loadedSchemaVersion == nil {
+		return CurrentSchemaVersion
+	}
+	return *s.loadedSchemaVersion
+}
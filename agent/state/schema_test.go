@@ -0,0 +1,100 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// v0Payload is a session document written before schema_version existed.
+const v0Payload = `{"session_id":"s-%s","workspace_id":"w","customer_id":"c","channel_type":"web","goals":{},"version":3,"updated_at":"2025-01-01T00:00:00Z"}`
+
+func TestDecodeSessionStateMigratesUnversionedDocument(t *testing.T) {
+	st, err := decodeSessionState([]byte(`{"session_id":"s1","goals":{},"version":3}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if st.SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("expected schema %d, got %d", CurrentSchemaVersion, st.SchemaVersion)
+	}
+	if st.LoadedSchemaVersion() != 0 {
+		t.Fatalf("expected loaded schema 0, got %d", st.LoadedSchemaVersion())
+	}
+	if st.Version != 3 {
+		t.Fatalf("expected version 3 to survive migration, got %d", st.Version)
+	}
+}
+
+func TestDecodeSessionStateRejectsNewerSchema(t *testing.T) {
+	_, err := decodeSessionState([]byte(`{"schema_version":999,"session_id":"s1","goals":{}}`))
+	if !errors.Is(err, ErrUnsupportedSchema) {
+		t.Fatalf("expected ErrUnsupportedSchema, got %v", err)
+	}
+}
+
+func TestSchemaMigrationRegistryIsComplete(t *testing.T) {
+	if len(schemaMigrations) != CurrentSchemaVersion {
+		t.Fatalf("expected %d migrations, got %d", CurrentSchemaVersion, len(schemaMigrations))
+	}
+	for i, m := range schemaMigrations {
+		if m.From != i || m.Migrate == nil {
+			t.Fatalf("migration %d is out of order or empty", i)
+		}
+	}
+}
+
+func TestUpgradeSessionsRewritesOldDocuments(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemoryStore()
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		store.sessions["s-"+id] = memoryRecord{payload: []byte(fmt.Sprintf(v0Payload, id)), version: 3}
+	}
+	current := NewSessionState("s-current", "w", "c", "web", store.now())
+	if err := store.Save(ctx, current); err != nil {
+		t.Fatalf("save current: %v", err)
+	}
+
+	report, err := UpgradeSessions(ctx, store)
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if report.Scanned != 3 || report.Upgraded != 2 || len(report.Failed) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	got, err := store.Load(ctx, "s-a")
+	if err != nil {
+		t.Fatalf("load upgraded: %v", err)
+	}
+	if got.LoadedSchemaVersion() != CurrentSchemaVersion || got.Version != 4 {
+		t.Fatalf("expected stored schema %d at version 4, got schema %d version %d",
+			CurrentSchemaVersion, got.LoadedSchemaVersion(), got.Version)
+	}
+
+	report, err = UpgradeSessions(ctx, store)
+	if err != nil {
+		t.Fatalf("second upgrade: %v", err)
+	}
+	if report.Upgraded != 0 {
+		t.Fatalf("expected second run to be a no-op, got %+v", report)
+	}
+}
+
+func TestDecodeSessionStateBackfillsSuspendedAt(t *testing.T) {
+	st, err := decodeSessionState([]byte(`{"schema_version":1,"session_id":"s1","goals":{` +
+		`"g1":{"id":"g1","status":"suspended","updated_at":"2025-01-01T10:00:00Z"},` +
+		`"g2":{"id":"g2","status":"active","updated_at":"2025-01-01T11:00:00Z"}}}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := st.Goals["g1"].SuspendedAt; !got.Equal(st.Goals["g1"].UpdatedAt) {
+		t.Fatalf("expected suspended goal to take its updated_at, got %v", got)
+	}
+	if got := st.Goals["g2"].SuspendedAt; !got.IsZero() {
+		t.Fatalf("expected active goal without suspended_at, got %v", got)
+	}
+}
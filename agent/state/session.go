@@ -3,13 +3,19 @@ package state
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
 // SessionState is the persistent source-of-truth for ATOD-style workflow control.
-// - Interleaving: ActiveGoalID + GoalStack + GoalStatus (suspended/active/done)
-// - Dependency: Goal.Missing + Goal.NextQuestion + GoalStatus (blocked)
+// - Interleaving: ActiveGoalID + GoalStack + GoalStatus (suspended/active/done/cancelled)
+// - Dependency: Goal.Missing + Goal.NextQuestion + GoalStatus (blocked), Goal.DependsOn (prerequisite goals)
+// - Context: Turn + Transcript (recent user/assistant history) + ConversationSummary (older turns)
+// - History: EventSeq + the goal event log persisted alongside each snapshot + GoalHistory (archived goals)
 type SessionState struct {
+	SchemaVersion int `json:"schema_version"`
+
 	// Identity
 	SessionID   string `json:"session_id"`
 	WorkspaceID string `json:"workspace_id"`
@@ -17,11 +23,36 @@ type SessionState struct {
 	ChannelType string `json:"channel_type"`
 
 	// ATOD core
-	ActiveGoalID string           `json:"active_goal_id,omitempty"`
-	GoalStack    []string         `json:"goal_stack,omitempty"` // LIFO: suspend/resume
-	Goals        map[string]*Goal `json:"goals,omitempty"`      // goal_id -> goal
+	ActiveGoalID string             `json:"active_goal_id,omitempty"`
+	GoalStack    []string           `json:"goal_stack,omitempty"`   // LIFO: suspend/resume
+	Goals        map[string]*Goal   `json:"goals,omitempty"`        // goal_id -> goal
+	GoalHistory  []GoalHistoryEntry `json:"goal_history,omitempty"` // archived goals, oldest first
+
+	// Conversation
+	Turn                int               `json:"turn,omitempty"`
+	Transcript          []TranscriptEntry `json:"transcript,omitempty"`
+	ConversationSummary string            `json:"conversation_summary,omitempty"`
+
+	// Idempotency
+	ProcessedMessages []ProcessedMessage `json:"processed_messages,omitempty"`
 
+	// EventSeq is the Seq of the last goal event applied to this state.
+	EventSeq int64 `json:"event_seq,omitempty"`
+
+	// Version is the revision this state was loaded at; stores use it for
+	// compare-and-set saves and bump it on every successful Save.
+	Version   int64     `json:"version"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// FencingToken is the highest lease token a save of this session carried
+	// (see WithFencingToken); saves carrying a lower one fail with ErrLeaseLost.
+	FencingToken int64 `json:"fencing_token,omitempty"`
+
+	// loadedSchemaVersion is set by stores when decoding; see LoadedSchemaVersion.
+	loadedSchemaVersion *int
+	// pendingEvents are goal events not yet persisted; see PendingEvents.
+	pendingEvents []GoalEvent
+	// machine checks status changes; nil means the default GoalMachine.
+	machine *GoalMachine
 }
 
 type GoalStatus string
@@ -31,17 +62,66 @@ const (
 	GoalBlocked   GoalStatus = "blocked"
 	GoalSuspended GoalStatus = "suspended"
 	GoalDone      GoalStatus = "done"
+	// GoalCancelled is a goal the customer dropped; unlike done it does not
+	// count as completed.
+	GoalCancelled GoalStatus = "cancelled"
 )
 
 type Goal struct {
 	ID           string         `json:"id"`
 	Type         string         `json:"type"`     // "sales.recommend_item" | "support.troubleshoot" | etc.
-	Status       GoalStatus     `json:"status"`   // active/blocked/suspended/done
+	Status       GoalStatus     `json:"status"`   // active/blocked/suspended/done/cancelled
 	Priority     int            `json:"priority"` // higher wins
 	Slots        map[string]any `json:"slots,omitempty"`
 	Missing      []string       `json:"missing,omitempty"`
 	NextQuestion string         `json:"next_question,omitempty"`
 	UpdatedAt    time.Time      `json:"updated_at"`
+
+	// SlotMeta describes how slot values were obtained, keyed by slot name.
+	SlotMeta map[string]SlotMeta `json:"slot_meta,omitempty"`
+	// PendingConfirm lists slots whose captured values the customer still has
+	// to confirm; while it is non-empty the goal is in its confirm sub-state.
+	PendingConfirm []string `json:"pending_confirm,omitempty"`
+	// DependsOn lists goals that must be done before this goal can become
+	// active. A goal waiting for them is kept suspended and off the stack.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// SuspendedAt is when the goal was last suspended. Unlike UpdatedAt it is
+	// not moved by slot or priority changes, and it is zero unless the goal is
+	// suspended.
+	SuspendedAt time.Time `json:"suspended_at,omitzero"`
+}
+
+// SlotMeta is kept next to a slot value: where it came from and when.
+type SlotMeta struct {
+	Source SlotSource `json:"source,omitempty"`
+	// Turn and At are the session turn and time the value was set.
+	Turn int       `json:"turn,omitempty"`
+	At   time.Time `json:"at"`
+	// Confidence in [0, 1], when the source reported one.
+	Confidence *float64 `json:"confidence,omitempty"`
+	// Raw is the text the value was normalized from, e.g. "35k" for 35000.
+	Raw string `json:"raw,omitempty"`
+}
+
+// SlotSource says where a slot value came from.
+type SlotSource string
+
+const (
+	SlotSourceUser       SlotSource = "user"       // stated by the customer
+	SlotSourceMemory     SlotSource = "memory"     // taken from the memory summary
+	SlotSourcePlanner    SlotSource = "planner"    // inferred by the planner
+	SlotSourceTool       SlotSource = "tool"       // returned by a tool
+	SlotSourceSpecialist SlotSource = "specialist" // set by a specialist
+)
+
+// Valid reports whether src is one of the known sources.
+func (src SlotSource) Valid() bool {
+	switch src {
+	case SlotSourceUser, SlotSourceMemory, SlotSourcePlanner, SlotSourceTool, SlotSourceSpecialist:
+		return true
+	default:
+		return false
+	}
 }
 
 /* ----------------------------- Goal helpers ----------------------------- */
@@ -54,6 +134,20 @@ func (g *Goal) IsDone() bool {
 	return g != nil && g.Status == GoalDone
 }
 
+// IsConfirming reports whether g waits for the customer to confirm slot values.
+func (g *Goal) IsConfirming() bool {
+	return g != nil && len(g.PendingConfirm) > 0
+}
+
+func (g *Goal) IsCancelled() bool {
+	return g != nil && g.Status == GoalCancelled
+}
+
+// IsClosed reports whether g is done or cancelled and can no longer change status.
+func (g *Goal) IsClosed() bool {
+	return g.IsDone() || g.IsCancelled()
+}
+
 func (g *Goal) SetSlot(key string, val any) {
 	if g.Slots == nil {
 		g.Slots = make(map[string]any, 8)
@@ -61,30 +155,11 @@ func (g *Goal) SetSlot(key string, val any) {
 	g.Slots[key] = val
 }
 
-func (g *Goal) SetMissing(missing []string, nextQuestion string) {
-	g.Missing = missing
-
-	// don't override terminal/paused states
-	if g.Status == GoalDone || g.Status == GoalSuspended {
-		// still keep NextQuestion coherent if you want
-		if len(missing) == 0 {
-			g.NextQuestion = ""
-		} else {
-			g.NextQuestion = nextQuestion
-		}
-		return
+func (g *Goal) setSlotMeta(key string, m SlotMeta) {
+	if g.SlotMeta == nil {
+		g.SlotMeta = make(map[string]SlotMeta, 4)
 	}
-
-	if len(missing) == 0 {
-		if g.Status == GoalBlocked {
-			g.Status = GoalActive
-		}
-		g.NextQuestion = ""
-		return
-	}
-
-	g.Status = GoalBlocked
-	g.NextQuestion = nextQuestion
+	g.SlotMeta[key] = m
 }
 
 /* -------------------------- SessionState helpers ------------------------- */
@@ -99,12 +174,13 @@ var (
 
 func NewSessionState(sessionID, workspaceID, customerID, channelType string, now time.Time) *SessionState {
 	return &SessionState{
-		SessionID:   sessionID,
-		WorkspaceID: workspaceID,
-		CustomerID:  customerID,
-		ChannelType: channelType,
-		Goals:       make(map[string]*Goal, 4),
-		UpdatedAt:   now.UTC(),
+		SchemaVersion: CurrentSchemaVersion,
+		SessionID:     sessionID,
+		WorkspaceID:   workspaceID,
+		CustomerID:    customerID,
+		ChannelType:   channelType,
+		Goals:         make(map[string]*Goal, 4),
+		UpdatedAt:     now.UTC(),
 	}
 }
 
@@ -144,9 +220,115 @@ func (s *SessionState) AddGoal(g *Goal) error {
 	if g == nil || g.ID == "" {
 		return ErrNilGoalID
 	}
-	s.EnsureGoalsMap()
-	s.Goals[g.ID] = g
-	return nil
+	return s.emit(GoalEvent{Type: EventGoalCreated, GoalID: g.ID, Goal: g, At: g.UpdatedAt})
+}
+
+// PatchSlots merges patch into the goal's slots.
+func (s *SessionState) PatchSlots(goalID string, patch map[string]any, now time.Time) error {
+	return s.PatchSlotsWithMeta(goalID, patch, nil, now)
+}
+
+// PatchSlotsWithMeta merges patch into the goal's slots and records meta for
+// every patched slot, stamped with the current turn and now. A patched slot
+// without an entry in meta keeps only the turn and time.
+func (s *SessionState) PatchSlotsWithMeta(goalID string, patch map[string]any, meta map[string]SlotMeta, now time.Time) error {
+	if _, err := s.mustGoal(goalID); err != nil {
+		return err
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+	stamped := make(map[string]SlotMeta, len(patch))
+	for k := range patch {
+		m := meta[k]
+		m.Turn, m.At = s.Turn, now.UTC()
+		stamped[k] = m
+	}
+	return s.emit(GoalEvent{Type: EventSlotsPatched, GoalID: goalID, Slots: patch, SlotMeta: stamped, At: now})
+}
+
+// SetGoalMissing records a goal's missing slots: the goal becomes blocked while
+// slots are missing and active again once they are filled; suspended and closed
+// goals keep their status. The status change is checked against the session's
+// GoalMachine before anything is recorded, and a move it refuses returns
+// ErrInvalidTransition with the goal left as it was.
+func (s *SessionState) SetGoalMissing(goalID string, missing []string, nextQuestion string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	next := *g
+	next.Missing = missing
+	next.NextQuestion = ""
+	if len(missing) > 0 {
+		next.NextQuestion = nextQuestion
+	}
+	to := missingStatus(g.Status, missing)
+	if err := s.goalMachine().Check(&next, to); err != nil {
+		return err
+	}
+
+	if !slices.Equal(next.Missing, g.Missing) || next.NextQuestion != g.NextQuestion {
+		if err := s.emit(GoalEvent{
+			Type:         EventMissingSet,
+			GoalID:       goalID,
+			Missing:      next.Missing,
+			NextQuestion: next.NextQuestion,
+			At:           now,
+		}); err != nil {
+			return err
+		}
+	}
+	return s.transition(g, to, now)
+}
+
+// SetGoalPendingConfirm replaces the slots of a goal that wait for the
+// customer's confirmation. It does not change the goal's status.
+func (s *SessionState) SetGoalPendingConfirm(goalID string, slots []string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(g.PendingConfirm, slots) {
+		return nil
+	}
+	return s.emit(GoalEvent{Type: EventConfirmSet, GoalID: goalID, Confirm: slots, At: now})
+}
+
+// SetGoalStatus moves a goal to status through the session's GoalMachine and
+// returns ErrInvalidTransition for moves it does not allow. It does not touch
+// the stack; use SuspendAndActivate, MarkGoalDone or ResumePrevious for
+// workflow transitions.
+func (s *SessionState) SetGoalStatus(goalID string, status GoalStatus, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	return s.transition(g, status, now)
+}
+
+// SetGoalPriority changes a goal's priority.
+func (s *SessionState) SetGoalPriority(goalID string, priority int, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if g.Priority == priority {
+		return nil
+	}
+	return s.emit(GoalEvent{Type: EventPriorityChanged, GoalID: goalID, Priority: priority, At: now})
+}
+
+// SetGoalType changes a goal's type.
+func (s *SessionState) SetGoalType(goalID, goalType string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if g.Type == goalType {
+		return nil
+	}
+	return s.emit(GoalEvent{Type: EventTypeChanged, GoalID: goalID, GoalType: goalType, At: now})
 }
 
 // PushGoal pushes a goal onto the GoalStack (LIFO). Does not change statuses.
@@ -158,17 +340,18 @@ func (s *SessionState) PushGoal(goalID string) error {
 	if goalID == "" {
 		return ErrNilGoalID
 	}
-	s.GoalStack = append(s.GoalStack, goalID)
-	return nil
+	return s.emit(GoalEvent{Type: EventGoalPushed, GoalID: goalID, At: s.UpdatedAt})
 }
 
 // PopGoal pops from GoalStack (LIFO).
 func (s *SessionState) PopGoal() (string, bool) {
-	if s == nil || len(s.GoalStack) == 0 {
+	last, ok := s.PeekGoal()
+	if !ok {
+		return "", false
+	}
+	if err := s.emit(GoalEvent{Type: EventGoalPopped, GoalID: last, At: s.UpdatedAt}); err != nil {
 		return "", false
 	}
-	last := s.GoalStack[len(s.GoalStack)-1]
-	s.GoalStack = s.GoalStack[:len(s.GoalStack)-1]
 	return last, true
 }
 
@@ -192,25 +375,30 @@ func (s *SessionState) SetActiveGoal(goalID string) error {
 	if _, ok := s.GetGoal(goalID); !ok {
 		return fmt.Errorf("%w: %s", ErrGoalNotFound, goalID)
 	}
-	s.ActiveGoalID = goalID
-	// Ensure stack has at least the active goal
-	if len(s.GoalStack) == 0 {
-		s.GoalStack = []string{goalID}
-		return nil
+	return s.activate(goalID, s.UpdatedAt)
+}
+
+// activate makes goalID the active goal and pushes it unless it is already on
+// top of the stack.
+func (s *SessionState) activate(goalID string, now time.Time) error {
+	if top, ok := s.PeekGoal(); !ok || top != goalID {
+		if err := s.emit(GoalEvent{Type: EventGoalPushed, GoalID: goalID, At: now}); err != nil {
+			return err
+		}
 	}
-	// Optional: align top with active goal (do not mutate deeper stack)
-	top, _ := s.PeekGoal()
-	if top != goalID {
-		s.GoalStack = append(s.GoalStack, goalID)
+	if s.ActiveGoalID == goalID {
+		return nil
 	}
-	return nil
+	return s.emit(GoalEvent{Type: EventActiveChanged, GoalID: goalID, At: now})
 }
 
 // SuspendAndActivate performs an interleaving transition:
-// - Current active goal -> suspended (if exists and not done)
+// - Current active goal -> suspended (if exists and not done/cancelled)
 // - Push new goal id on stack
 // - Set ActiveGoalID = new goal, new goal -> active (if not blocked/done)
 // NOTE: If new goal is blocked, we keep it blocked; active goal can be blocked too.
+// Activating a done or cancelled goal, or one still waiting for a goal it
+// depends on, returns ErrInvalidTransition.
 func (s *SessionState) SuspendAndActivate(newGoalID string, now time.Time) error {
 	if s == nil {
 		return errors.New("nil session state")
@@ -222,45 +410,124 @@ func (s *SessionState) SuspendAndActivate(newGoalID string, now time.Time) error
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrGoalNotFound, newGoalID)
 	}
-	if newGoal.Status == GoalDone {
-		return fmt.Errorf("%w: cannot activate done goal %s", ErrInvalidTransition, newGoalID)
+	if !s.goalMachine().CanTransition(newGoal.Status, GoalActive) {
+		return fmt.Errorf("%w: cannot activate %s goal %s", ErrInvalidTransition, newGoal.Status, newGoalID)
+	}
+	if err := s.checkReady(newGoal); err != nil {
+		return err
 	}
 
-	// Suspend current active goal (if any)
-	if cur := s.ActiveGoal(); cur != nil && cur.ID != newGoalID {
-		// Only suspend if not done
-		if cur.Status != GoalDone {
-			cur.Status = GoalSuspended
-			cur.UpdatedAt = now.UTC()
+	// Suspend current active goal (if any), unless it is closed
+	if cur := s.ActiveGoal(); cur != nil && cur.ID != newGoalID && !cur.IsClosed() {
+		if err := s.SetGoalStatus(cur.ID, GoalSuspended, now); err != nil {
+			return err
 		}
 	}
 
-	// Activate new goal (unless blocked/done already)
-	if newGoal.Status == "" {
-		newGoal.Status = GoalActive
+	// Activate new goal (unless blocked); resuming a suspended goal explicitly
+	// makes it active
+	if newGoal.Status == "" || newGoal.Status == GoalSuspended {
+		if err := s.transition(newGoal, GoalActive, now); err != nil {
+			return err
+		}
 	}
-	if newGoal.Status == GoalSuspended {
-		// resuming a suspended goal explicitly -> make it active
-		newGoal.Status = GoalActive
+
+	// Stack + active (no back-to-back duplicates on the stack)
+	if err := s.activate(newGoalID, now); err != nil {
+		return err
+	}
+	s.Touch(now)
+	return nil
+}
+
+// SwitchToGoal brings any open goal back to the top of the stack, whether or
+// not it is the one directly underneath the active goal:
+// - Current active goal -> suspended (if exists and not done/cancelled)
+// - Goal is moved from wherever it sits in GoalStack to the top
+// - Goal becomes active; a suspended goal turns active, a blocked one stays blocked
+// Switching to a done or cancelled goal, or one still waiting for a goal it
+// depends on, returns ErrInvalidTransition.
+func (s *SessionState) SwitchToGoal(goalID string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if g.IsClosed() {
+		return fmt.Errorf("%w: cannot switch to %s goal %s", ErrInvalidTransition, g.Status, goalID)
+	}
+	if err := s.checkReady(g); err != nil {
+		return err
+	}
+	if s.ActiveGoalID == goalID {
+		if top, ok := s.PeekGoal(); ok && top == goalID {
+			return nil
+		}
 	}
-	newGoal.UpdatedAt = now.UTC()
 
-	// Stack + active
-	s.ActiveGoalID = newGoalID
-	if len(s.GoalStack) == 0 {
-		s.GoalStack = []string{newGoalID}
-	} else {
-		// Ensure we don't push duplicates back-to-back
-		top, _ := s.PeekGoal()
-		if top != newGoalID {
-			s.GoalStack = append(s.GoalStack, newGoalID)
+	if cur := s.ActiveGoal(); cur != nil && cur.ID != goalID && !cur.IsClosed() {
+		if err := s.transition(cur, GoalSuspended, now); err != nil {
+			return err
 		}
 	}
+	if g.Status == "" || g.Status == GoalSuspended {
+		if err := s.transition(g, GoalActive, now); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(s.GoalStack, goalID) {
+		if err := s.emit(GoalEvent{Type: EventGoalRemoved, GoalID: goalID, At: now}); err != nil {
+			return err
+		}
+	}
+	if err := s.activate(goalID, now); err != nil {
+		return err
+	}
 	s.Touch(now)
 	return nil
 }
 
-// MarkGoalDone marks a goal done. If it is the active goal, it will also resume previous goal (if any).
+// QueueGoal puts an open goal directly underneath the active goal, so it is
+// resumed as soon as the active goal is done. The goal is suspended and moved
+// there from wherever it sits in GoalStack. Queueing the active goal, a done or
+// cancelled goal, or one still waiting for a goal it depends on returns
+// ErrInvalidTransition; without an active goal on top of the stack it returns
+// ErrNoActiveGoal.
+func (s *SessionState) QueueGoal(goalID string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if g.IsClosed() || goalID == s.ActiveGoalID {
+		return fmt.Errorf("%w: cannot queue %s goal %s", ErrInvalidTransition, g.Status, goalID)
+	}
+	if err := s.checkReady(g); err != nil {
+		return err
+	}
+	if top, ok := s.PeekGoal(); !ok || top != s.ActiveGoalID {
+		return ErrNoActiveGoal
+	}
+
+	if g.Status != GoalSuspended {
+		if err := s.transition(g, GoalSuspended, now); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(s.GoalStack, goalID) {
+		if err := s.emit(GoalEvent{Type: EventGoalRemoved, GoalID: goalID, At: now}); err != nil {
+			return err
+		}
+	}
+	if err := s.emit(GoalEvent{Type: EventGoalQueued, GoalID: goalID, At: now}); err != nil {
+		return err
+	}
+	s.Touch(now)
+	return nil
+}
+
+// MarkGoalDone marks a goal done. If it is the active goal, the goal that waited
+// for it is started next; without one the previous goal is resumed (if any). A
+// goal still waiting for slots to be confirmed cannot be done yet; that fails
+// with ErrInvalidTransition.
 func (s *SessionState) MarkGoalDone(goalID string, now time.Time) error {
 	if s == nil {
 		return errors.New("nil session state")
@@ -272,14 +539,37 @@ func (s *SessionState) MarkGoalDone(goalID string, now time.Time) error {
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrGoalNotFound, goalID)
 	}
-	g.Status = GoalDone
-	g.NextQuestion = ""
-	g.Missing = nil
-	g.UpdatedAt = now.UTC()
+	if g.IsConfirming() {
+		return fmt.Errorf("%w: goal %s is waiting for confirmation of %s", ErrInvalidTransition, goalID, strings.Join(g.PendingConfirm, ", "))
+	}
+	next := *g
+	next.Missing, next.NextQuestion = nil, ""
+	if err := s.goalMachine().Check(&next, GoalDone); err != nil {
+		return err
+	}
+	if len(g.Missing) > 0 || g.NextQuestion != "" {
+		if err := s.emit(GoalEvent{Type: EventMissingSet, GoalID: goalID, At: now}); err != nil {
+			return err
+		}
+	}
+	if err := s.SetGoalStatus(goalID, GoalDone, now); err != nil {
+		return err
+	}
 
-	// If this is active, try to resume previous goal.
+	// If this is active, start a goal that waited for it or resume the previous goal.
 	if s.ActiveGoalID == goalID {
-		_, _ = s.ResumePrevious(now) // ignore "nothing to resume"
+		if next := s.readyDependent(goalID); next != nil {
+			if top, ok := s.PeekGoal(); ok && top == goalID {
+				if err := s.emit(GoalEvent{Type: EventGoalPopped, GoalID: top, At: now}); err != nil {
+					return err
+				}
+			}
+			if err := s.SwitchToGoal(next.ID, now); err != nil {
+				return err
+			}
+		} else {
+			_, _ = s.ResumePrevious(now) // ignore "nothing to resume"
+		}
 	}
 	s.Touch(now)
 	return nil
@@ -299,36 +589,97 @@ func (s *SessionState) ResumePrevious(now time.Time) (string, bool) {
 	// If stack top is active goal, pop it.
 	top, _ := s.PeekGoal()
 	if s.ActiveGoalID != "" && top == s.ActiveGoalID {
-		_, _ = s.PopGoal()
+		_ = s.emit(GoalEvent{Type: EventGoalPopped, GoalID: top, At: now})
 	}
+	return s.resumeTop(now)
+}
 
-	// Now resume new top.
-	prevID, ok := s.PeekGoal()
-	if !ok {
-		s.ActiveGoalID = ""
-		s.Touch(now)
-		return "", false
+// CancelGoal drops a goal the customer no longer wants. The goal becomes
+// cancelled and is removed from GoalStack wherever it sits; if it was the
+// active goal, the goal now on top of the stack is resumed as ResumePrevious
+// would. Goals that waited for it stop waiting and stay suspended until the
+// planner picks them up. Cancelling a done goal returns ErrInvalidTransition.
+func (s *SessionState) CancelGoal(goalID string, now time.Time) error {
+	g, err := s.mustGoal(goalID)
+	if err != nil {
+		return err
+	}
+	if err := s.transition(g, GoalCancelled, now); err != nil {
+		return err
+	}
+	if err := s.releaseDependents(goalID, now); err != nil {
+		return err
+	}
+	if slices.Contains(s.GoalStack, goalID) {
+		if err := s.emit(GoalEvent{Type: EventGoalRemoved, GoalID: goalID, At: now}); err != nil {
+			return err
+		}
 	}
+	if s.ActiveGoalID == goalID {
+		_, _ = s.resumeTop(now) // ignore "nothing to resume"
+	}
+	s.Touch(now)
+	return nil
+}
 
-	prevGoal, ok := s.GetGoal(prevID)
+// resumeTop makes the goal on top of the stack active, turning it from
+// suspended to active. Goals on top that still wait for a dependency are taken
+// off the stack; they start once their prerequisites are done. An empty stack,
+// or one referring to a missing goal (stack corruption), leaves no active goal.
+func (s *SessionState) resumeTop(now time.Time) (string, bool) {
+	prevID, ok := s.PeekGoal()
+	for ok && s.IsWaiting(s.Goals[prevID]) {
+		if err := s.emit(GoalEvent{Type: EventGoalRemoved, GoalID: prevID, At: now}); err != nil {
+			return "", false
+		}
+		prevID, ok = s.PeekGoal()
+	}
+	if ok {
+		_, ok = s.GetGoal(prevID)
+	}
 	if !ok {
-		// Stack corruption: refers to missing goal.
-		s.ActiveGoalID = ""
+		if s.ActiveGoalID != "" {
+			_ = s.emit(GoalEvent{Type: EventActiveChanged, At: now})
+		}
 		s.Touch(now)
 		return "", false
 	}
 
 	// Only change status if it was suspended. If blocked, keep blocked.
-	if prevGoal.Status == GoalSuspended {
-		prevGoal.Status = GoalActive
+	if prevGoal := s.Goals[prevID]; prevGoal.Status == GoalSuspended {
+		if err := s.transition(prevGoal, GoalActive, now); err != nil {
+			return "", false
+		}
+	}
+	if err := s.emit(GoalEvent{Type: EventGoalResumed, GoalID: prevID, At: now}); err != nil {
+		return "", false
 	}
-	prevGoal.UpdatedAt = now.UTC()
-
-	s.ActiveGoalID = prevID
 	s.Touch(now)
 	return prevID, true
 }
 
+// checkReady returns ErrInvalidTransition while g waits for a goal it depends on.
+func (s *SessionState) checkReady(g *Goal) error {
+	if pending := s.PendingDependencies(g); len(pending) > 0 {
+		return fmt.Errorf("%w: goal %s waits for %s", ErrInvalidTransition, g.ID, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+func (s *SessionState) mustGoal(goalID string) (*Goal, error) {
+	if s == nil {
+		return nil, errors.New("nil session state")
+	}
+	if goalID == "" {
+		return nil, ErrNilGoalID
+	}
+	g, ok := s.GetGoal(goalID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrGoalNotFound, goalID)
+	}
+	return g, nil
+}
+
 func (s *SessionState) Validate() error {
 	if s.Goals == nil {
 		return nil
@@ -351,6 +702,17 @@ func (s *SessionState) Validate() error {
 			return fmt.Errorf("blocked goal %s must have missing and next_question", g.ID)
 		}
 	}
+	// dependencies must exist and must not form a cycle
+	for _, g := range s.Goals {
+		for _, id := range g.DependsOn {
+			if !s.knownGoal(id) {
+				return fmt.Errorf("%w: goal %s depends on missing goal_id=%s", ErrGoalNotFound, g.ID, id)
+			}
+		}
+	}
+	if cycle := dependencyCycle(s.Goals, "", nil); cycle != nil {
+		return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
 	return nil
 }
 
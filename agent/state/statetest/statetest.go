@@ -0,0 +1,506 @@
+// Package statetest provides a conformance suite that every state.Store
+// implementation is expected to pass.
+package statetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+)
+
+// Factory returns a fresh, empty store whose sessions expire after ttl (0 = never),
+// built with opts in addition to the factory's own options.
+type Factory func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store
+
+// ExpiryTTL is the ttl used by the expiry case. One second is the smallest TTL
+// Redis-backed stores can express.
+const ExpiryTTL = time.Second
+
+var sessionSeq atomic.Int64
+
+// RunStoreSuite runs the Store contract against stores built by newStore.
+func RunStoreSuite(t *testing.T, newStore Factory) {
+	t.Helper()
+
+	t.Run("LoadMissing", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		if _, err := store.Load(context.Background(), newSessionID()); !errors.Is(err, statex.ErrStateNotFound) {
+			t.Fatalf("Load() error = %v, want ErrStateNotFound", err)
+		}
+	})
+
+	t.Run("RejectsInvalidInput", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		ctx := context.Background()
+		if _, err := store.Load(ctx, "  "); !errors.Is(err, statex.ErrInvalidSession) {
+			t.Fatalf("Load(blank) error = %v, want ErrInvalidSession", err)
+		}
+		if err := store.Save(ctx, nil); !errors.Is(err, statex.ErrNilSessionState) {
+			t.Fatalf("Save(nil) error = %v, want ErrNilSessionState", err)
+		}
+		if err := store.Save(ctx, &statex.SessionState{}); !errors.Is(err, statex.ErrInvalidSession) {
+			t.Fatalf("Save(blank id) error = %v, want ErrInvalidSession", err)
+		}
+		if err := store.Delete(ctx, ""); !errors.Is(err, statex.ErrInvalidSession) {
+			t.Fatalf("Delete(blank) error = %v, want ErrInvalidSession", err)
+		}
+	})
+
+	t.Run("SaveLoadRoundTrip", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		ctx := context.Background()
+		st := sampleState(t)
+
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if st.Version != 1 {
+			t.Fatalf("Version after first Save = %d, want 1", st.Version)
+		}
+
+		got, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if got.Version != 1 || got.ActiveGoalID != st.ActiveGoalID || got.CustomerID != st.CustomerID {
+			t.Fatalf("unexpected loaded state: %+v", got)
+		}
+		goal, ok := got.Goals[st.ActiveGoalID]
+		if !ok || goal.Slots["budget"] != "35000" {
+			t.Fatalf("goal not round-tripped: %+v", got.Goals)
+		}
+		if len(got.Transcript) != 1 || got.Transcript[0].Text != st.Transcript[0].Text {
+			t.Fatalf("transcript not round-tripped: %+v", got.Transcript)
+		}
+	})
+
+	t.Run("VersionConflict", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		a, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load(a) error = %v", err)
+		}
+		b, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load(b) error = %v", err)
+		}
+
+		if err := store.Save(ctx, a); err != nil {
+			t.Fatalf("Save(a) error = %v", err)
+		}
+		if err := store.Save(ctx, b); !errors.Is(err, statex.ErrVersionConflict) {
+			t.Fatalf("Save(stale) error = %v, want ErrVersionConflict", err)
+		}
+		if b.Version != 1 {
+			t.Fatalf("stale Version changed to %d after conflict", b.Version)
+		}
+
+		fresh := statex.NewSessionState(st.SessionID, "ws", "cust", "chat", time.Now())
+		if err := store.Save(ctx, fresh); !errors.Is(err, statex.ErrVersionConflict) {
+			t.Fatalf("Save(new over existing) error = %v, want ErrVersionConflict", err)
+		}
+	})
+
+	t.Run("FencingToken", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(statex.WithFencingToken(ctx, 5), st); err != nil {
+			t.Fatalf("Save(token 5) error = %v", err)
+		}
+
+		stale, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load(stale) error = %v", err)
+		}
+		newer, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load(newer) error = %v", err)
+		}
+		if err := store.Save(statex.WithFencingToken(ctx, 7), newer); err != nil {
+			t.Fatalf("Save(token 7) error = %v", err)
+		}
+		if err := store.Save(statex.WithFencingToken(ctx, 5), stale); !errors.Is(err, statex.ErrLeaseLost) {
+			t.Fatalf("Save(token 5 after 7) error = %v, want ErrLeaseLost", err)
+		}
+
+		reloaded, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if reloaded.FencingToken != 7 {
+			t.Fatalf("FencingToken = %d, want 7", reloaded.FencingToken)
+		}
+		if err := store.Save(statex.WithFencingToken(ctx, 6), reloaded); !errors.Is(err, statex.ErrLeaseLost) {
+			t.Fatalf("Save(token 6 on fresh state) error = %v, want ErrLeaseLost", err)
+		}
+		// Unfenced saves still go through and keep the token.
+		if err := store.Save(ctx, reloaded); err != nil {
+			t.Fatalf("Save(unfenced) error = %v", err)
+		}
+		if reloaded, err = store.Load(ctx, st.SessionID); err != nil || reloaded.FencingToken != 7 {
+			t.Fatalf("Load() = %+v, %v, want FencingToken 7", reloaded, err)
+		}
+	})
+
+	t.Run("ConcurrentSavesOneWins", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		const writers = 8
+		var (
+			wg        sync.WaitGroup
+			wins      atomic.Int64
+			conflicts atomic.Int64
+		)
+		loaded := make([]*statex.SessionState, writers)
+		for i := range loaded {
+			var err error
+			if loaded[i], err = store.Load(ctx, st.SessionID); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+		}
+		for _, loaded := range loaded {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := store.Save(ctx, loaded)
+				switch {
+				case err == nil:
+					wins.Add(1)
+				case errors.Is(err, statex.ErrVersionConflict):
+					conflicts.Add(1)
+				default:
+					t.Errorf("Save() error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if wins.Load() != 1 || conflicts.Load() != writers-1 {
+			t.Fatalf("wins=%d conflicts=%d, want 1 and %d", wins.Load(), conflicts.Load(), writers-1)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if err := store.Delete(ctx, st.SessionID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := store.Load(ctx, st.SessionID); !errors.Is(err, statex.ErrStateNotFound) {
+			t.Fatalf("Load() after Delete error = %v, want ErrStateNotFound", err)
+		}
+		if err := store.Delete(ctx, st.SessionID); err != nil {
+			t.Fatalf("Delete() of missing session error = %v", err)
+		}
+
+		again := statex.NewSessionState(st.SessionID, "ws", "cust", "chat", time.Now())
+		if err := store.Save(ctx, again); err != nil {
+			t.Fatalf("Save() after Delete error = %v", err)
+		}
+	})
+
+	t.Run("GoalEventLog", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		log, ok := store.(statex.GoalEventLog)
+		if !ok {
+			t.Skip("store does not implement GoalEventLog")
+		}
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		firstSeq := st.EventSeq
+
+		st, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		now := time.Now().UTC()
+		st.BeginTurn()
+		support := statex.CreateGoal("g_2", "support.troubleshoot", 80, now)
+		if err := st.AddGoal(support); err != nil {
+			t.Fatalf("AddGoal() error = %v", err)
+		}
+		if err := st.SuspendAndActivate(support.ID, now); err != nil {
+			t.Fatalf("SuspendAndActivate() error = %v", err)
+		}
+		if err := st.PatchSlots(support.ID, map[string]any{"order_id": "A-1"}, now); err != nil {
+			t.Fatalf("PatchSlots() error = %v", err)
+		}
+		if err := st.MarkGoalDone(support.ID, now); err != nil {
+			t.Fatalf("MarkGoalDone() error = %v", err)
+		}
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		saved, err := store.Load(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		events, err := log.GoalEvents(ctx, st.SessionID, 0, 0)
+		if err != nil {
+			t.Fatalf("GoalEvents() error = %v", err)
+		}
+		if len(events) == 0 || events[len(events)-1].Seq != saved.EventSeq {
+			t.Fatalf("log ends at %+v, snapshot at seq %d", events, saved.EventSeq)
+		}
+		replayed, err := statex.ReplayGoalEvents(events)
+		if err != nil {
+			t.Fatalf("ReplayGoalEvents() error = %v", err)
+		}
+		if got, want := goalSnapshot(t, replayed), goalSnapshot(t, saved); got != want {
+			t.Fatalf("replay diverged from snapshot:\n got  %s\n want %s", got, want)
+		}
+
+		tail, err := log.GoalEvents(ctx, st.SessionID, firstSeq, 0)
+		if err != nil {
+			t.Fatalf("GoalEvents(after) error = %v", err)
+		}
+		if len(tail) != len(events)-int(firstSeq) || tail[0].Seq != firstSeq+1 || tail[0].Turn != 2 {
+			t.Fatalf("unexpected tail after seq %d: %+v", firstSeq, tail)
+		}
+		page, err := log.GoalEvents(ctx, st.SessionID, firstSeq, 2)
+		if err != nil {
+			t.Fatalf("GoalEvents(after, limit) error = %v", err)
+		}
+		if len(page) != 2 || page[0].Seq != firstSeq+1 || page[1].Seq != firstSeq+2 {
+			t.Fatalf("unexpected page of 2 after seq %d: %+v", firstSeq, page)
+		}
+
+		if err := store.Delete(ctx, st.SessionID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := log.GoalEvents(ctx, st.SessionID, 0, 0); !errors.Is(err, statex.ErrStateNotFound) {
+			t.Fatalf("GoalEvents() after Delete error = %v, want ErrStateNotFound", err)
+		}
+		again := sampleState(t)
+		again.SessionID = st.SessionID
+		if err := store.Save(ctx, again); err != nil {
+			t.Fatalf("Save() after Delete error = %v", err)
+		}
+		if events, err := log.GoalEvents(ctx, st.SessionID, 0, 0); err != nil || len(events) != int(again.EventSeq) {
+			t.Fatalf("GoalEvents() of recreated session = %d events (err %v), want %d", len(events), err, again.EventSeq)
+		}
+	})
+
+	t.Run("GoalEventLimit", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0, statex.WithEventLimit(3))
+		log, ok := store.(statex.GoalEventLog)
+		if !ok {
+			t.Skip("store does not implement GoalEventLog")
+		}
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		// Run past two checkpoints; the log is trimmed to the second one.
+		for round := 0; st.EventSeq < 2*statex.EventCheckpointInterval+10; round++ {
+			now := time.Now().UTC()
+			st.BeginTurn()
+			for i := 0; i < 25; i++ {
+				if err := st.PatchSlots("g_1", map[string]any{"round": round*25 + i}, now); err != nil {
+					t.Fatalf("PatchSlots() error = %v", err)
+				}
+			}
+			if err := store.Save(ctx, st); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+		}
+
+		events, err := log.GoalEvents(ctx, st.SessionID, 0, 0)
+		if err != nil {
+			t.Fatalf("GoalEvents() error = %v", err)
+		}
+		first := (st.EventSeq - 2) / statex.EventCheckpointInterval * statex.EventCheckpointInterval
+		if len(events) < 3 || events[0].Seq != first || events[0].Type != statex.EventCheckpoint || events[len(events)-1].Seq != st.EventSeq {
+			t.Fatalf("expected the log trimmed to the checkpoint at seq %d, got %d events from seq %d (%s)",
+				first, len(events), events[0].Seq, events[0].Type)
+		}
+		replayed, err := statex.ReplayGoalEvents(events)
+		if err != nil {
+			t.Fatalf("ReplayGoalEvents() error = %v", err)
+		}
+		want, _ := json.Marshal([]any{st.ActiveGoalID, st.GoalStack, st.Goals, st.GoalHistory})
+		got, _ := json.Marshal([]any{replayed.ActiveGoalID, replayed.GoalStack, replayed.Goals, replayed.GoalHistory})
+		if string(got) != string(want) {
+			t.Fatalf("replay of the trimmed log diverged:\n got  %s\n want %s", got, want)
+		}
+
+		page, err := log.GoalEvents(ctx, st.SessionID, first, 1)
+		if err != nil {
+			t.Fatalf("GoalEvents(after, limit) error = %v", err)
+		}
+		if len(page) != 1 || page[0].Seq != first+1 {
+			t.Fatalf("unexpected page after seq %d: %+v", first, page)
+		}
+	})
+
+	t.Run("SnapshotHistory", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		history, ok := store.(statex.SnapshotHistory)
+		if !ok {
+			t.Skip("store does not implement SnapshotHistory")
+		}
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if snaps, err := history.Snapshots(ctx, st.SessionID); err != nil || len(snaps) != 0 {
+			t.Fatalf("Snapshots() of new session = %d (err %v), want none", len(snaps), err)
+		}
+
+		const saves = 12
+		for i := 0; i < saves; i++ {
+			st.BeginTurn()
+			if err := store.Save(ctx, st); err != nil {
+				t.Fatalf("Save() turn %d error = %v", st.Turn, err)
+			}
+		}
+		snaps, err := history.Snapshots(ctx, st.SessionID)
+		if err != nil {
+			t.Fatalf("Snapshots() error = %v", err)
+		}
+		if len(snaps) != 10 {
+			t.Fatalf("Snapshots() = %d, want the default history of 10", len(snaps))
+		}
+		for i, snap := range snaps {
+			if want := st.Turn - 1 - i; snap.Turn != want {
+				t.Fatalf("snapshot %d at turn %d, want %d (newest first)", i, snap.Turn, want)
+			}
+		}
+
+		if err := store.Delete(ctx, st.SessionID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := history.Snapshots(ctx, st.SessionID); !errors.Is(err, statex.ErrStateNotFound) {
+			t.Fatalf("Snapshots() after Delete error = %v, want ErrStateNotFound", err)
+		}
+	})
+
+	t.Run("ScanSessionIDs", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, 0)
+		scanner, ok := store.(statex.SessionScanner)
+		if !ok {
+			t.Skip("store does not implement SessionScanner")
+		}
+		ctx := context.Background()
+		// Ids are opaque; a leading dot must not hide a session from the scan.
+		want := []string{newSessionID(), "." + newSessionID()}
+		for _, id := range want {
+			if err := store.Save(ctx, statex.NewSessionState(id, "ws", "cust", "chat", time.Now())); err != nil {
+				t.Fatalf("Save(%q) error = %v", id, err)
+			}
+		}
+
+		seen := make(map[string]bool)
+		if err := scanner.ScanSessionIDs(ctx, func(id string) error {
+			seen[id] = true
+			return nil
+		}); err != nil {
+			t.Fatalf("ScanSessionIDs() error = %v", err)
+		}
+		for _, id := range want {
+			if !seen[id] {
+				t.Fatalf("ScanSessionIDs() missed %q, saw %v", id, seen)
+			}
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t, ExpiryTTL)
+		ctx := context.Background()
+		st := sampleState(t)
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if _, err := store.Load(ctx, st.SessionID); err != nil {
+			t.Fatalf("Load() before expiry error = %v", err)
+		}
+
+		time.Sleep(ExpiryTTL + 250*time.Millisecond)
+		if _, err := store.Load(ctx, st.SessionID); !errors.Is(err, statex.ErrStateNotFound) {
+			t.Fatalf("Load() after expiry error = %v, want ErrStateNotFound", err)
+		}
+	})
+}
+
+// goalSnapshot renders the event-sourced part of st for comparison.
+func goalSnapshot(t *testing.T, st *statex.SessionState) string {
+	t.Helper()
+	raw, err := json.Marshal(struct {
+		ActiveGoalID string
+		GoalStack    []string
+		Goals        map[string]*statex.Goal
+		EventSeq     int64
+	}{st.ActiveGoalID, st.GoalStack, st.Goals, st.EventSeq})
+	if err != nil {
+		t.Fatalf("marshal goal snapshot: %v", err)
+	}
+	return string(raw)
+}
+
+func newSessionID() string {
+	return fmt.Sprintf("statetest-%d-%d", time.Now().UnixNano(), sessionSeq.Add(1))
+}
+
+func sampleState(t *testing.T) *statex.SessionState {
+	t.Helper()
+	now := time.Now().UTC()
+	st := statex.NewSessionState(newSessionID(), "ws", "cust", "chat", now)
+
+	goal := statex.CreateGoal("g_1", "sales.recommend_item", 50, now)
+	goal.SetSlot("budget", "35000")
+	if err := st.AddGoal(goal); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	if err := st.SetActiveGoal(goal.ID); err != nil {
+		t.Fatalf("SetActiveGoal() error = %v", err)
+	}
+	st.AppendTranscript(statex.TranscriptEntry{
+		Turn:   st.BeginTurn(),
+		Role:   statex.TranscriptRoleUser,
+		Text:   "แนะนำโน้ตบุ๊กงบ 35k",
+		GoalID: goal.ID,
+		At:     now,
+	})
+	return st
+}
@@ -0,0 +1,310 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStateNotFound   = errors.New("session state not found")
+	ErrNilSessionState = errors.New("session state is nil")
+	ErrInvalidSession  = errors.New("session id is empty")
+	// ErrVersionConflict means the stored state changed since it was loaded.
+	ErrVersionConflict = errors.New("session state version conflict")
+)
+
+const (
+	defaultStoreTTL = 24 * time.Hour
+	// defaultSnapshotHistory is how many prior snapshots stores keep for Rewind.
+	defaultSnapshotHistory = 10
+	// defaultEventLimit is how many of their latest goal events stores keep at
+	// least.
+	defaultEventLimit = 1000
+)
+
+// Store is the persistence contract used by the orchestrator.
+// Save is a compare-and-set on SessionState.Version: it fails with
+// ErrVersionConflict when the stored version differs (a missing session counts
+// as version 0), and bumps st.Version on success.
+type Store interface {
+	Load(ctx context.Context, sessionID string) (*SessionState, error)
+	Save(ctx context.Context, st *SessionState) error
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// StoreOption customizes the store constructors. Options that do not apply to
+// a given backend are ignored.
+type StoreOption func(*storeOptions)
+
+type storeOptions struct {
+	ttl        time.Duration
+	history    int
+	events     int
+	httpClient *http.Client
+}
+
+// WithTTL sets how long a session lives after its last save. 0 disables expiry.
+func WithTTL(ttl time.Duration) StoreOption {
+	return func(o *storeOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithSnapshotHistory sets how many prior snapshots a session keeps for
+// rewinding. 0 keeps none.
+func WithSnapshotHistory(n int) StoreOption {
+	return func(o *storeOptions) {
+		o.history = n
+	}
+}
+
+// WithEventLimit sets how many of its latest goal events a session keeps at
+// least; older events are dropped when a save appends new ones, up to the
+// checkpoint before them (see EventCheckpointInterval) so the log can still be
+// replayed. 0 keeps them all.
+func WithEventLimit(n int) StoreOption {
+	return func(o *storeOptions) {
+		o.events = n
+	}
+}
+
+// WithHTTPClient overrides the HTTP client of REST-based stores.
+func WithHTTPClient(client *http.Client) StoreOption {
+	return func(o *storeOptions) {
+		if client != nil {
+			o.httpClient = client
+		}
+	}
+}
+
+func applyStoreOptions(opts []StoreOption) (storeOptions, error) {
+	o := storeOptions{ttl: defaultStoreTTL, history: defaultSnapshotHistory, events: defaultEventLimit}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	if o.ttl < 0 {
+		return storeOptions{}, errors.New("ttl must be >= 0")
+	}
+	if o.history < 0 {
+		return storeOptions{}, errors.New("snapshot history must be >= 0")
+	}
+	if o.events < 0 {
+		return storeOptions{}, errors.New("event limit must be >= 0")
+	}
+	return o, nil
+}
+
+// StoreConfig selects the session store backend in main.go.
+type StoreConfig struct {
+	// Backend is "upstash", "redis", "sql", "memory" or "file".
+	Backend string        `envconfig:"BACKEND" split_words:"true" default:"upstash"`
+	Dir     string        `envconfig:"DIR" split_words:"true" default:".data/sessions"`
+	TTL     time.Duration `envconfig:"TTL" split_words:"true" default:"24h"`
+	// History is how many prior snapshots each session keeps for rewinding.
+	History int `envconfig:"HISTORY" split_words:"true" default:"10"`
+	// Events is how many of its latest goal events each session keeps at
+	// least; 0 keeps them all.
+	Events int `envconfig:"EVENTS" split_words:"true" default:"1000"`
+}
+
+func sessionKey(sessionID string) (string, error) {
+	trimmed := strings.TrimSpace(sessionID)
+	if trimmed == "" {
+		return "", ErrInvalidSession
+	}
+	return trimmed, nil
+}
+
+// prepareSave checks st and normalizes it before it is written. A save fenced
+// by ctx (see WithFencingToken) records its token on st, or fails when st was
+// already saved with a newer one.
+func prepareSave(ctx context.Context, st *SessionState) error {
+	if st == nil {
+		return ErrNilSessionState
+	}
+	if strings.TrimSpace(st.SessionID) == "" {
+		return ErrInvalidSession
+	}
+	if token := fencingToken(ctx); token > 0 {
+		if err := checkFence(ctx, st.SessionID, st.FencingToken); err != nil {
+			return err
+		}
+		st.FencingToken = token
+	}
+	st.EnsureGoalsMap()
+	st.SchemaVersion = CurrentSchemaVersion
+	if st.UpdatedAt.IsZero() {
+		st.UpdatedAt = time.Now().UTC()
+	} else {
+		st.UpdatedAt = st.UpdatedAt.UTC()
+	}
+	return nil
+}
+
+// encodeNextVersion marshals st as it will look once saved, i.e. with Version
+// bumped by one. st itself is left unchanged.
+func encodeNextVersion(st *SessionState) ([]byte, error) {
+	next := *st
+	next.Version = st.Version + 1
+	payload, err := json.Marshal(&next)
+	if err != nil {
+		return nil, fmt.Errorf("marshal session state: %w", err)
+	}
+	return payload, nil
+}
+
+// encodePendingEvents marshals the goal events Save must append with st.
+func encodePendingEvents(st *SessionState) ([][]byte, error) {
+	out := make([][]byte, 0, len(st.pendingEvents))
+	for _, e := range st.pendingEvents {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("marshal goal event %d: %w", e.Seq, err)
+		}
+		out = append(out, raw)
+	}
+	return out, nil
+}
+
+// markSaved records a successful Save on st: the version moves forward and the
+// pending events are now part of the stored log.
+func markSaved(st *SessionState) {
+	st.Version++
+	st.pendingEvents = nil
+}
+
+// decodeSnapshots decodes stored prior snapshots, newest first.
+func decodeSnapshots(raw [][]byte) ([]*SessionState, error) {
+	out := make([]*SessionState, 0, len(raw))
+	for _, r := range raw {
+		st, err := decodeSessionState(r)
+		if err != nil {
+			return nil, fmt.Errorf("decode snapshot: %w", err)
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// pushHistory prepends prev to history, keeping at most limit snapshots.
+func pushHistory[T any](history []T, prev T, limit int) []T {
+	if limit <= 0 {
+		return nil
+	}
+	out := make([]T, 0, min(len(history)+1, limit))
+	out = append(out, prev)
+	for _, h := range history {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// decodeGoalEvents decodes stored events, keeping those with Seq > afterSeq, at
+// most limit of them (limit <= 0 keeps all).
+func decodeGoalEvents(raw [][]byte, afterSeq int64, limit int) ([]GoalEvent, error) {
+	out := make([]GoalEvent, 0, len(raw))
+	for _, r := range raw {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		var e GoalEvent
+		if err := json.Unmarshal(r, &e); err != nil {
+			return nil, fmt.Errorf("unmarshal goal event: %w", err)
+		}
+		if e.Seq > afterSeq {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// eventTrimSeq returns the first seq a log ending at lastSeq keeps under
+// limit: the latest checkpoint that leaves at least limit events, or 1 when
+// nothing is dropped.
+func eventTrimSeq(lastSeq int64, limit int) int64 {
+	if limit <= 0 {
+		return 1
+	}
+	return max((lastSeq-int64(limit)+1)/EventCheckpointInterval*EventCheckpointInterval, 1)
+}
+
+// trimEvents trims events, a stored log of consecutive seqs ending at lastSeq,
+// to start at eventTrimSeq.
+func trimEvents[T any](events []T, lastSeq int64, limit int) []T {
+	firstSeq := lastSeq - int64(len(events)) + 1
+	if drop := eventTrimSeq(lastSeq, limit) - firstSeq; drop > 0 {
+		return events[min(drop, int64(len(events))):]
+	}
+	return events
+}
+
+// firstEventSeq returns the seq of the first event in head, or 1 for an empty
+// log.
+func firstEventSeq(head [][]byte) (int64, error) {
+	events, err := decodeGoalEvents(head, 0, 1)
+	if err != nil || len(events) == 0 {
+		return 1, err
+	}
+	return events[0].Seq, nil
+}
+
+// eventRange returns the list range holding up to limit events after afterSeq
+// in a log whose first entry has seq firstSeq. Stored logs hold consecutive
+// seqs, so an event's index is its distance from the first one. stop is -1 for
+// the end of the list.
+func eventRange(firstSeq, afterSeq int64, limit int) (start, stop int64) {
+	start = max(afterSeq-firstSeq+1, 0)
+	stop = -1
+	if limit > 0 {
+		stop = start + int64(limit) - 1
+	}
+	return start, stop
+}
+
+// decodeSessionState migrates payload to the current schema, then decodes and
+// validates it.
+func decodeSessionState(payload []byte) (*SessionState, error) {
+	payload, storedSchema, err := migrateSessionDocument(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var state SessionState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, fmt.Errorf("unmarshal session state: %w", err)
+	}
+	state.loadedSchemaVersion = &storedSchema
+
+	state.EnsureGoalsMap()
+	if err := state.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid session state loaded from store: %w", err)
+	}
+	return &state, nil
+}
+
+func versionConflict(sessionID string, expected int64) error {
+	return fmt.Errorf("%w: session=%s version=%d", ErrVersionConflict, sessionID, expected)
+}
+
+// checkFence fails with ErrLeaseLost when the session was saved with a newer
+// lease token than the one ctx carries. Unfenced saves always pass.
+func checkFence(ctx context.Context, sessionID string, stored int64) error {
+	if token := fencingToken(ctx); token > 0 && stored > token {
+		return staleLease(ctx, sessionID)
+	}
+	return nil
+}
+
+func staleLease(ctx context.Context, sessionID string) error {
+	return fmt.Errorf("%w: session=%s token=%d was superseded", ErrLeaseLost, sessionID, fencingToken(ctx))
+}
@@ -0,0 +1,113 @@
+package state_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+	"github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state/statetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		store, err := statex.NewMemoryStore(append(opts, statex.WithTTL(ttl))...)
+		if err != nil {
+			t.Fatalf("NewMemoryStore() error = %v", err)
+		}
+		return store
+	})
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		store, err := statex.NewFileStore(t.TempDir(), append(opts, statex.WithTTL(ttl))...)
+		if err != nil {
+			t.Fatalf("NewFileStore() error = %v", err)
+		}
+		return store
+	})
+}
+
+func TestUpstashRedisStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		server := httptest.NewServer(newFakeUpstash())
+		t.Cleanup(server.Close)
+
+		store, err := statex.NewUpstashRedisStore(
+			statex.UpstashRedisConfig{URL: server.URL, Token: "token"},
+			append(opts, statex.WithHTTPClient(server.Client()), statex.WithTTL(ttl))...,
+		)
+		if err != nil {
+			t.Fatalf("NewUpstashRedisStore() error = %v", err)
+		}
+		return store
+	})
+}
+
+// TestUpstashRedisStoreConformanceLive runs the suite against a real Upstash
+// database when UPSTASH_REDIS_URL and UPSTASH_REDIS_TOKEN are set.
+func TestUpstashRedisStoreConformanceLive(t *testing.T) {
+	url, token := os.Getenv("UPSTASH_REDIS_URL"), os.Getenv("UPSTASH_REDIS_TOKEN")
+	if url == "" || token == "" {
+		t.Skip("UPSTASH_REDIS_URL / UPSTASH_REDIS_TOKEN not set")
+	}
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		if ttl == 0 {
+			ttl = time.Minute
+		}
+		store, err := statex.NewUpstashRedisStore(statex.UpstashRedisConfig{URL: url, Token: token}, append(opts, statex.WithTTL(ttl))...)
+		if err != nil {
+			t.Fatalf("NewUpstashRedisStore() error = %v", err)
+		}
+		return store
+	})
+}
+
+// fakeUpstash is an in-process stand-in for the Upstash REST API backed by
+// fakeRedis.
+type fakeUpstash struct {
+	mu sync.Mutex
+	fakeRedis
+}
+
+func newFakeUpstash() *fakeUpstash {
+	return &fakeUpstash{fakeRedis: newFakeRedis()}
+}
+
+func (f *fakeUpstash) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var cmd []any
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&cmd); err != nil || len(cmd) == 0 {
+		fmt.Fprint(w, `{"error":"bad command"}`)
+		return
+	}
+	args := make([]string, len(cmd)-1)
+	for i, arg := range cmd[1:] {
+		args[i] = fmt.Sprint(arg)
+	}
+
+	f.mu.Lock()
+	result := f.exec(fmt.Sprint(cmd[0]), args)
+	f.mu.Unlock()
+
+	if err, ok := result.(error); ok {
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"result": result})
+}
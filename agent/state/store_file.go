@@ -0,0 +1,267 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps one JSON document per session under a directory. Writes go to
+// a temp file that is renamed into place, so readers never see a partial state.
+// Version checks are serialized within the process only; do not point several
+// processes at the same directory.
+type FileStore struct {
+	dir     string
+	ttl     time.Duration
+	history int
+	events  int
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+// fileRecord is the on-disk document: the session, its goal event log, prior
+// snapshots (newest first) and its expiry. Keeping everything in one file makes
+// each Save a single rename.
+type fileRecord struct {
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	State     json.RawMessage   `json:"state"`
+	Events    []json.RawMessage `json:"events,omitempty"`
+	History   []json.RawMessage `json:"history,omitempty"`
+}
+
+func NewFileStore(dir string, opts ...StoreOption) (*FileStore, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, errors.New("file store directory is required")
+	}
+	o, err := applyStoreOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create file store directory: %w", err)
+	}
+	return &FileStore{dir: dir, ttl: o.ttl, history: o.history, events: o.events, now: time.Now}, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rec, err := s.readLocked(path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return decodeSessionState(rec.State)
+}
+
+func (s *FileStore) Save(ctx context.Context, st *SessionState) error {
+	if err := prepareSave(ctx, st); err != nil {
+		return err
+	}
+	path, err := s.path(st.SessionID)
+	if err != nil {
+		return err
+	}
+	payload, err := encodeNextVersion(st)
+	if err != nil {
+		return err
+	}
+	events, err := encodePendingEvents(st)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current int64
+	rec, err := s.readLocked(path)
+	switch {
+	case err == nil:
+		var stored struct {
+			Version      int64 `json:"version"`
+			FencingToken int64 `json:"fencing_token"`
+		}
+		if err := json.Unmarshal(rec.State, &stored); err != nil {
+			return fmt.Errorf("decode stored version: %w", err)
+		}
+		if err := checkFence(ctx, st.SessionID, stored.FencingToken); err != nil {
+			return err
+		}
+		current = stored.Version
+	case !errors.Is(err, ErrStateNotFound):
+		return err
+	}
+	if current != st.Version {
+		return versionConflict(st.SessionID, st.Version)
+	}
+
+	next := fileRecord{State: payload, Events: rec.Events}
+	for _, e := range events {
+		next.Events = append(next.Events, e)
+	}
+	next.Events = trimEvents(next.Events, st.EventSeq, s.events)
+	if current > 0 {
+		next.History = pushHistory(rec.History, rec.State, s.history)
+	}
+	if s.ttl > 0 {
+		expiresAt := s.now().Add(s.ttl).UTC()
+		next.ExpiresAt = &expiresAt
+	}
+	if err := s.writeLocked(path, next); err != nil {
+		return err
+	}
+	markSaved(st)
+	return nil
+}
+
+func (s *FileStore) GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]GoalEvent, error) {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rec, err := s.readLocked(path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	raw := make([][]byte, len(rec.Events))
+	for i, e := range rec.Events {
+		raw[i] = e
+	}
+	return decodeGoalEvents(raw, afterSeq, limit)
+}
+
+func (s *FileStore) Delete(ctx context.Context, sessionID string) error {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete session file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) ScanSessionIDs(ctx context.Context, fn func(sessionID string) error) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read file store directory: %w", err)
+	}
+	for _, e := range entries {
+		// Temp files from writeLocked end in ".tmp", so the suffix alone skips
+		// them; session ids may themselves start with a dot.
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Snapshots(ctx context.Context, sessionID string) ([]*SessionState, error) {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rec, err := s.readLocked(path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	raw := make([][]byte, len(rec.History))
+	for i, h := range rec.History {
+		raw[i] = h
+	}
+	return decodeSnapshots(raw)
+}
+
+// path maps a session id to its file. The id is path-escaped and suffixed, so
+// ids like ".." or "a/b" cannot leave the store directory.
+func (s *FileStore) path(sessionID string) (string, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, url.PathEscape(key)+".json"), nil
+}
+
+// readLocked reads the record at path, removing it if it has expired.
+func (s *FileStore) readLocked(path string) (fileRecord, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileRecord{}, ErrStateNotFound
+	}
+	if err != nil {
+		return fileRecord{}, fmt.Errorf("read session file: %w", err)
+	}
+
+	var rec fileRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return fileRecord{}, fmt.Errorf("decode session file: %w", err)
+	}
+	if rec.ExpiresAt != nil && !s.now().Before(*rec.ExpiresAt) {
+		_ = os.Remove(path)
+		return fileRecord{}, ErrStateNotFound
+	}
+	return rec, nil
+}
+
+func (s *FileStore) writeLocked(path string, rec fileRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal session file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".session-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp session file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp session file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp session file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("rename session file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps SessionState in process memory. It is meant for local runs
+// and tests; states are stored as JSON so callers never share pointers with it.
+type MemoryStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	history  int
+	events   int
+	sessions map[string]memoryRecord
+	now      func() time.Time
+}
+
+type memoryRecord struct {
+	payload   []byte
+	version   int64
+	fence     int64 // FencingToken of payload
+	events    [][]byte
+	history   [][]byte  // prior payloads, newest first
+	expiresAt time.Time // zero means no expiry
+}
+
+func NewMemoryStore(opts ...StoreOption) (*MemoryStore, error) {
+	o, err := applyStoreOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryStore{
+		ttl:      o.ttl,
+		history:  o.history,
+		events:   o.events,
+		sessions: make(map[string]memoryRecord),
+		now:      time.Now,
+	}, nil
+}
+
+func (s *MemoryStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rec, ok := s.liveRecordLocked(key)
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	return decodeSessionState(rec.payload)
+}
+
+func (s *MemoryStore) Save(ctx context.Context, st *SessionState) error {
+	if err := prepareSave(ctx, st); err != nil {
+		return err
+	}
+	key, err := sessionKey(st.SessionID)
+	if err != nil {
+		return err
+	}
+	payload, err := encodeNextVersion(st)
+	if err != nil {
+		return err
+	}
+	events, err := encodePendingEvents(st)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.liveRecordLocked(key)
+	if err := checkFence(ctx, st.SessionID, prev.fence); err != nil {
+		return err
+	}
+	if prev.version != st.Version {
+		return versionConflict(st.SessionID, st.Version)
+	}
+
+	rec := memoryRecord{
+		payload: payload,
+		version: st.Version + 1,
+		fence:   st.FencingToken,
+		events:  trimEvents(append(prev.events[:len(prev.events):len(prev.events)], events...), st.EventSeq, s.events),
+	}
+	if ok {
+		rec.history = pushHistory(prev.history, prev.payload, s.history)
+	}
+	if s.ttl > 0 {
+		rec.expiresAt = s.now().Add(s.ttl)
+	}
+	s.sessions[key] = rec
+	markSaved(st)
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, sessionID string) error {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.sessions, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]GoalEvent, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rec, ok := s.liveRecordLocked(key)
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	return decodeGoalEvents(rec.events, afterSeq, limit)
+}
+
+func (s *MemoryStore) Snapshots(ctx context.Context, sessionID string) ([]*SessionState, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rec, ok := s.liveRecordLocked(key)
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	return decodeSnapshots(rec.history)
+}
+
+// liveRecordLocked returns the record for key, dropping it if it has expired.
+func (s *MemoryStore) liveRecordLocked(key string) (memoryRecord, bool) {
+	rec, ok := s.sessions[key]
+	if !ok {
+		return memoryRecord{}, false
+	}
+	if !rec.expiresAt.IsZero() && !s.now().Before(rec.expiresAt) {
+		delete(s.sessions, key)
+		return memoryRecord{}, false
+	}
+	return rec, true
+}
+
+func (s *MemoryStore) ScanSessionIDs(ctx context.Context, fn func(sessionID string) error) error {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.sessions))
+	for key := range s.sessions {
+		if _, ok := s.liveRecordLocked(key); ok {
+			ids = append(ids, key)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
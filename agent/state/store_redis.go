@@ -0,0 +1,340 @@
+package state
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// RedisConfig configures RedisStore for self-hosted Redis or Valkey.
+type RedisConfig struct {
+	Addr     string `envconfig:"ADDR" split_words:"true" required:"true"`
+	Username string `envconfig:"USERNAME" split_words:"true"`
+	Password string `envconfig:"PASSWORD" split_words:"true"`
+	DB       int    `envconfig:"DB" split_words:"true"`
+
+	TLS                   bool   `envconfig:"TLS" split_words:"true"`
+	TLSServerName         string `envconfig:"TLS_SERVER_NAME" split_words:"true"`
+	TLSInsecureSkipVerify bool   `envconfig:"TLS_INSECURE_SKIP_VERIFY" split_words:"true"`
+
+	PoolSize    int           `envconfig:"POOL_SIZE" split_words:"true" default:"10"`
+	DialTimeout time.Duration `envconfig:"DIAL_TIMEOUT" split_words:"true" default:"5s"`
+	Timeout     time.Duration `envconfig:"TIMEOUT" split_words:"true" default:"5s"`
+
+	// TLSConfig overrides the config built from the TLS* fields (e.g. custom CAs).
+	TLSConfig *tls.Config `ignored:"true"`
+}
+
+// RedisStore persists SessionState in Redis over RESP, using the same key
+// layout, TTL and compare-and-set script as UpstashRedisStore.
+type RedisStore struct {
+	pool    *respPool
+	ttl     time.Duration
+	history int
+	events  int
+}
+
+func NewRedisStore(cfg RedisConfig, opts ...StoreOption) (*RedisStore, error) {
+	cfg.Addr = strings.TrimSpace(cfg.Addr)
+	if cfg.Addr == "" {
+		return nil, errors.New("redis addr is required")
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 10
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	o, err := applyStoreOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig == nil && cfg.TLS {
+		serverName := cfg.TLSServerName
+		if serverName == "" {
+			host, _, err := net.SplitHostPort(cfg.Addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redis addr: %w", err)
+			}
+			serverName = host
+		}
+		tlsConfig = &tls.Config{
+			ServerName:         serverName,
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		}
+	}
+
+	pool := newRESPPool(cfg.PoolSize, cfg.Timeout, func(ctx context.Context) (*respConn, error) {
+		return dialRESP(ctx, cfg, tlsConfig)
+	})
+	return &RedisStore{pool: pool, ttl: o.ttl, history: o.history, events: o.events}, nil
+}
+
+func (s *RedisStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	key, err := redisSessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := s.pool.do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		moved, err := s.moveLegacyKeys(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !moved {
+			return nil, ErrStateNotFound
+		}
+		return s.Load(ctx, sessionID)
+	}
+	payload, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("decode session payload: unexpected reply %T", reply)
+	}
+	return decodeSessionState([]byte(payload))
+}
+
+func (s *RedisStore) Save(ctx context.Context, st *SessionState) error {
+	if err := prepareSave(ctx, st); err != nil {
+		return err
+	}
+	payload, err := encodeNextVersion(st)
+	if err != nil {
+		return err
+	}
+
+	var ttl int64
+	if s.ttl > 0 {
+		ttl = ttlSeconds(s.ttl)
+	}
+
+	cmd, err := saveScriptCommand(ctx, st, payload, ttl, s.history, s.events)
+	if err != nil {
+		return err
+	}
+	reply, err := s.pool.do(ctx, cmd...)
+	if err != nil {
+		return err
+	}
+	applied, ok := reply.(int64)
+	if !ok {
+		return fmt.Errorf("decode save result: unexpected reply %T", reply)
+	}
+	switch applied {
+	case 1:
+	case -1:
+		return staleLease(ctx, st.SessionID)
+	default:
+		return versionConflict(st.SessionID, st.Version)
+	}
+
+	markSaved(st)
+	return nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, sessionID string) error {
+	keys, err := redisSessionKeys(sessionID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.moveLegacyKeys(ctx, sessionID); err != nil {
+		return err
+	}
+	_, err = s.pool.do(ctx, "DEL", keys[0], keys[1], keys[2])
+	return err
+}
+
+// GoalEvents reads only the requested page of the event list: the seq of its
+// first entry locates afterSeq.
+func (s *RedisStore) GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]GoalEvent, error) {
+	firstSeq := int64(1)
+	if afterSeq > 0 {
+		head, err := s.liveList(ctx, sessionID, 1, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if firstSeq, err = firstEventSeq(head); err != nil {
+			return nil, err
+		}
+	}
+	start, stop := eventRange(firstSeq, afterSeq, limit)
+	raw, err := s.liveList(ctx, sessionID, 1, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	return decodeGoalEvents(raw, afterSeq, limit)
+}
+
+func (s *RedisStore) Snapshots(ctx context.Context, sessionID string) ([]*SessionState, error) {
+	raw, err := s.liveList(ctx, sessionID, 2, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSnapshots(raw)
+}
+
+// liveList reads entries start..stop of the list redisSessionKeys(sessionID)[idx]
+// of a live session.
+func (s *RedisStore) liveList(ctx context.Context, sessionID string, idx int, start, stop int64) ([][]byte, error) {
+	keys, err := redisSessionKeys(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.pool.do(ctx, "EXISTS", keys[0])
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := exists.(int64); n == 0 {
+		moved, err := s.moveLegacyKeys(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !moved {
+			return nil, ErrStateNotFound
+		}
+	}
+
+	reply, err := s.pool.do(ctx, "LRANGE", keys[idx], start, stop)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("decode list %s: unexpected reply %T", keys[idx], reply)
+	}
+	raw := make([][]byte, 0, len(items))
+	for _, item := range items {
+		if v, ok := item.(string); ok {
+			raw = append(raw, []byte(v))
+		}
+	}
+	return raw, nil
+}
+
+func (s *RedisStore) ScanSessionIDs(ctx context.Context, fn func(sessionID string) error) error {
+	cursor := "0"
+	for {
+		reply, err := s.pool.do(ctx, "SCAN", cursor, "MATCH", sessionScanPattern, "COUNT", 200)
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return fmt.Errorf("decode scan result: unexpected reply %T", reply)
+		}
+		if cursor, ok = page[0].(string); !ok {
+			return fmt.Errorf("decode scan cursor: unexpected reply %T", page[0])
+		}
+		items, _ := page[1].([]any)
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			if key, ok := item.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+
+		if err := visitSessionKeys(keys, fn); err != nil {
+			return err
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// moveLegacyKeys moves a session stored under the legacy key layout to the
+// current one and reports whether there was one to move.
+func (s *RedisStore) moveLegacyKeys(ctx context.Context, sessionID string) (bool, error) {
+	keys, legacy, err := redisSessionKeyLayouts(sessionID)
+	if err != nil {
+		return false, err
+	}
+	exists, err := s.pool.do(ctx, "EXISTS", legacy[0])
+	if err != nil {
+		return false, err
+	}
+	if n, _ := exists.(int64); n == 0 {
+		return false, nil
+	}
+	moved, err := s.evalInt(ctx, moveLegacyKeysScript, append(keys, legacy...))
+	return moved == 1, err
+}
+
+// Close closes idle pooled connections.
+func (s *RedisStore) Close() error {
+	s.pool.close()
+	return nil
+}
+
+// sessionScanPattern matches sessionStateRedisKey, and the legacy layout, for
+// SCAN.
+const sessionScanPattern = "conv:*:agent:session"
+
+// visitSessionKeys strips the key layout and calls fn with each session id.
+func visitSessionKeys(keys []string, fn func(sessionID string) error) error {
+	for _, key := range keys {
+		id := strings.TrimSuffix(strings.TrimPrefix(key, "conv:"), ":agent:session")
+		if id == key || id == "" {
+			continue
+		}
+		if tagged := strings.TrimSuffix(strings.TrimPrefix(id, "{"), "}"); len(tagged) == len(id)-2 {
+			id = tagged
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func redisSessionKey(sessionID string) (string, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(sessionStateRedisKey, key), nil
+}
+
+// redisSessionKeys returns the session document, goal event list and snapshot
+// list keys, in the order saveScript expects them.
+func redisSessionKeys(sessionID string) ([]string, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		fmt.Sprintf(sessionStateRedisKey, key),
+		fmt.Sprintf(goalEventsRedisKey, key),
+		fmt.Sprintf(historyRedisKey, key),
+	}, nil
+}
+
+// redisSessionKeyLayouts returns redisSessionKeys and the same keys in the
+// legacy layout.
+func redisSessionKeyLayouts(sessionID string) ([]string, []string, error) {
+	keys, err := redisSessionKeys(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, _ := sessionKey(sessionID)
+	return keys, []string{
+		fmt.Sprintf(legacySessionStateRedisKey, key),
+		fmt.Sprintf(legacyGoalEventsRedisKey, key),
+		fmt.Sprintf(legacyHistoryRedisKey, key),
+	}, nil
+}
@@ -0,0 +1,390 @@
+package state_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+	"github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state/statetest"
+)
+
+func TestRedisStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		srv := startFakeRESP(t, "", nil)
+		store, err := statex.NewRedisStore(statex.RedisConfig{Addr: srv.addr, PoolSize: 4}, append(opts, statex.WithTTL(ttl))...)
+		if err != nil {
+			t.Fatalf("NewRedisStore() error = %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	})
+}
+
+func TestRedisStoreConformanceOnCluster(t *testing.T) {
+	t.Parallel()
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		srv := startFakeRESP(t, "", nil)
+		srv.cluster = true
+		store, err := statex.NewRedisStore(statex.RedisConfig{Addr: srv.addr, PoolSize: 4}, append(opts, statex.WithTTL(ttl))...)
+		if err != nil {
+			t.Fatalf("NewRedisStore() error = %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	})
+}
+
+func TestRedisStoreMovesLegacyKeys(t *testing.T) {
+	t.Parallel()
+
+	srv := startFakeRESP(t, "", nil)
+	store, err := statex.NewRedisStore(statex.RedisConfig{Addr: srv.addr})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+
+	// Save sessions, then move their keys back to the layout without hash tags.
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, id := range []string{"s1", "s2"} {
+		st := statex.NewSessionState(id, "ws", "cust", "chat", now)
+		if err := st.AddGoal(statex.CreateGoal("g_"+id, "sales.recommend_item", 50, now)); err != nil {
+			t.Fatalf("AddGoal() error = %v", err)
+		}
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		for _, name := range []string{"session", "goal_events"} {
+			tagged := fmt.Sprintf("conv:{%s}:agent:%s", id, name)
+			legacy := fmt.Sprintf("conv:%s:agent:%s", id, name)
+			if reply := srv.exec("RENAME", []string{tagged, legacy}); strings.HasPrefix(reply, "-") {
+				t.Fatalf("RENAME %s: %q", tagged, reply)
+			}
+		}
+	}
+
+	var scanned []string
+	if err := store.ScanSessionIDs(ctx, func(id string) error {
+		scanned = append(scanned, id)
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanSessionIDs() error = %v", err)
+	}
+	if slices.Sort(scanned); fmt.Sprint(scanned) != "[s1 s2]" {
+		t.Fatalf("scanned = %v, want the legacy sessions [s1 s2]", scanned)
+	}
+
+	st, err := store.Load(ctx, "s1")
+	if err != nil {
+		t.Fatalf("Load(legacy) error = %v", err)
+	}
+	if _, ok := st.GetGoal("g_s1"); !ok {
+		t.Fatalf("expected the legacy session's goal, got %v", st.Goals)
+	}
+	if _, ok := srv.value("conv:{s1}:agent:session"); !ok {
+		t.Fatal("expected the session moved under conv:{s1}:agent:session")
+	}
+	if _, ok := srv.value("conv:s1:agent:session"); ok {
+		t.Fatal("expected the legacy session key gone")
+	}
+	if err := store.Save(ctx, st); err != nil {
+		t.Fatalf("Save(moved) error = %v", err)
+	}
+
+	// Events of a session not loaded yet are moved on first read too.
+	events, err := store.GoalEvents(ctx, "s2", 0, 0)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("GoalEvents(legacy) = %d events, %v; want the legacy log", len(events), err)
+	}
+
+	if err := store.Delete(ctx, "s2"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Load(ctx, "s2"); !errors.Is(err, statex.ErrStateNotFound) {
+		t.Fatalf("Load(deleted) error = %v, want ErrStateNotFound", err)
+	}
+}
+
+func TestRedisStoreAuthAndKeyLayout(t *testing.T) {
+	t.Parallel()
+
+	srv := startFakeRESP(t, "s3cret", nil)
+	ctx := context.Background()
+
+	bad, err := statex.NewRedisStore(statex.RedisConfig{Addr: srv.addr, Password: "wrong"})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	if _, err := bad.Load(ctx, "s1"); err == nil || !strings.Contains(err.Error(), "redis auth") {
+		t.Fatalf("Load() with wrong password error = %v, want auth failure", err)
+	}
+
+	store, err := statex.NewRedisStore(statex.RedisConfig{Addr: srv.addr, Username: "agent", Password: "s3cret", PoolSize: 2})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	before := srv.connections.Load()
+
+	st := statex.NewSessionState("s1", "ws", "cust", "chat", time.Now())
+	if err := store.Save(ctx, st); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := store.Load(ctx, "s1"); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+	}
+
+	if _, ok := srv.value("conv:{s1}:agent:session"); !ok {
+		t.Fatal("expected session stored under conv:{s1}:agent:session")
+	}
+	if got := srv.connections.Load() - before; got != 1 {
+		t.Fatalf("connections = %d, want 1 reused pooled connection", got)
+	}
+}
+
+func TestRedisStoreTLS(t *testing.T) {
+	t.Parallel()
+
+	cert, pool := selfSignedCert(t)
+	srv := startFakeRESP(t, "", &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	store, err := statex.NewRedisStore(statex.RedisConfig{
+		Addr:      srv.addr,
+		TLSConfig: &tls.Config{RootCAs: pool, ServerName: "localhost", MinVersion: tls.VersionTLS12},
+	})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	if _, err := store.Load(context.Background(), "s1"); !errors.Is(err, statex.ErrStateNotFound) {
+		t.Fatalf("Load() over TLS error = %v, want ErrStateNotFound", err)
+	}
+}
+
+func TestRedisStoreReportsContextDeadline(t *testing.T) {
+	t.Parallel()
+
+	// A server that accepts connections but never replies.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	store, err := statex.NewRedisStore(statex.RedisConfig{Addr: ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := store.Load(ctx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Load() error = %v, want DeadlineExceeded", err)
+	}
+}
+
+// fakeRESP is an in-process RESP server backed by fakeRedis.
+type fakeRESP struct {
+	addr        string
+	password    string
+	connections atomic.Int64
+
+	mu sync.Mutex
+	fakeRedis
+}
+
+func startFakeRESP(t *testing.T, password string, tlsConfig *tls.Config) *fakeRESP {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	srv := &fakeRESP{addr: ln.Addr().String(), password: password, fakeRedis: newFakeRedis()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			srv.connections.Add(1)
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (f *fakeRESP) value(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.data[key]
+	return v, ok
+}
+
+func (f *fakeRESP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if args[len(args)-1] != f.password {
+				io.WriteString(conn, "-WRONGPASS invalid username-password pair\r\n")
+				continue
+			}
+			authed = true
+			io.WriteString(conn, "+OK\r\n")
+			continue
+		}
+		if !authed {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		io.WriteString(conn, f.exec(cmd, args[1:]))
+	}
+}
+
+func (f *fakeRESP) exec(cmd string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return encodeRESP(f.fakeRedis.exec(cmd, args))
+}
+
+func encodeRESP(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "$-1\r\n"
+	case error:
+		return "-" + v.Error() + "\r\n"
+	case int64:
+		return fmt.Sprintf(":%d\r\n", v)
+	case string:
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case []string:
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(v))
+		for _, item := range v {
+			b.WriteString(encodeRESP(item))
+		}
+		return b.String()
+	case []any:
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(v))
+		for _, item := range v {
+			b.WriteString(encodeRESP(item))
+		}
+		return b.String()
+	default:
+		return fmt.Sprintf("-ERR unsupported reply %T\r\n", v)
+	}
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(header, "*") {
+		return nil, fmt.Errorf("unexpected command header %q", header)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("bad array length %q", header)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk length %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
@@ -0,0 +1,664 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLConfig selects the database behind SQLStore. The driver itself must be
+// registered by the binary (pgx for postgres, modernc.org/sqlite for sqlite).
+type SQLConfig struct {
+	// Dialect is "postgres" or "sqlite".
+	Dialect string `envconfig:"DIALECT" split_words:"true" default:"sqlite"`
+	DSN     string `envconfig:"DSN" split_words:"true" default:"file:.data/sessions.db?_pragma=busy_timeout(5000)"`
+}
+
+// SQLStore persists SessionState as a JSON document and projects every goal
+// into agent_goals so goals can be queried without decoding sessions.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+	ttl     time.Duration
+	history int
+	events  int
+	now     func() time.Time
+}
+
+// SessionQuery filters ListSessions. Zero fields match everything.
+type SessionQuery struct {
+	WorkspaceID string
+	CustomerID  string
+	ChannelType string
+	Limit       int
+	Offset      int
+}
+
+// SessionSummary is one row of agent_sessions without the state document.
+type SessionSummary struct {
+	SessionID   string
+	WorkspaceID string
+	CustomerID  string
+	ChannelType string
+	Version     int64
+	UpdatedAt   time.Time
+	ExpiresAt   *time.Time
+}
+
+// GoalQuery filters QueryGoals and CountGoals. Zero fields match everything.
+type GoalQuery struct {
+	WorkspaceID string
+	SessionID   string
+	// TypePrefix matches goal types by prefix, e.g. "support.".
+	TypePrefix   string
+	Statuses     []GoalStatus
+	UpdatedAfter time.Time
+	Limit        int
+	Offset       int
+}
+
+// GoalRecord is one projected goal.
+type GoalRecord struct {
+	SessionID   string
+	WorkspaceID string
+	GoalID      string
+	Type        string
+	Status      GoalStatus
+	Priority    int
+	UpdatedAt   time.Time
+}
+
+// OpenSQLStore opens cfg.DSN with the driver matching cfg.Dialect and migrates it.
+func OpenSQLStore(ctx context.Context, cfg SQLConfig, opts ...StoreOption) (*SQLStore, error) {
+	dialect, err := sqlDialectFor(cfg.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(cfg.DSN) == "" {
+		return nil, errors.New("sql dsn is required")
+	}
+	db, err := sql.Open(dialect.driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dialect.name, err)
+	}
+	store, err := NewSQLStore(ctx, db, cfg.Dialect, opts...)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSQLStore wraps an open database and applies pending migrations.
+func NewSQLStore(ctx context.Context, db *sql.DB, dialectName string, opts ...StoreOption) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("sql db is required")
+	}
+	dialect, err := sqlDialectFor(dialectName)
+	if err != nil {
+		return nil, err
+	}
+	o, err := applyStoreOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if dialect.singleWriter {
+		// SQLite has a single writer; one connection avoids SQLITE_BUSY between
+		// our own transactions and keeps ":memory:" databases shared.
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &SQLStore{db: db, dialect: dialect, ttl: o.ttl, history: o.history, events: o.events, now: time.Now}
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload string
+	err = s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT state FROM agent_sessions
+		WHERE session_id = ? AND (expires_at IS NULL OR expires_at > ?)`),
+		key, s.dialect.timeValue(s.now()),
+	).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load session: %w", err)
+	}
+	return decodeSessionState([]byte(payload))
+}
+
+func (s *SQLStore) Save(ctx context.Context, st *SessionState) error {
+	if err := prepareSave(ctx, st); err != nil {
+		return err
+	}
+	key, err := sessionKey(st.SessionID)
+	if err != nil {
+		return err
+	}
+	payload, err := encodeNextVersion(st)
+	if err != nil {
+		return err
+	}
+	events, err := encodePendingEvents(st)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	var expiresAt any
+	if s.ttl > 0 {
+		expiresAt = s.dialect.timeValue(now.Add(s.ttl))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin save: %w", err)
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	if st.Version == 0 {
+		// A new session may replace an expired row but never a live one.
+		res, err = tx.ExecContext(ctx, s.dialect.rebind(`
+			INSERT INTO agent_sessions
+				(session_id, workspace_id, customer_id, channel_type, version, state, updated_at, expires_at, fencing_token)
+			VALUES (?, ?, ?, ?, 1, ?, ?, ?, ?)
+			ON CONFLICT (session_id) DO UPDATE SET
+				workspace_id = excluded.workspace_id,
+				customer_id = excluded.customer_id,
+				channel_type = excluded.channel_type,
+				version = 1,
+				state = excluded.state,
+				updated_at = excluded.updated_at,
+				expires_at = excluded.expires_at,
+				fencing_token = excluded.fencing_token
+			WHERE agent_sessions.expires_at IS NOT NULL AND agent_sessions.expires_at <= ?`),
+			key, st.WorkspaceID, st.CustomerID, st.ChannelType, string(payload),
+			s.dialect.timeValue(st.UpdatedAt), expiresAt, st.FencingToken, s.dialect.timeValue(now),
+		)
+	} else {
+		if err := s.keepSnapshot(ctx, tx, key, st.Version); err != nil {
+			return err
+		}
+		res, err = tx.ExecContext(ctx, s.dialect.rebind(`
+			UPDATE agent_sessions SET
+				workspace_id = ?, customer_id = ?, channel_type = ?,
+				version = version + 1, state = ?, updated_at = ?, expires_at = ?, fencing_token = ?
+			WHERE session_id = ? AND version = ? AND fencing_token <= ? AND (expires_at IS NULL OR expires_at > ?)`),
+			st.WorkspaceID, st.CustomerID, st.ChannelType, string(payload),
+			s.dialect.timeValue(st.UpdatedAt), expiresAt, st.FencingToken,
+			key, st.Version, st.FencingToken, s.dialect.timeValue(now),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+	if n != 1 {
+		return s.saveRejected(ctx, tx, key, st)
+	}
+
+	if err := s.projectGoals(ctx, tx, key, st); err != nil {
+		return err
+	}
+	if err := s.appendEvents(ctx, tx, key, st, events); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit save: %w", err)
+	}
+
+	markSaved(st)
+	return nil
+}
+
+// saveRejected explains why the compare-and-set update matched no row: a newer
+// lease saved the session, or its version moved on.
+func (s *SQLStore) saveRejected(ctx context.Context, tx *sql.Tx, key string, st *SessionState) error {
+	var stored int64
+	err := tx.QueryRowContext(ctx, s.dialect.rebind(`SELECT fencing_token FROM agent_sessions WHERE session_id = ?`), key).Scan(&stored)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("save session: %w", err)
+	}
+	if err := checkFence(ctx, st.SessionID, stored); err != nil {
+		return err
+	}
+	return versionConflict(st.SessionID, st.Version)
+}
+
+// keepSnapshot copies the row at version into agent_session_snapshots and drops
+// snapshots beyond the history limit. It runs before the compare-and-set update,
+// whose failure rolls it back.
+func (s *SQLStore) keepSnapshot(ctx context.Context, tx *sql.Tx, key string, version int64) error {
+	if s.history > 0 {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`
+			INSERT INTO agent_session_snapshots (session_id, version, state)
+			SELECT session_id, version, state FROM agent_sessions WHERE session_id = ? AND version = ?`),
+			key, version,
+		); err != nil {
+			return fmt.Errorf("keep snapshot: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.dialect.rebind(`
+		DELETE FROM agent_session_snapshots WHERE session_id = ? AND version <= ?`),
+		key, version-int64(s.history),
+	); err != nil {
+		return fmt.Errorf("prune snapshots: %w", err)
+	}
+	return nil
+}
+
+// appendEvents writes the pending goal events and drops those before the
+// checkpoint the event limit trims to. A first save may have replaced an expired session, whose log and
+// snapshots are dropped first.
+func (s *SQLStore) appendEvents(ctx context.Context, tx *sql.Tx, key string, st *SessionState, events [][]byte) error {
+	if st.Version == 0 {
+		for _, table := range []string{"agent_goal_events", "agent_session_snapshots"} {
+			if _, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM `+table+` WHERE session_id = ?`), key); err != nil {
+				return fmt.Errorf("clear %s: %w", table, err)
+			}
+		}
+	}
+	for i, e := range st.pendingEvents {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`
+			INSERT INTO agent_goal_events (session_id, seq, turn, event_type, goal_id, at, event)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			key, e.Seq, e.Turn, string(e.Type), e.GoalID, s.dialect.timeValue(e.At), string(events[i]),
+		); err != nil {
+			return fmt.Errorf("append goal event %d: %w", e.Seq, err)
+		}
+	}
+	if keep := eventTrimSeq(st.EventSeq, s.events); keep > 1 && len(st.pendingEvents) > 0 {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`
+			DELETE FROM agent_goal_events WHERE session_id = ? AND seq < ?`),
+			key, keep,
+		); err != nil {
+			return fmt.Errorf("trim goal events: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]GoalEvent, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.requireLive(ctx, key); err != nil {
+		return nil, err
+	}
+
+	query, args := `SELECT event FROM agent_goal_events WHERE session_id = ? AND seq > ? ORDER BY seq`, []any{key, afterSeq}
+	if limit > 0 {
+		query, args = query+` LIMIT ?`, append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("load goal events: %w", err)
+	}
+	defer rows.Close()
+
+	var raw [][]byte
+	for rows.Next() {
+		var e string
+		if err := rows.Scan(&e); err != nil {
+			return nil, fmt.Errorf("scan goal event: %w", err)
+		}
+		raw = append(raw, []byte(e))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load goal events: %w", err)
+	}
+	return decodeGoalEvents(raw, afterSeq, limit)
+}
+
+func (s *SQLStore) Snapshots(ctx context.Context, sessionID string) ([]*SessionState, error) {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireLive(ctx, key); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT state FROM agent_session_snapshots WHERE session_id = ? ORDER BY version DESC`),
+		key,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var raw [][]byte
+	for rows.Next() {
+		var state string
+		if err := rows.Scan(&state); err != nil {
+			return nil, fmt.Errorf("scan snapshot: %w", err)
+		}
+		raw = append(raw, []byte(state))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load snapshots: %w", err)
+	}
+	return decodeSnapshots(raw)
+}
+
+// requireLive returns ErrStateNotFound unless key is a live session.
+func (s *SQLStore) requireLive(ctx context.Context, key string) error {
+	var live int
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT COUNT(*) FROM agent_sessions
+		WHERE session_id = ? AND (expires_at IS NULL OR expires_at > ?)`),
+		key, s.dialect.timeValue(s.now()),
+	).Scan(&live)
+	if err != nil {
+		return fmt.Errorf("check session: %w", err)
+	}
+	if live == 0 {
+		return ErrStateNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) projectGoals(ctx context.Context, tx *sql.Tx, key string, st *SessionState) error {
+	if _, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM agent_goals WHERE session_id = ?`), key); err != nil {
+		return fmt.Errorf("clear goal projection: %w", err)
+	}
+	for id, g := range st.Goals {
+		if g == nil {
+			continue
+		}
+		updatedAt := g.UpdatedAt
+		if updatedAt.IsZero() {
+			updatedAt = st.UpdatedAt
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`
+			INSERT INTO agent_goals (session_id, workspace_id, goal_id, goal_type, status, priority, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			key, st.WorkspaceID, id, g.Type, string(g.Status), g.Priority, s.dialect.timeValue(updatedAt),
+		); err != nil {
+			return fmt.Errorf("project goal %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, sessionID string) error {
+	key, err := sessionKey(sessionID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"agent_goals", "agent_goal_events", "agent_session_snapshots", "agent_sessions"} {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM `+table+` WHERE session_id = ?`), key); err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit delete: %w", err)
+	}
+	return nil
+}
+
+// ListSessions returns live sessions, most recently updated first.
+func (s *SQLStore) ListSessions(ctx context.Context, q SessionQuery) ([]SessionSummary, error) {
+	where := []string{"(expires_at IS NULL OR expires_at > ?)"}
+	args := []any{s.dialect.timeValue(s.now())}
+	for _, f := range []struct {
+		column string
+		value  string
+	}{
+		{"workspace_id", q.WorkspaceID},
+		{"customer_id", q.CustomerID},
+		{"channel_type", q.ChannelType},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+
+	query := `SELECT session_id, workspace_id, customer_id, channel_type, version, updated_at, expires_at
+		FROM agent_sessions WHERE ` + strings.Join(where, " AND ") + ` ORDER BY updated_at DESC, session_id`
+	query, args = appendPage(query, args, q.Limit, q.Offset)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []SessionSummary
+	for rows.Next() {
+		var (
+			sum       SessionSummary
+			updatedAt any
+			expiresAt any
+		)
+		if err := rows.Scan(&sum.SessionID, &sum.WorkspaceID, &sum.CustomerID, &sum.ChannelType, &sum.Version, &updatedAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		if sum.UpdatedAt, err = s.dialect.scanTime(updatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt != nil {
+			t, err := s.dialect.scanTime(expiresAt)
+			if err != nil {
+				return nil, err
+			}
+			sum.ExpiresAt = &t
+		}
+		out = append(out, sum)
+	}
+	return out, rows.Err()
+}
+
+// ScanSessionIDs visits live sessions in id order, one page at a time so the
+// callback may write to the store.
+func (s *SQLStore) ScanSessionIDs(ctx context.Context, fn func(sessionID string) error) error {
+	const pageSize = 200
+	after := ""
+	for {
+		rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+			SELECT session_id FROM agent_sessions
+			WHERE session_id > ? AND (expires_at IS NULL OR expires_at > ?)
+			ORDER BY session_id LIMIT ?`),
+			after, s.dialect.timeValue(s.now()), pageSize,
+		)
+		if err != nil {
+			return fmt.Errorf("scan sessions: %w", err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan session id: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("scan sessions: %w", err)
+		}
+
+		for _, id := range ids {
+			if err := fn(id); err != nil {
+				return err
+			}
+		}
+		if len(ids) < pageSize {
+			return nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// QueryGoals returns goals of live sessions, highest priority first.
+func (s *SQLStore) QueryGoals(ctx context.Context, q GoalQuery) ([]GoalRecord, error) {
+	where, args := s.goalFilter(q)
+	query := `SELECT g.session_id, g.workspace_id, g.goal_id, g.goal_type, g.status, g.priority, g.updated_at
+		FROM agent_goals g JOIN agent_sessions s ON s.session_id = g.session_id
+		WHERE ` + where + ` ORDER BY g.priority DESC, g.updated_at DESC, g.session_id, g.goal_id`
+	query, args = appendPage(query, args, q.Limit, q.Offset)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query goals: %w", err)
+	}
+	defer rows.Close()
+
+	var out []GoalRecord
+	for rows.Next() {
+		var (
+			rec       GoalRecord
+			status    string
+			updatedAt any
+		)
+		if err := rows.Scan(&rec.SessionID, &rec.WorkspaceID, &rec.GoalID, &rec.Type, &status, &rec.Priority, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scan goal: %w", err)
+		}
+		rec.Status = GoalStatus(status)
+		if rec.UpdatedAt, err = s.dialect.scanTime(updatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// CountGoals counts goals of live sessions matching q (Limit/Offset are ignored).
+func (s *SQLStore) CountGoals(ctx context.Context, q GoalQuery) (int, error) {
+	where, args := s.goalFilter(q)
+	var n int
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT COUNT(*) FROM agent_goals g JOIN agent_sessions s ON s.session_id = g.session_id
+		WHERE `+where), args...).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count goals: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLStore) goalFilter(q GoalQuery) (string, []any) {
+	where := []string{"(s.expires_at IS NULL OR s.expires_at > ?)"}
+	args := []any{s.dialect.timeValue(s.now())}
+	if q.WorkspaceID != "" {
+		where = append(where, "g.workspace_id = ?")
+		args = append(args, q.WorkspaceID)
+	}
+	if q.SessionID != "" {
+		where = append(where, "g.session_id = ?")
+		args = append(args, strings.TrimSpace(q.SessionID))
+	}
+	if q.TypePrefix != "" {
+		where = append(where, "g.goal_type LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLike(q.TypePrefix)+"%")
+	}
+	if len(q.Statuses) > 0 {
+		marks := make([]string, len(q.Statuses))
+		for i, st := range q.Statuses {
+			marks[i] = "?"
+			args = append(args, string(st))
+		}
+		where = append(where, "g.status IN ("+strings.Join(marks, ", ")+")")
+	}
+	if !q.UpdatedAfter.IsZero() {
+		where = append(where, "g.updated_at > ?")
+		args = append(args, s.dialect.timeValue(q.UpdatedAfter))
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// PurgeExpired deletes expired sessions with their goals, events and
+// snapshots. Load and Save already ignore expired rows; this only reclaims space.
+func (s *SQLStore) PurgeExpired(ctx context.Context) (int64, error) {
+	now := s.dialect.timeValue(s.now())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"agent_goals", "agent_goal_events", "agent_session_snapshots"} {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`
+			DELETE FROM `+table+` WHERE session_id IN (
+				SELECT session_id FROM agent_sessions WHERE expires_at IS NOT NULL AND expires_at <= ?)`), now); err != nil {
+			return 0, fmt.Errorf("purge %s: %w", table, err)
+		}
+	}
+	res, err := tx.ExecContext(ctx, s.dialect.rebind(`
+		DELETE FROM agent_sessions WHERE expires_at IS NOT NULL AND expires_at <= ?`), now)
+	if err != nil {
+		return 0, fmt.Errorf("purge sessions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit purge: %w", err)
+	}
+	return n, nil
+}
+
+// PurgeExpiredEvery runs PurgeExpired on interval until ctx is done.
+func (s *SQLStore) PurgeExpiredEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func appendPage(query string, args []any, limit, offset int) (string, []any) {
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+		if offset > 0 {
+			query += " OFFSET ?"
+			args = append(args, offset)
+		}
+	}
+	return query, args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
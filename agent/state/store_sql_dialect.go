@@ -0,0 +1,204 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlTimeLayout is fixed-width so SQLite can compare timestamps as text.
+const sqlTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+type sqlDialect struct {
+	name   string
+	driver string
+	// numbered placeholders ($1, $2) instead of "?"
+	numbered bool
+	// singleWriter limits the pool to one connection.
+	singleWriter bool
+	// textTime stores timestamps as sqlTimeLayout text.
+	textTime   bool
+	migrations []string
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"postgres": {
+		name:     "postgres",
+		driver:   "pgx",
+		numbered: true,
+		migrations: []string{
+			`CREATE TABLE IF NOT EXISTS agent_sessions (
+				session_id   TEXT PRIMARY KEY,
+				workspace_id TEXT NOT NULL,
+				customer_id  TEXT NOT NULL,
+				channel_type TEXT NOT NULL,
+				version      BIGINT NOT NULL,
+				state        JSONB NOT NULL,
+				updated_at   TIMESTAMPTZ NOT NULL,
+				expires_at   TIMESTAMPTZ
+			);
+			CREATE INDEX IF NOT EXISTS agent_sessions_expires_at_idx ON agent_sessions (expires_at);
+			CREATE INDEX IF NOT EXISTS agent_sessions_workspace_idx ON agent_sessions (workspace_id, updated_at);
+			CREATE TABLE IF NOT EXISTS agent_goals (
+				session_id   TEXT NOT NULL,
+				workspace_id TEXT NOT NULL,
+				goal_id      TEXT NOT NULL,
+				goal_type    TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				priority     INTEGER NOT NULL,
+				updated_at   TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (session_id, goal_id)
+			);
+			CREATE INDEX IF NOT EXISTS agent_goals_type_status_idx ON agent_goals (goal_type, status);`,
+			`CREATE TABLE IF NOT EXISTS agent_goal_events (
+				session_id TEXT NOT NULL,
+				seq        BIGINT NOT NULL,
+				turn       INTEGER NOT NULL,
+				event_type TEXT NOT NULL,
+				goal_id    TEXT NOT NULL,
+				at         TIMESTAMPTZ NOT NULL,
+				event      JSONB NOT NULL,
+				PRIMARY KEY (session_id, seq)
+			);`,
+			`CREATE TABLE IF NOT EXISTS agent_session_snapshots (
+				session_id TEXT NOT NULL,
+				version    BIGINT NOT NULL,
+				state      JSONB NOT NULL,
+				PRIMARY KEY (session_id, version)
+			);`,
+			`ALTER TABLE agent_sessions ADD COLUMN fencing_token BIGINT NOT NULL DEFAULT 0;`,
+		},
+	},
+	"sqlite": {
+		name:         "sqlite",
+		driver:       "sqlite",
+		singleWriter: true,
+		textTime:     true,
+		migrations: []string{
+			`CREATE TABLE IF NOT EXISTS agent_sessions (
+				session_id   TEXT PRIMARY KEY,
+				workspace_id TEXT NOT NULL,
+				customer_id  TEXT NOT NULL,
+				channel_type TEXT NOT NULL,
+				version      INTEGER NOT NULL,
+				state        TEXT NOT NULL,
+				updated_at   TEXT NOT NULL,
+				expires_at   TEXT
+			);
+			CREATE INDEX IF NOT EXISTS agent_sessions_expires_at_idx ON agent_sessions (expires_at);
+			CREATE INDEX IF NOT EXISTS agent_sessions_workspace_idx ON agent_sessions (workspace_id, updated_at);
+			CREATE TABLE IF NOT EXISTS agent_goals (
+				session_id   TEXT NOT NULL,
+				workspace_id TEXT NOT NULL,
+				goal_id      TEXT NOT NULL,
+				goal_type    TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				priority     INTEGER NOT NULL,
+				updated_at   TEXT NOT NULL,
+				PRIMARY KEY (session_id, goal_id)
+			);
+			CREATE INDEX IF NOT EXISTS agent_goals_type_status_idx ON agent_goals (goal_type, status);`,
+			`CREATE TABLE IF NOT EXISTS agent_goal_events (
+				session_id TEXT NOT NULL,
+				seq        INTEGER NOT NULL,
+				turn       INTEGER NOT NULL,
+				event_type TEXT NOT NULL,
+				goal_id    TEXT NOT NULL,
+				at         TEXT NOT NULL,
+				event      TEXT NOT NULL,
+				PRIMARY KEY (session_id, seq)
+			);`,
+			`CREATE TABLE IF NOT EXISTS agent_session_snapshots (
+				session_id TEXT NOT NULL,
+				version    INTEGER NOT NULL,
+				state      TEXT NOT NULL,
+				PRIMARY KEY (session_id, version)
+			);`,
+			`ALTER TABLE agent_sessions ADD COLUMN fencing_token INTEGER NOT NULL DEFAULT 0;`,
+		},
+	},
+}
+
+func sqlDialectFor(name string) (sqlDialect, error) {
+	d, ok := sqlDialects[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return sqlDialect{}, fmt.Errorf("unsupported sql dialect %q", name)
+	}
+	return d, nil
+}
+
+// rebind rewrites "?" placeholders for dialects with numbered parameters.
+func (d sqlDialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (d sqlDialect) timeValue(t time.Time) any {
+	if d.textTime {
+		return t.UTC().Format(sqlTimeLayout)
+	}
+	return t.UTC()
+}
+
+func (d sqlDialect) scanTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC(), nil
+	case string:
+		return time.Parse(sqlTimeLayout, t)
+	case []byte:
+		return time.Parse(sqlTimeLayout, string(t))
+	default:
+		return time.Time{}, fmt.Errorf("unexpected time value %T", v)
+	}
+}
+
+// migrate applies the dialect migrations not yet recorded in agent_schema_migrations.
+func (s *SQLStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS agent_schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	var applied int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM agent_schema_migrations`).Scan(&applied); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := applied; i < len(s.dialect.migrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin migration %d: %w", i+1, err)
+		}
+		for _, stmt := range strings.Split(s.dialect.migrations[i], ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("apply migration %d: %w", i+1, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO agent_schema_migrations (version) VALUES (?)`), i+1); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package state_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
+	"github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state/statetest"
+)
+
+func TestSQLiteStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		return newSQLiteStore(t, append(opts, statex.WithTTL(ttl))...)
+	})
+}
+
+// TestPostgresStoreConformance runs the suite against PostgreSQL when
+// STATE_TEST_POSTGRES_DSN is set. Tables are shared, so sessions use unique ids.
+func TestPostgresStoreConformance(t *testing.T) {
+	dsn := os.Getenv("STATE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("STATE_TEST_POSTGRES_DSN not set")
+	}
+
+	statetest.RunStoreSuite(t, func(t *testing.T, ttl time.Duration, opts ...statex.StoreOption) statex.Store {
+		store, err := statex.OpenSQLStore(context.Background(), statex.SQLConfig{Dialect: "postgres", DSN: dsn}, append(opts, statex.WithTTL(ttl))...)
+		if err != nil {
+			t.Fatalf("OpenSQLStore() error = %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	})
+}
+
+func TestSQLStoreQueriesGoalProjection(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLiteStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	seed := func(sessionID, workspaceID string, goals ...*statex.Goal) {
+		t.Helper()
+		st := statex.NewSessionState(sessionID, workspaceID, "cust-"+sessionID, "chat", now)
+		for _, g := range goals {
+			if err := st.AddGoal(g); err != nil {
+				t.Fatalf("AddGoal() error = %v", err)
+			}
+		}
+		if err := store.Save(ctx, st); err != nil {
+			t.Fatalf("Save(%s) error = %v", sessionID, err)
+		}
+	}
+
+	blocked := func(id, goalType string, priority int) *statex.Goal {
+		g := statex.CreateGoal(id, goalType, priority, now)
+		g.Status = statex.GoalBlocked
+		g.Missing = []string{"device_model"}
+		g.NextQuestion = "รุ่นอะไรครับ"
+		return g
+	}
+
+	seed("s1", "ws-a",
+		blocked("g1", "support.troubleshoot", 60),
+		statex.CreateGoal("g2", "sales.recommend_item", 50, now),
+	)
+	seed("s2", "ws-a", blocked("g3", "support.warranty", 70))
+	seed("s3", "ws-b", blocked("g4", "support.troubleshoot", 40))
+
+	n, err := store.CountGoals(ctx, statex.GoalQuery{TypePrefix: "support.", Statuses: []statex.GoalStatus{statex.GoalBlocked}})
+	if err != nil {
+		t.Fatalf("CountGoals() error = %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("blocked support goals = %d, want 3", n)
+	}
+
+	goals, err := store.QueryGoals(ctx, statex.GoalQuery{WorkspaceID: "ws-a", TypePrefix: "support."})
+	if err != nil {
+		t.Fatalf("QueryGoals() error = %v", err)
+	}
+	if len(goals) != 2 || goals[0].GoalID != "g3" || goals[1].GoalID != "g1" {
+		t.Fatalf("unexpected goals (want g3, g1 by priority): %+v", goals)
+	}
+
+	// Saving again replaces the projection rather than appending to it.
+	st, err := store.Load(ctx, "s1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	st.Goals["g1"].Status = statex.GoalDone
+	if err := store.Save(ctx, st); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if n, _ := store.CountGoals(ctx, statex.GoalQuery{TypePrefix: "support.", Statuses: []statex.GoalStatus{statex.GoalBlocked}}); n != 2 {
+		t.Fatalf("blocked support goals after update = %d, want 2", n)
+	}
+
+	sessions, err := store.ListSessions(ctx, statex.SessionQuery{WorkspaceID: "ws-a"})
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("sessions in ws-a = %d, want 2", len(sessions))
+	}
+
+	if err := store.Delete(ctx, "s2"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if n, _ := store.CountGoals(ctx, statex.GoalQuery{SessionID: "s2"}); n != 0 {
+		t.Fatalf("goals left for deleted session = %d", n)
+	}
+}
+
+func TestSQLStorePurgeExpired(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLiteStore(t, statex.WithTTL(statetest.ExpiryTTL))
+	ctx := context.Background()
+
+	st := statex.NewSessionState("s1", "ws", "cust", "chat", time.Now())
+	if err := st.AddGoal(statex.CreateGoal("g1", "support.troubleshoot", 50, time.Now())); err != nil {
+		t.Fatalf("AddGoal() error = %v", err)
+	}
+	if err := store.Save(ctx, st); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	time.Sleep(statetest.ExpiryTTL + 100*time.Millisecond)
+	if n, _ := store.CountGoals(ctx, statex.GoalQuery{}); n != 0 {
+		t.Fatalf("expired session goals still counted: %d", n)
+	}
+	purged, err := store.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("PurgeExpired() error = %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("purged = %d, want 1", purged)
+	}
+}
+
+func TestSQLStoreMigrationsAreIdempotent(t *testing.T) {
+	t.Parallel()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "sessions.db")
+	for i := 0; i < 2; i++ {
+		store, err := statex.OpenSQLStore(context.Background(), statex.SQLConfig{Dialect: "sqlite", DSN: dsn})
+		if err != nil {
+			t.Fatalf("OpenSQLStore() run %d error = %v", i+1, err)
+		}
+		_ = store.Close()
+	}
+}
+
+func newSQLiteStore(t *testing.T, opts ...statex.StoreOption) *statex.SQLStore {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "sessions.db") + "?_pragma=busy_timeout(5000)"
+	store, err := statex.OpenSQLStore(context.Background(), statex.SQLConfig{Dialect: "sqlite", DSN: dsn}, opts...)
+	if err != nil {
+		t.Fatalf("OpenSQLStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
@@ -13,40 +13,117 @@ import (
 	"time"
 )
 
-var (
-	ErrStateNotFound   = errors.New("session state not found")
-	ErrNilSessionState = errors.New("session state is nil")
-	ErrInvalidSession  = errors.New("session id is empty")
-)
-
+// Every key of a session hash-tags the session id, so the keys one script
+// touches share a Redis Cluster slot.
 const (
-	defaultStoreTTL      = 24 * time.Hour
 	maxResponseSizeBytes = 2 << 20
-	sessionStateRedisKey = "conv:%s:agent:session"
+	sessionStateRedisKey = "conv:{%s}:agent:session"
+	goalEventsRedisKey   = "conv:{%s}:agent:goal_events"
+	historyRedisKey      = "conv:{%s}:agent:history"
+
+	// The layout before hash tags. Sessions stored under it are moved to the
+	// tagged keys the first time they are read.
+	legacySessionStateRedisKey = "conv:%s:agent:session"
+	legacyGoalEventsRedisKey   = "conv:%s:agent:goal_events"
+	legacyHistoryRedisKey      = "conv:%s:agent:history"
 )
 
-// Store is the persistence contract used by the orchestrator.
-type Store interface {
-	Load(ctx context.Context, sessionID string) (*SessionState, error)
-	Save(ctx context.Context, st *SessionState) error
-	Delete(ctx context.Context, sessionID string) error
-}
-
-// StoreOption customizes UpstashRedisStore.
-type StoreOption func(*UpstashRedisStore)
-
-func WithTTL(ttl time.Duration) StoreOption {
-	return func(s *UpstashRedisStore) {
-		s.ttl = ttl
+// moveLegacyKeysScript renames the legacy keys KEYS[4..6] of a session to
+// KEYS[1..3], unless the session already exists under KEYS[1]. RENAME keeps
+// their TTL. Returns 1 when the session was moved. The legacy keys fall in
+// different cluster slots, but saves under them only ever succeeded on a
+// single node, so this only runs where legacy keys exist.
+const moveLegacyKeysScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[4]) == 0 then
+  return 0
+end
+for i = 1, 3 do
+  if redis.call('EXISTS', KEYS[i + 3]) == 1 then
+    redis.call('RENAME', KEYS[i + 3], KEYS[i])
+  end
+end
+return 1
+`
+
+// saveScript writes ARGV[2] to KEYS[1] only when the stored version equals
+// ARGV[1] (a missing key counts as version 0) and, for a fenced save, the
+// stored fencing token is not above ARGV[6]. On success the replaced document
+// is pushed onto the snapshot list KEYS[3] (trimmed to ARGV[4] entries) and
+// ARGV[7..] are appended to the goal event list KEYS[2], which is then trimmed
+// to start at seq ARGV[5] (1 keeps it all). A first save drops any leftover lists. Both
+// lists expire with the session. Returns 1 on success, 0 on conflict and -1
+// when a newer lease has saved.
+const saveScript = `
+local current = redis.call('GET', KEYS[1])
+local expected = tonumber(ARGV[1])
+local fence = tonumber(ARGV[6])
+local version = 0
+if current then
+  local doc = cjson.decode(current)
+  if fence > 0 and (tonumber(doc['fencing_token']) or 0) > fence then
+    return -1
+  end
+  version = tonumber(doc['version']) or 0
+end
+if version ~= expected then
+  return 0
+end
+local ttl = tonumber(ARGV[3])
+local history = tonumber(ARGV[4])
+if ttl > 0 then
+  redis.call('SET', KEYS[1], ARGV[2], 'EX', ttl)
+else
+  redis.call('SET', KEYS[1], ARGV[2])
+end
+if expected == 0 then
+  redis.call('DEL', KEYS[2], KEYS[3])
+end
+if current and history > 0 then
+  redis.call('LPUSH', KEYS[3], current)
+  redis.call('LTRIM', KEYS[3], 0, history - 1)
+elseif history <= 0 then
+  redis.call('DEL', KEYS[3])
+end
+local keep = tonumber(ARGV[5])
+if #ARGV > 6 then
+  redis.call('RPUSH', KEYS[2], unpack(ARGV, 7))
+  if keep > 1 then
+    local first = tonumber(cjson.decode(redis.call('LINDEX', KEYS[2], 0))['seq'])
+    if keep > first then
+      redis.call('LTRIM', KEYS[2], keep - first, -1)
+    end
+  end
+end
+for i = 2, 3 do
+  if ttl > 0 then
+    redis.call('EXPIRE', KEYS[i], ttl)
+  else
+    redis.call('PERSIST', KEYS[i])
+  end
+end
+return 1
+`
+
+// saveScriptCommand builds the EVAL command for saveScript.
+func saveScriptCommand(ctx context.Context, st *SessionState, payload []byte, ttl int64, history, eventLimit int) ([]any, error) {
+	keys, err := redisSessionKeys(st.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := encodePendingEvents(st)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func WithHTTPClient(client *http.Client) StoreOption {
-	return func(s *UpstashRedisStore) {
-		if client != nil {
-			s.httpClient = client
-		}
+	cmd := []any{"EVAL", saveScript, len(keys)}
+	for _, k := range keys {
+		cmd = append(cmd, k)
 	}
+	cmd = append(cmd, st.Version, string(payload), ttl, history, eventTrimSeq(st.EventSeq, eventLimit), fencingToken(ctx))
+	for _, e := range events {
+		cmd = append(cmd, string(e))
+	}
+	return cmd, nil
 }
 
 // UpstashRedisStore persists SessionState in Upstash Redis via REST.
@@ -55,6 +132,8 @@ type UpstashRedisStore struct {
 	token      string
 	httpClient *http.Client
 	ttl        time.Duration
+	history    int
+	events     int
 }
 
 type redisRESTResponse struct {
@@ -87,31 +166,25 @@ func NewUpstashRedisStore(cfg UpstashRedisConfig, opts ...StoreOption) (*Upstash
 		timeout = 10 * time.Second
 	}
 
-	store := &UpstashRedisStore{
-		baseURL: baseURL,
-		token:   token,
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
-		ttl: defaultStoreTTL,
-	}
-
-	for _, opt := range opts {
-		if opt != nil {
-			opt(store)
-		}
+	o, err := applyStoreOptions(opts)
+	if err != nil {
+		return nil, err
 	}
-
-	if store.httpClient == nil {
-		store.httpClient = &http.Client{
+	httpClient := o.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{
 			Timeout: timeout,
 		}
 	}
-	if store.ttl < 0 {
-		return nil, errors.New("ttl must be >= 0")
-	}
 
-	return store, nil
+	return &UpstashRedisStore{
+		baseURL:    baseURL,
+		token:      token,
+		httpClient: httpClient,
+		ttl:        o.ttl,
+		history:    o.history,
+		events:     o.events,
+	}, nil
 }
 
 func (s *UpstashRedisStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
@@ -127,7 +200,14 @@ func (s *UpstashRedisStore) Load(ctx context.Context, sessionID string) (*Sessio
 
 	result := bytes.TrimSpace(resp.Result)
 	if len(result) == 0 || bytes.Equal(result, []byte("null")) {
-		return nil, ErrStateNotFound
+		moved, err := s.moveLegacyKeys(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !moved {
+			return nil, ErrStateNotFound
+		}
+		return s.Load(ctx, sessionID)
 	}
 
 	var encoded string
@@ -135,70 +215,175 @@ func (s *UpstashRedisStore) Load(ctx context.Context, sessionID string) (*Sessio
 		return nil, fmt.Errorf("decode session payload: %w", err)
 	}
 
-	var state SessionState
-	if err := json.Unmarshal([]byte(encoded), &state); err != nil {
-		return nil, fmt.Errorf("unmarshal session state: %w", err)
-	}
-
-	state.EnsureGoalsMap()
-	if err := state.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid session state loaded from store: %w", err)
-	}
-
-	return &state, nil
+	return decodeSessionState([]byte(encoded))
 }
 
 func (s *UpstashRedisStore) Save(ctx context.Context, st *SessionState) error {
-	if st == nil {
-		return ErrNilSessionState
+	if err := prepareSave(ctx, st); err != nil {
+		return err
 	}
-	if strings.TrimSpace(st.SessionID) == "" {
-		return ErrInvalidSession
+
+	payload, err := encodeNextVersion(st)
+	if err != nil {
+		return err
 	}
-	st.EnsureGoalsMap()
-	if st.UpdatedAt.IsZero() {
-		st.UpdatedAt = time.Now().UTC()
-	} else {
-		st.UpdatedAt = st.UpdatedAt.UTC()
+
+	var ttl int64
+	if s.ttl > 0 {
+		ttl = ttlSeconds(s.ttl)
 	}
 
-	key, err := s.redisKey(st.SessionID)
+	cmd, err := saveScriptCommand(ctx, st, payload, ttl, s.history, s.events)
 	if err != nil {
 		return err
 	}
-
-	payload, err := json.Marshal(st)
+	resp, err := s.exec(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("marshal session state: %w", err)
+		return err
 	}
 
-	cmd := []any{"SET", key, string(payload)}
-	if s.ttl > 0 {
-		cmd = append(cmd, "EX", ttlSeconds(s.ttl))
+	var applied int
+	if err := json.Unmarshal(bytes.TrimSpace(resp.Result), &applied); err != nil {
+		return fmt.Errorf("decode save result: %w", err)
 	}
-
-	if _, err := s.exec(ctx, cmd); err != nil {
-		return err
+	switch applied {
+	case 1:
+	case -1:
+		return staleLease(ctx, st.SessionID)
+	default:
+		return versionConflict(st.SessionID, st.Version)
 	}
 
+	markSaved(st)
 	return nil
 }
 
 func (s *UpstashRedisStore) Delete(ctx context.Context, sessionID string) error {
-	key, err := s.redisKey(sessionID)
+	keys, err := redisSessionKeys(sessionID)
 	if err != nil {
 		return err
 	}
-	_, err = s.exec(ctx, []any{"DEL", key})
+	if _, err := s.moveLegacyKeys(ctx, sessionID); err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, []any{"DEL", keys[0], keys[1], keys[2]})
 	return err
 }
 
-func (s *UpstashRedisStore) redisKey(sessionID string) (string, error) {
-	trimmedSessionID := strings.TrimSpace(sessionID)
-	if trimmedSessionID == "" {
-		return "", ErrInvalidSession
+// GoalEvents reads only the requested page of the event list: the seq of its
+// first entry locates afterSeq.
+func (s *UpstashRedisStore) GoalEvents(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]GoalEvent, error) {
+	firstSeq := int64(1)
+	if afterSeq > 0 {
+		head, err := s.liveList(ctx, sessionID, 1, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if firstSeq, err = firstEventSeq(head); err != nil {
+			return nil, err
+		}
+	}
+	start, stop := eventRange(firstSeq, afterSeq, limit)
+	raw, err := s.liveList(ctx, sessionID, 1, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	return decodeGoalEvents(raw, afterSeq, limit)
+}
+
+func (s *UpstashRedisStore) Snapshots(ctx context.Context, sessionID string) ([]*SessionState, error) {
+	raw, err := s.liveList(ctx, sessionID, 2, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSnapshots(raw)
+}
+
+// liveList reads entries start..stop of the list redisSessionKeys(sessionID)[idx]
+// of a live session.
+func (s *UpstashRedisStore) liveList(ctx context.Context, sessionID string, idx int, start, stop int64) ([][]byte, error) {
+	keys, err := redisSessionKeys(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.exec(ctx, []any{"EXISTS", keys[0]})
+	if err != nil {
+		return nil, err
+	}
+	if string(bytes.TrimSpace(resp.Result)) == "0" {
+		moved, err := s.moveLegacyKeys(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !moved {
+			return nil, ErrStateNotFound
+		}
+	}
+
+	resp, err = s.exec(ctx, []any{"LRANGE", keys[idx], start, stop})
+	if err != nil {
+		return nil, err
 	}
-	return fmt.Sprintf(sessionStateRedisKey, trimmedSessionID), nil
+	var items []string
+	if err := json.Unmarshal(resp.Result, &items); err != nil {
+		return nil, fmt.Errorf("decode list %s: %w", keys[idx], err)
+	}
+	raw := make([][]byte, len(items))
+	for i, item := range items {
+		raw[i] = []byte(item)
+	}
+	return raw, nil
+}
+
+func (s *UpstashRedisStore) ScanSessionIDs(ctx context.Context, fn func(sessionID string) error) error {
+	cursor := "0"
+	for {
+		resp, err := s.exec(ctx, []any{"SCAN", cursor, "MATCH", sessionScanPattern, "COUNT", 200})
+		if err != nil {
+			return err
+		}
+		var page []json.RawMessage
+		if err := json.Unmarshal(resp.Result, &page); err != nil || len(page) != 2 {
+			return fmt.Errorf("decode scan result: %s", string(resp.Result))
+		}
+		var keys []string
+		if err := json.Unmarshal(page[0], &cursor); err != nil {
+			return fmt.Errorf("decode scan cursor: %w", err)
+		}
+		if err := json.Unmarshal(page[1], &keys); err != nil {
+			return fmt.Errorf("decode scan keys: %w", err)
+		}
+
+		if err := visitSessionKeys(keys, fn); err != nil {
+			return err
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// moveLegacyKeys moves a session stored under the legacy key layout to the
+// current one and reports whether there was one to move.
+func (s *UpstashRedisStore) moveLegacyKeys(ctx context.Context, sessionID string) (bool, error) {
+	keys, legacy, err := redisSessionKeyLayouts(sessionID)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.exec(ctx, []any{"EXISTS", legacy[0]})
+	if err != nil {
+		return false, err
+	}
+	if string(bytes.TrimSpace(resp.Result)) == "0" {
+		return false, nil
+	}
+	moved, err := s.evalInt(ctx, moveLegacyKeysScript, append(keys, legacy...))
+	return moved == 1, err
+}
+
+func (s *UpstashRedisStore) redisKey(sessionID string) (string, error) {
+	return redisSessionKey(sessionID)
 }
 
 func (s *UpstashRedisStore) exec(ctx context.Context, command []any) (*redisRESTResponse, error) {
@@ -19,8 +19,8 @@ func TestUpstashRedisStoreRedisKey(t *testing.T) {
 	if err != nil {
 		t.Fatalf("redisKey() error = %v", err)
 	}
-	if got != "conv:abc:agent:session" {
-		t.Fatalf("redisKey() = %q, want %q", got, "conv:abc:agent:session")
+	if got != "conv:{abc}:agent:session" {
+		t.Fatalf("redisKey() = %q, want %q", got, "conv:{abc}:agent:session")
 	}
 }
 
@@ -37,7 +37,7 @@ func TestUpstashRedisStoreRedisKeyEmptySession(t *testing.T) {
 func TestUpstashRedisStoreSaveUsesHardcodedSessionKey(t *testing.T) {
 	t.Parallel()
 
-	const wantKey = "conv:session-1:agent:session"
+	const wantKey = "conv:{session-1}:agent:session"
 	var gotCommand []any
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -45,7 +45,7 @@ func TestUpstashRedisStoreSaveUsesHardcodedSessionKey(t *testing.T) {
 		if err := json.NewDecoder(r.Body).Decode(&gotCommand); err != nil {
 			t.Fatalf("decode command: %v", err)
 		}
-		fmt.Fprint(w, `{"result":"OK"}`)
+		fmt.Fprint(w, `{"result":1}`)
 	}))
 	t.Cleanup(server.Close)
 
@@ -66,21 +66,60 @@ func TestUpstashRedisStoreSaveUsesHardcodedSessionKey(t *testing.T) {
 		t.Fatalf("Save() error = %v", err)
 	}
 
-	if len(gotCommand) < 2 {
+	if len(gotCommand) < 10 {
 		t.Fatalf("unexpected command: %#v", gotCommand)
 	}
-	if gotCommand[0] != "SET" {
-		t.Fatalf("command[0] = %v, want SET", gotCommand[0])
+	if gotCommand[0] != "EVAL" {
+		t.Fatalf("command[0] = %v, want EVAL", gotCommand[0])
 	}
-	if gotCommand[1] != wantKey {
-		t.Fatalf("command[1] = %v, want %s", gotCommand[1], wantKey)
+	if gotCommand[3] != wantKey {
+		t.Fatalf("command[3] = %v, want %s", gotCommand[3], wantKey)
+	}
+	if gotCommand[4] != "conv:{session-1}:agent:goal_events" {
+		t.Fatalf("command[4] = %v, want the goal events key", gotCommand[4])
+	}
+	if gotCommand[6] != float64(0) {
+		t.Fatalf("expected version = %v, want 0", gotCommand[6])
+	}
+	if state.Version != 1 {
+		t.Fatalf("Version after Save = %d, want 1", state.Version)
+	}
+}
+
+func TestUpstashRedisStoreSaveReturnsVersionConflict(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":0}`)
+	}))
+	t.Cleanup(server.Close)
+
+	store, err := NewUpstashRedisStore(
+		UpstashRedisConfig{
+			URL:   server.URL,
+			Token: "token",
+		},
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewUpstashRedisStore() error = %v", err)
+	}
+
+	state := NewSessionState("session-4", "ws", "cust", "chat", time.Now().UTC())
+	state.Version = 3
+	err = store.Save(context.Background(), state)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Save() error = %v, want ErrVersionConflict", err)
+	}
+	if state.Version != 3 {
+		t.Fatalf("Version after conflict = %d, want 3", state.Version)
 	}
 }
 
 func TestUpstashRedisStoreLoadUsesHardcodedSessionKey(t *testing.T) {
 	t.Parallel()
 
-	const wantKey = "conv:session-2:agent:session"
+	const wantKey = "conv:{session-2}:agent:session"
 	var gotCommand []any
 
 	seed := NewSessionState("session-2", "ws", "cust", "chat", time.Now().UTC())
@@ -135,7 +174,7 @@ func TestUpstashRedisStoreLoadUsesHardcodedSessionKey(t *testing.T) {
 func TestUpstashRedisStoreDeleteUsesHardcodedSessionKey(t *testing.T) {
 	t.Parallel()
 
-	const wantKey = "conv:session-3:agent:session"
+	const wantKey = "conv:{session-3}:agent:session"
 	var gotCommand []any
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type TranscriptRole string
+
+const (
+	TranscriptRoleUser      TranscriptRole = "user"
+	TranscriptRoleAssistant TranscriptRole = "assistant"
+)
+
+// TranscriptEntry is one utterance in the conversation, attributed to the goal
+// that handled the turn. Rewound entries belong to turns undone by RewindTo.
+type TranscriptEntry struct {
+	Turn    int            `json:"turn"`
+	Role    TranscriptRole `json:"role"`
+	Text    string         `json:"text"`
+	GoalID  string         `json:"goal_id,omitempty"`
+	At      time.Time      `json:"at"`
+	Rewound bool           `json:"rewound,omitempty"`
+}
+
+// BeginTurn advances the session turn counter and returns the new turn number.
+func (s *SessionState) BeginTurn() int {
+	s.Turn++
+	return s.Turn
+}
+
+// AppendTranscript appends non-empty entries to the transcript.
+func (s *SessionState) AppendTranscript(entries ...TranscriptEntry) {
+	for _, e := range entries {
+		if strings.TrimSpace(e.Text) == "" {
+			continue
+		}
+		e.At = e.At.UTC()
+		s.Transcript = append(s.Transcript, e)
+	}
+}
+
+// SplitTranscript cuts the transcript so that at most keep entries remain,
+// never splitting a turn. It returns the removed (older) entries.
+func (s *SessionState) SplitTranscript(keep int) []TranscriptEntry {
+	if keep < 0 {
+		keep = 0
+	}
+	if len(s.Transcript) <= keep {
+		return nil
+	}
+	cut := len(s.Transcript) - keep
+	for cut < len(s.Transcript) && s.Transcript[cut].Turn == s.Transcript[cut-1].Turn {
+		cut++
+	}
+	older := append([]TranscriptEntry(nil), s.Transcript[:cut]...)
+	s.Transcript = append([]TranscriptEntry(nil), s.Transcript[cut:]...)
+	return older
+}
+
+// TranscriptTokens estimates the token size of the stored transcript.
+func (s *SessionState) TranscriptTokens() int {
+	total := 0
+	for _, e := range s.Transcript {
+		total += EstimateTokens(e.Text)
+	}
+	return total
+}
+
+// TrimTranscript returns the most recent entries that fit both budgets, oldest first.
+// A budget <= 0 is treated as unlimited.
+func TrimTranscript(entries []TranscriptEntry, maxEntries int, maxTokens int) []TranscriptEntry {
+	start := len(entries)
+	tokens := 0
+	for start > 0 {
+		if maxEntries > 0 && len(entries)-start >= maxEntries {
+			break
+		}
+		cost := EstimateTokens(entries[start-1].Text)
+		if maxTokens > 0 && tokens+cost > maxTokens {
+			break
+		}
+		tokens += cost
+		start--
+	}
+	if start == len(entries) {
+		return nil
+	}
+	return entries[start:]
+}
+
+// EstimateTokens is a cheap token estimate (~4 characters per token) used for
+// prompt budgeting. It is intentionally approximate.
+func EstimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
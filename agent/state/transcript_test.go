@@ -0,0 +1,69 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitTranscriptKeepsMostRecentTurns(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "ws", "cust", "chat", now)
+	for i := 1; i <= 3; i++ {
+		turn := st.BeginTurn()
+		st.AppendTranscript(
+			TranscriptEntry{Turn: turn, Role: TranscriptRoleUser, Text: "question", At: now},
+			TranscriptEntry{Turn: turn, Role: TranscriptRoleAssistant, Text: "answer", At: now},
+		)
+	}
+
+	if st.Turn != 3 {
+		t.Fatalf("Turn = %d, want 3", st.Turn)
+	}
+
+	// keep=3 would split turn 2, so the whole of turn 2 is cut as well.
+	older := st.SplitTranscript(3)
+	if len(older) != 4 || older[3].Turn != 2 {
+		t.Fatalf("unexpected removed entries: %+v", older)
+	}
+	if len(st.Transcript) != 2 || st.Transcript[0].Turn != 3 {
+		t.Fatalf("unexpected kept entries: %+v", st.Transcript)
+	}
+	if got := st.SplitTranscript(2); got != nil {
+		t.Fatalf("expected nothing removed, got %+v", got)
+	}
+}
+
+func TestAppendTranscriptSkipsEmptyText(t *testing.T) {
+	t.Parallel()
+
+	st := NewSessionState("s1", "ws", "cust", "chat", time.Now())
+	st.AppendTranscript(TranscriptEntry{Turn: 1, Role: TranscriptRoleUser, Text: "   "})
+	if len(st.Transcript) != 0 {
+		t.Fatalf("expected empty transcript, got %d entries", len(st.Transcript))
+	}
+}
+
+func TestTrimTranscriptRespectsBudgets(t *testing.T) {
+	t.Parallel()
+
+	entries := []TranscriptEntry{
+		{Turn: 1, Text: "aaaaaaaa"}, // 2 tokens
+		{Turn: 2, Text: "bbbbbbbb"},
+		{Turn: 3, Text: "cccccccc"},
+	}
+
+	if got := TrimTranscript(entries, 2, 0); len(got) != 2 || got[0].Turn != 2 {
+		t.Fatalf("entry budget: unexpected result %+v", got)
+	}
+	if got := TrimTranscript(entries, 0, 5); len(got) != 2 || got[0].Turn != 2 {
+		t.Fatalf("token budget: unexpected result %+v", got)
+	}
+	if got := TrimTranscript(entries, 0, 1); got != nil {
+		t.Fatalf("expected nil when newest entry exceeds budget, got %+v", got)
+	}
+	if got := TrimTranscript(entries, 0, 0); len(got) != 3 {
+		t.Fatalf("unlimited: expected all entries, got %d", len(got))
+	}
+}
@@ -0,0 +1,171 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Transition is one goal status change. From is "" for a goal that has no
+// status yet.
+type Transition struct {
+	GoalID string
+	From   GoalStatus
+	To     GoalStatus
+	At     time.Time
+}
+
+// TransitionGuard vetoes entering a status. It sees the goal as it will be
+// after the transition, apart from Status.
+type TransitionGuard func(g *Goal) error
+
+// TransitionHook runs around an allowed transition. A before-hook error aborts
+// the transition; an after-hook error is returned after the status has changed.
+type TransitionHook func(s *SessionState, t Transition) error
+
+// GoalMachine is the goal status state machine: which transitions are allowed,
+// the guards for entering a status and the hooks around each transition. Every
+// status change of a session goal goes through it.
+type GoalMachine struct {
+	table  map[GoalStatus][]GoalStatus
+	guards map[GoalStatus][]TransitionGuard
+	before []TransitionHook
+	after  []TransitionHook
+}
+
+// NewGoalMachine returns the default machine:
+//
+//	(new)     -> active, blocked, suspended, done, cancelled
+//	active    -> blocked, suspended, done, cancelled
+//	blocked   -> active, suspended, done, cancelled
+//	suspended -> active, blocked, done, cancelled
+//	done      -> (terminal)
+//	cancelled -> (terminal)
+//
+// Entering blocked requires Missing and NextQuestion.
+func NewGoalMachine() *GoalMachine {
+	m := &GoalMachine{
+		table: map[GoalStatus][]GoalStatus{
+			"":            {GoalActive, GoalBlocked, GoalSuspended, GoalDone, GoalCancelled},
+			GoalActive:    {GoalBlocked, GoalSuspended, GoalDone, GoalCancelled},
+			GoalBlocked:   {GoalActive, GoalSuspended, GoalDone, GoalCancelled},
+			GoalSuspended: {GoalActive, GoalBlocked, GoalDone, GoalCancelled},
+			GoalDone:      nil,
+			GoalCancelled: nil,
+		},
+		guards: make(map[GoalStatus][]TransitionGuard),
+	}
+	m.Guard(GoalBlocked, requireQuestion)
+	return m
+}
+
+// defaultGoalMachine is used by sessions without their own machine. It is never
+// modified; callers that need extra guards or hooks build their own.
+var defaultGoalMachine = NewGoalMachine()
+
+// Guard adds a guard for entering status to.
+func (m *GoalMachine) Guard(to GoalStatus, guard TransitionGuard) {
+	m.guards[to] = append(m.guards[to], guard)
+}
+
+// BeforeTransition adds a hook that runs after the guards pass and before the
+// status changes.
+func (m *GoalMachine) BeforeTransition(h TransitionHook) {
+	m.before = append(m.before, h)
+}
+
+// AfterTransition adds a hook that runs after the status has changed.
+func (m *GoalMachine) AfterTransition(h TransitionHook) {
+	m.after = append(m.after, h)
+}
+
+// CanTransition reports whether the table allows from -> to. Staying in the
+// same status is always allowed.
+func (m *GoalMachine) CanTransition(from, to GoalStatus) bool {
+	return from == to || slices.Contains(m.table[from], to)
+}
+
+// Check returns ErrInvalidTransition unless g may move to status to.
+func (m *GoalMachine) Check(g *Goal, to GoalStatus) error {
+	if _, ok := m.table[to]; !ok || to == "" {
+		return fmt.Errorf("%w: unknown status %q for goal %s", ErrInvalidTransition, to, g.ID)
+	}
+	if g.Status == to {
+		return nil
+	}
+	if !m.CanTransition(g.Status, to) {
+		return fmt.Errorf("%w: goal %s cannot go from %q to %q", ErrInvalidTransition, g.ID, g.Status, to)
+	}
+	for _, guard := range m.guards[to] {
+		if err := guard(g); err != nil {
+			return fmt.Errorf("%w: goal %s to %q: %w", ErrInvalidTransition, g.ID, to, err)
+		}
+	}
+	return nil
+}
+
+func requireQuestion(g *Goal) error {
+	if len(g.Missing) == 0 || strings.TrimSpace(g.NextQuestion) == "" {
+		return errors.New("blocked requires missing and next_question")
+	}
+	return nil
+}
+
+// UseGoalMachine makes s check its status changes against m instead of the
+// default machine.
+func (s *SessionState) UseGoalMachine(m *GoalMachine) {
+	s.machine = m
+}
+
+func (s *SessionState) goalMachine() *GoalMachine {
+	if s.machine != nil {
+		return s.machine
+	}
+	return defaultGoalMachine
+}
+
+// transition moves a goal to status to through the machine: check, before
+// hooks, the status_changed event, after hooks.
+func (s *SessionState) transition(g *Goal, to GoalStatus, now time.Time) error {
+	m := s.goalMachine()
+	if err := m.Check(g, to); err != nil {
+		return err
+	}
+	if g.Status == to {
+		return nil
+	}
+
+	t := Transition{GoalID: g.ID, From: g.Status, To: to, At: now.UTC()}
+	for _, h := range m.before {
+		if err := h(s, t); err != nil {
+			return err
+		}
+	}
+	if err := s.emit(GoalEvent{Type: EventStatusChanged, GoalID: g.ID, From: t.From, To: to, At: now}); err != nil {
+		return err
+	}
+	for _, h := range m.after {
+		if err := h(s, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingStatus is the status a goal in status from settles in once its
+// missing slots are set: blocked while slots are missing, active again once
+// they are filled. Suspended and closed goals keep their status.
+func missingStatus(from GoalStatus, missing []string) GoalStatus {
+	switch {
+	case from == GoalDone || from == GoalCancelled || from == GoalSuspended:
+		return from
+	case len(missing) > 0:
+		return GoalBlocked
+	case from == GoalBlocked:
+		return GoalActive
+	default:
+		return from
+	}
+}
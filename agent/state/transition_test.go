@@ -0,0 +1,243 @@
+package state
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGoalMachineRejectsIllegalMoves(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	g := CreateGoal("sales", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(g); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.SetGoalStatus(g.ID, GoalBlocked, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("blocked without a question: got %v, want ErrInvalidTransition", err)
+	}
+	if err := st.SetGoalStatus(g.ID, "paused", now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("unknown status: got %v, want ErrInvalidTransition", err)
+	}
+	if err := st.MarkGoalDone(g.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalStatus(g.ID, GoalActive, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("reopening a done goal: got %v, want ErrInvalidTransition", err)
+	}
+	if err := st.SuspendAndActivate(g.ID, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("activating a done goal: got %v, want ErrInvalidTransition", err)
+	}
+	if st.Goals[g.ID].Status != GoalDone {
+		t.Fatalf("status changed after rejected moves: %s", st.Goals[g.ID].Status)
+	}
+}
+
+func TestGoalMachineRunsGuardsAndHooks(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+
+	var seen []Transition
+	m := NewGoalMachine()
+	m.Guard(GoalDone, func(g *Goal) error {
+		if _, ok := g.Slots["budget"]; !ok {
+			return errors.New("budget required")
+		}
+		return nil
+	})
+	m.BeforeTransition(func(s *SessionState, tr Transition) error {
+		if s.Goals[tr.GoalID].Status != tr.From {
+			t.Errorf("before hook saw status %s, want %s", s.Goals[tr.GoalID].Status, tr.From)
+		}
+		return nil
+	})
+	m.AfterTransition(func(s *SessionState, tr Transition) error {
+		seen = append(seen, tr)
+		return nil
+	})
+	st.UseGoalMachine(m)
+
+	g := CreateGoal("sales", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(g); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalMissing(g.ID, []string{"budget"}, "งบเท่าไหร่ครับ", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MarkGoalDone(g.ID, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("guarded done: got %v, want ErrInvalidTransition", err)
+	}
+	if err := st.PatchSlots(g.ID, map[string]any{"budget": 35000}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetGoalMissing(g.ID, nil, "", now); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Transition{
+		{GoalID: g.ID, From: GoalActive, To: GoalBlocked, At: now},
+		{GoalID: g.ID, From: GoalBlocked, To: GoalActive, At: now},
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("after hooks saw %+v, want %+v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("transition %d = %+v, want %+v", i, seen[i], want[i])
+		}
+	}
+}
+
+func TestSetGoalMissingUsesTheSessionMachine(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	m := NewGoalMachine()
+	m.Guard(GoalBlocked, func(g *Goal) error { return errors.New("never blocked") })
+	st.UseGoalMachine(m)
+
+	g := CreateGoal("sales", "sales.recommend_item", 50, now)
+	if err := st.AddGoal(g); err != nil {
+		t.Fatal(err)
+	}
+	seq := st.EventSeq
+	if err := st.SetGoalMissing(g.ID, []string{"budget"}, "งบเท่าไหร่ครับ", now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("guarded blocked: got %v, want ErrInvalidTransition", err)
+	}
+	if g.Status != GoalActive || len(g.Missing) != 0 || st.EventSeq != seq {
+		t.Fatalf("rejected move changed the goal: status=%s missing=%v events=%d", g.Status, g.Missing, st.EventSeq-seq)
+	}
+}
+
+func TestCancelGoalRemovesItFromAnywhereInTheStack(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	for _, id := range []string{"laptop", "mouse", "screen"} {
+		if err := st.AddGoal(CreateGoal(id, "sales.recommend_item", 50, now)); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SuspendAndActivate(id, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Dropping a goal in the middle leaves the active goal alone.
+	if err := st.CancelGoal("mouse", now); err != nil {
+		t.Fatal(err)
+	}
+	if st.ActiveGoalID != "screen" || !slices.Equal(st.GoalStack, []string{"laptop", "screen"}) {
+		t.Fatalf("after cancelling mouse: active=%s stack=%v", st.ActiveGoalID, st.GoalStack)
+	}
+
+	// Dropping the active goal resumes the one underneath.
+	if err := st.CancelGoal("screen", now); err != nil {
+		t.Fatal(err)
+	}
+	if st.ActiveGoalID != "laptop" || st.Goals["laptop"].Status != GoalActive {
+		t.Fatalf("expected laptop resumed, got active=%s status=%s", st.ActiveGoalID, st.Goals["laptop"].Status)
+	}
+	if !st.Goals["screen"].IsCancelled() || st.Goals["screen"].IsDone() {
+		t.Fatalf("screen status = %s, want cancelled", st.Goals["screen"].Status)
+	}
+	if err := st.MarkGoalDone("screen", now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("completing a cancelled goal: got %v, want ErrInvalidTransition", err)
+	}
+
+	replayed, err := ReplayGoalEvents(st.PendingEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ActiveGoalID != "laptop" || !slices.Equal(replayed.GoalStack, []string{"laptop"}) {
+		t.Fatalf("replay diverged: active=%s stack=%v", replayed.ActiveGoalID, replayed.GoalStack)
+	}
+}
+
+func TestSwitchToGoalBringsAnySuspendedGoalToTop(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	for _, id := range []string{"laptop", "mouse", "screen"} {
+		if err := st.AddGoal(CreateGoal(id, "sales.recommend_item", 50, now)); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SuspendAndActivate(id, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := st.SwitchToGoal("laptop", now); err != nil {
+		t.Fatal(err)
+	}
+	if st.ActiveGoalID != "laptop" || !slices.Equal(st.GoalStack, []string{"mouse", "screen", "laptop"}) {
+		t.Fatalf("after switch: active=%s stack=%v", st.ActiveGoalID, st.GoalStack)
+	}
+	if st.Goals["laptop"].Status != GoalActive || st.Goals["screen"].Status != GoalSuspended {
+		t.Fatalf("statuses: laptop=%s screen=%s", st.Goals["laptop"].Status, st.Goals["screen"].Status)
+	}
+
+	// Finishing the resumed goal returns to the goal that was interrupted.
+	if err := st.MarkGoalDone("laptop", now); err != nil {
+		t.Fatal(err)
+	}
+	if st.ActiveGoalID != "screen" {
+		t.Fatalf("expected screen resumed, got %s", st.ActiveGoalID)
+	}
+	if err := st.SwitchToGoal("laptop", now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("switching to a done goal: got %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestQueueGoalPutsGoalsBeneathTheActiveGoal(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	st := NewSessionState("s1", "w", "c", "web", now)
+	st.BeginTurn()
+	for _, id := range []string{"laptop", "mouse", "keyboard", "screen"} {
+		if err := st.AddGoal(CreateGoal(id, "sales.recommend_item", 50, now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"laptop", "screen"} {
+		if err := st.SuspendAndActivate(id, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := st.QueueGoal("screen", now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("queueing the active goal: got %v, want ErrInvalidTransition", err)
+	}
+	// Queued lowest priority first, so the most urgent ends up right underneath.
+	for _, id := range []string{"keyboard", "mouse"} {
+		if err := st.QueueGoal(id, now); err != nil {
+			t.Fatalf("QueueGoal(%s): %v", id, err)
+		}
+	}
+	if st.ActiveGoalID != "screen" || !slices.Equal(st.GoalStack, []string{"laptop", "keyboard", "mouse", "screen"}) {
+		t.Fatalf("after queueing: active=%s stack=%v", st.ActiveGoalID, st.GoalStack)
+	}
+	if st.Goals["mouse"].Status != GoalSuspended || st.Goals["keyboard"].Status != GoalSuspended {
+		t.Fatalf("statuses: mouse=%s keyboard=%s", st.Goals["mouse"].Status, st.Goals["keyboard"].Status)
+	}
+
+	// Queueing a goal already on the stack moves it.
+	if err := st.QueueGoal("laptop", now); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(st.GoalStack, []string{"keyboard", "mouse", "laptop", "screen"}) {
+		t.Fatalf("after moving laptop: stack=%v", st.GoalStack)
+	}
+
+	if err := st.MarkGoalDone("screen", now); err != nil {
+		t.Fatal(err)
+	}
+	if st.ActiveGoalID != "laptop" || st.Goals["laptop"].Status != GoalActive {
+		t.Fatalf("expected laptop resumed, got active=%s", st.ActiveGoalID)
+	}
+
+	replayed, err := ReplayGoalEvents(st.PendingEvents())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed.ActiveGoalID != st.ActiveGoalID || !slices.Equal(replayed.GoalStack, st.GoalStack) {
+		t.Fatalf("replay diverged: active=%s stack=%v", replayed.ActiveGoalID, replayed.GoalStack)
+	}
+}
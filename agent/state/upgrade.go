@@ -0,0 +1,57 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SessionScanner is implemented by stores that can enumerate stored sessions.
+// fn is called once per live session id; returning an error stops the scan.
+type SessionScanner interface {
+	ScanSessionIDs(ctx context.Context, fn func(sessionID string) error) error
+}
+
+// UpgradeReport summarizes an UpgradeSessions run.
+type UpgradeReport struct {
+	Scanned  int
+	Upgraded int
+	// Failed maps session id to the error that stopped its upgrade.
+	Failed map[string]error
+}
+
+// UpgradeSessions rewrites every stored session whose schema is older than
+// CurrentSchemaVersion. Load performs the migration; Save persists it with the
+// usual version check, so a session changed concurrently is reported as failed
+// and can be retried. Saving also restarts the session TTL.
+func UpgradeSessions(ctx context.Context, store Store) (UpgradeReport, error) {
+	report := UpgradeReport{Failed: make(map[string]error)}
+
+	scanner, ok := store.(SessionScanner)
+	if !ok {
+		return report, fmt.Errorf("store %T cannot enumerate sessions", store)
+	}
+
+	err := scanner.ScanSessionIDs(ctx, func(sessionID string) error {
+		report.Scanned++
+
+		st, err := store.Load(ctx, sessionID)
+		if errors.Is(err, ErrStateNotFound) {
+			return nil
+		}
+		if err != nil {
+			report.Failed[sessionID] = err
+			return nil
+		}
+		if st.LoadedSchemaVersion() >= CurrentSchemaVersion {
+			return nil
+		}
+		if err := store.Save(ctx, st); err != nil {
+			report.Failed[sessionID] = err
+			return nil
+		}
+		report.Upgraded++
+		return nil
+	})
+	return report, err
+}
@@ -3,9 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"github.com/rs/zerolog/log"
+	orchestratorx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/agents/orchestrator"
 	specialistx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/agents/specialist"
 	llmx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/llm"
+	serverx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/server"
 	statex "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/agent/state"
 	configx "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/pkg/config"
 	_ "github.com/tanpawarit/Chative-Advanced-Task-Oriented-Dialogue/pkg/logger/autoload"
@@ -18,6 +28,19 @@ type AppConfig struct {
 }
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := openStore(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-sessions" {
+		migrateSessions(ctx, store)
+		return
+	}
+
 	_ = configx.MustNew[AppConfig]("")
 
 	openRouterCfg := configx.MustNew[openrouterx.Config]("OPENROUTER")
@@ -26,14 +49,118 @@ func main() {
 	}
 
 	modelCfg := configx.MustNew[llmx.Config]("OPENROUTER")
-	if _, err := specialistx.NewRegistry(context.Background(), *modelCfg); err != nil {
+	registry, err := specialistx.NewRegistry(ctx, *modelCfg)
+	if err != nil {
 		panic(err)
 	}
 
-	upstashRedisCfg := configx.MustNew[statex.UpstashRedisConfig]("UPSTASH_REDIS")
-	if _, err := statex.NewUpstashRedisStore(*upstashRedisCfg); err != nil {
+	locker, err := openLocker(store)
+	if err != nil {
+		log.Fatal().Err(err).Msg("open session locker")
+	}
+
+	orchestratorCfg := configx.MustNew[orchestratorx.Config]("ORCHESTRATOR")
+	orchestrator, err := orchestratorx.New(store, registry, nil, *orchestratorCfg, orchestratorx.WithLocker(locker))
+	if err != nil {
+		panic(err)
+	}
+
+	srv, err := serverx.New(orchestrator, store)
+	if err != nil {
 		panic(err)
 	}
 
-	fmt.Println("Config and clients loaded")
+	serverCfg := configx.MustNew[serverx.Config]("HTTP")
+	log.Info().Str("addr", serverCfg.Addr).Msg("http server listening")
+	if err := srv.ListenAndServe(ctx, *serverCfg); err != nil {
+		log.Fatal().Err(err).Msg("http server stopped")
+	}
+	log.Info().Msg("http server stopped")
+}
+
+// openStore builds the session store selected by STATE_STORE_BACKEND.
+func openStore(ctx context.Context) (statex.Store, error) {
+	storeCfg := configx.MustNew[statex.StoreConfig]("STATE_STORE")
+	opts := []statex.StoreOption{
+		statex.WithTTL(storeCfg.TTL),
+		statex.WithSnapshotHistory(storeCfg.History),
+		statex.WithEventLimit(storeCfg.Events),
+	}
+	switch storeCfg.Backend {
+	case "upstash":
+		upstashRedisCfg := configx.MustNew[statex.UpstashRedisConfig]("UPSTASH_REDIS")
+		return statex.NewUpstashRedisStore(*upstashRedisCfg, opts...)
+	case "redis":
+		redisCfg := configx.MustNew[statex.RedisConfig]("REDIS")
+		return statex.NewRedisStore(*redisCfg, opts...)
+	case "sql":
+		sqlCfg := configx.MustNew[statex.SQLConfig]("SQL")
+		sqlStore, err := statex.OpenSQLStore(ctx, *sqlCfg, opts...)
+		if err != nil {
+			return nil, err
+		}
+		go sqlStore.PurgeExpiredEvery(ctx, 10*time.Minute, func(err error) {
+			log.Error().Err(err).Msg("purge expired sessions")
+		})
+		return sqlStore, nil
+	case "memory":
+		return statex.NewMemoryStore(opts...)
+	case "file":
+		return statex.NewFileStore(storeCfg.Dir, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported STATE_STORE_BACKEND: %s", storeCfg.Backend)
+	}
+}
+
+// openLocker builds the session locker selected by SESSION_LOCK_BACKEND. The
+// Redis locker shares the connection of a Redis-backed session store, and
+// connects with the REDIS_* settings when sessions are stored elsewhere.
+func openLocker(store statex.Store) (statex.Locker, error) {
+	lockCfg, err := configx.New[statex.LockConfig]("SESSION_LOCK")
+	if err != nil {
+		return nil, err
+	}
+	switch lockCfg.Backend {
+	case "memory":
+		return statex.NewMemoryLocker(), nil
+	case "redis":
+		switch s := store.(type) {
+		case *statex.UpstashRedisStore:
+			return statex.NewUpstashRedisLocker(s, *lockCfg)
+		case *statex.RedisStore:
+			return statex.NewRedisLocker(s, *lockCfg)
+		}
+		redisCfg, err := configx.New[statex.RedisConfig]("REDIS")
+		if err != nil {
+			return nil, fmt.Errorf("SESSION_LOCK_BACKEND=redis needs REDIS_* settings unless STATE_STORE_BACKEND is upstash or redis: %w", err)
+		}
+		redisStore, err := statex.NewRedisStore(*redisCfg)
+		if err != nil {
+			return nil, err
+		}
+		return statex.NewRedisLocker(redisStore, *lockCfg)
+	default:
+		return nil, fmt.Errorf("unsupported SESSION_LOCK_BACKEND: %s", lockCfg.Backend)
+	}
+}
+
+// migrateSessions rewrites every stored session at the current schema version.
+// Run it with `go run . migrate-sessions` before rolling out a schema bump.
+func migrateSessions(ctx context.Context, store statex.Store) {
+	report, err := statex.UpgradeSessions(ctx, store)
+	for id, failure := range report.Failed {
+		log.Error().Err(failure).Str("session_id", id).Msg("upgrade session")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("migrate sessions")
+	}
+	log.Info().
+		Int("schema_version", statex.CurrentSchemaVersion).
+		Int("scanned", report.Scanned).
+		Int("upgraded", report.Upgraded).
+		Int("failed", len(report.Failed)).
+		Msg("sessions migrated")
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
 }